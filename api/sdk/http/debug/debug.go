@@ -0,0 +1,80 @@
+package debug
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+
+	"github.com/aborilov/hippo/api/sdk/http/response"
+	"github.com/gorilla/mux"
+)
+
+// Mux returns a mux serving the pprof profiles under /debug/pprof/ and the
+// expvar variables under /debug/vars.
+func Mux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	return mux
+}
+
+// PublishInfo publishes the build version and the configuration in expvar.
+// The configuration is expected in the form produced by conf.String, which
+// has secrets already masked.
+func PublishInfo(build string, config string) {
+	expvar.NewString("build").Set(build)
+
+	cfg := expvar.NewMap("config")
+	for _, line := range strings.Split(config, "\n") {
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "--"), "=")
+		if !ok {
+			continue
+		}
+		s := new(expvar.String)
+		s.Set(value)
+		cfg.Set(key, s)
+	}
+}
+
+// Route describes a route registered on the API router.
+type Route struct {
+	Path    string   `json:"path"`
+	Methods []string `json:"methods"`
+}
+
+// Routes returns the route table of router.
+func Routes(router *mux.Router) ([]Route, error) {
+	var routes []Route
+	err := router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+
+		methods, err := route.GetMethods()
+		if err != nil {
+			methods = []string{"ANY"}
+		}
+
+		routes = append(routes, Route{Path: path, Methods: methods})
+		return nil
+	})
+	return routes, err
+}
+
+// RoutesHandler serves the route table of router.
+func RoutesHandler(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		routes, err := Routes(router)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		response.WriteJSON(w, r, routes)
+	})
+}
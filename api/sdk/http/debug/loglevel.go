@@ -0,0 +1,40 @@
+// Package debug provides the handlers served on the debug listener.
+package debug
+
+import (
+	"encoding/json"
+	"net/http"
+
+	httpErrors "github.com/aborilov/hippo/api/sdk/http/errors"
+	"github.com/aborilov/hippo/api/sdk/http/response"
+	"github.com/aborilov/hippo/foundation/logger"
+)
+
+// LogLevel reports the runtime log levels on GET and replaces them on PUT
+// with a body such as {"level":"info","levels":{"medication.repo":"debug"}}.
+func LogLevel(levels *logger.Levels) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			var s logger.Settings
+			if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+				httpErrors.BadRequest(w, "Invalid JSON request body")
+				return
+			}
+			if err := levels.Apply(s); err != nil {
+				httpErrors.BadRequest(w, err.Error())
+				return
+			}
+			logger.FromContext(r.Context()).Info("log levels changed", "level", s.Level, "levels", s.Levels)
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			httpErrors.JSON.SetCode(httpErrors.CodeInvalidRequest).
+				SetHTTPCode(http.StatusMethodNotAllowed).
+				SetMessage("method not allowed").Write(w)
+			return
+		}
+
+		response.WriteJSON(w, r, levels.Settings())
+	})
+}
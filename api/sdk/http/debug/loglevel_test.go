@@ -0,0 +1,85 @@
+package debug_test
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aborilov/hippo/api/sdk/http/debug"
+	"github.com/aborilov/hippo/foundation/logger"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestLogLevel(t *testing.T) {
+	levels := logger.NewLevels(zapcore.InfoLevel)
+	h := debug.LogLevel(levels)
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		status int
+		want   logger.Settings
+	}{
+		{
+			name:   "get",
+			method: http.MethodGet,
+			status: http.StatusOK,
+			want:   logger.Settings{Level: "info", Levels: map[string]string{}},
+		},
+		{
+			name:   "put",
+			method: http.MethodPut,
+			body:   `{"level": "warn", "levels": {"medication.repo": "2"}}`,
+			status: http.StatusOK,
+			want:   logger.Settings{Level: "warn", Levels: map[string]string{"medication.repo": "2"}},
+		},
+		{
+			name:   "invalid level",
+			method: http.MethodPut,
+			body:   `{"level": "loud"}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "invalid json",
+			method: http.MethodPut,
+			body:   `{"level":`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "method",
+			method: http.MethodDelete,
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "unchanged by failed requests",
+			method: http.MethodGet,
+			status: http.StatusOK,
+			want:   logger.Settings{Level: "warn", Levels: map[string]string{"medication.repo": "2"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(tt.method, "/debug/loglevel", strings.NewReader(tt.body)))
+
+			if rec.Code != tt.status {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var got logger.Settings
+			if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+				t.Fatalf("decode: %s", err)
+			}
+			if got.Level != tt.want.Level || !maps.Equal(got.Levels, tt.want.Levels) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -12,6 +12,10 @@ const (
 	CodeInternalError  = "INTERNAL_ERROR"
 	CodeInvalidRequest = "INVALID_REQUEST"
 	CodeNotFound       = "NOT_FOUND"
+	CodeUnauthorized   = "UNAUTHORIZED"
+	CodeForbidden      = "FORBIDDEN"
+	CodeConflict       = "CONFLICT"
+	CodeTooMany        = "TOO_MANY_REQUESTS"
 )
 
 var (
@@ -24,6 +28,18 @@ var (
 	// BadRequestError - base error with http status 400
 	BadRequestError = JSON.SetCode(CodeInvalidRequest).SetHTTPCode(http.StatusBadRequest)
 
+	// UnauthorizedError - base error with http status 401
+	UnauthorizedError = JSON.SetCode(CodeUnauthorized).SetHTTPCode(http.StatusUnauthorized)
+
+	// ForbiddenError - base error with http status 403
+	ForbiddenError = JSON.SetCode(CodeForbidden).SetHTTPCode(http.StatusForbidden)
+
+	// ConflictError - base error with http status 409
+	ConflictError = JSON.SetCode(CodeConflict).SetHTTPCode(http.StatusConflict)
+
+	// TooManyError - base error with http status 429
+	TooManyError = JSON.SetCode(CodeTooMany).SetHTTPCode(http.StatusTooManyRequests)
+
 	// InternalError - base error with http status 500
 	InternalError = JSON.SetCode(CodeInternalError).SetHTTPCode(http.StatusInternalServerError)
 )
@@ -45,12 +61,31 @@ func BadRequest(w http.ResponseWriter, msg string) {
 	BadRequestError.SetMessage(msg).Write(w)
 }
 
-// Internal - write InternalError error with message to response and log err if it's not nil
-func Internal(w http.ResponseWriter, msg string, err error) {
+// Unauthorized - write UnauthorizedError error with message to response
+func Unauthorized(w http.ResponseWriter, msg string) {
+	UnauthorizedError.SetMessage(msg).Write(w)
+}
+
+// Forbidden - write ForbiddenError error with detail code and message to response
+func Forbidden(w http.ResponseWriter, detailCode string, msg string) {
+	ForbiddenError.SetDetailCode(detailCode).SetMessage(msg).Write(w)
+}
+
+// Conflict - write ConflictError error with message to response
+func Conflict(w http.ResponseWriter, msg string) {
+	ConflictError.SetMessage(msg).Write(w)
+}
+
+// TooMany - write TooManyError error with message to response
+func TooMany(w http.ResponseWriter, msg string) {
+	TooManyError.SetMessage(msg).Write(w)
+}
+
+// Internal - write InternalError error with message to response and log err
+// with the request logger if it's not nil
+func Internal(w http.ResponseWriter, r *http.Request, msg string, err error) {
 	if err != nil {
-		// TODO: use default logger
-		log, _ := logger.NewLogger()
-		log.Error(err, msg)
+		logger.FromContext(r.Context()).Error(err, msg)
 	}
 	InternalError.SetMessage(msg).Write(w)
 }
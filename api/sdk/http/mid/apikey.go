@@ -0,0 +1,36 @@
+package mid
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/aborilov/hippo/business/apikey/model"
+	"github.com/aborilov/hippo/business/sdk/auth"
+)
+
+const apiKeyScheme = "ApiKey "
+
+// APIKeys authenticates requests carrying an "Authorization: ApiKey <key>"
+// header.
+type APIKeys struct {
+	Service model.Service
+}
+
+// Authenticate implements Authenticator.
+func (a APIKeys) Authenticate(r *http.Request) (auth.Principal, bool, error) {
+	h := r.Header.Get("Authorization")
+	if len(h) < len(apiKeyScheme) || !strings.EqualFold(h[:len(apiKeyScheme)], apiKeyScheme) {
+		return auth.Principal{}, false, nil
+	}
+
+	p, err := a.Service.Authenticate(r.Context(), strings.TrimSpace(h[len(apiKeyScheme):]))
+	if err != nil {
+		if errors.Is(err, model.ErrInvalidKey) {
+			return auth.Principal{}, false, fmt.Errorf("%w: %w", auth.ErrUnauthenticated, err)
+		}
+		return auth.Principal{}, false, fmt.Errorf("verify api key: %w", err)
+	}
+	return p, true, nil
+}
@@ -0,0 +1,93 @@
+// Package mid provides the HTTP middleware used by the services.
+package mid
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	httpErrors "github.com/aborilov/hippo/api/sdk/http/errors"
+	"github.com/aborilov/hippo/business/sdk/auth"
+	"github.com/aborilov/hippo/foundation/logger"
+	"github.com/gorilla/mux"
+)
+
+// Authenticator resolves the caller of a request. It returns false when the
+// request carries no credentials the authenticator understands, and an error
+// wrapping auth.ErrUnauthenticated when the credentials are rejected.
+type Authenticator interface {
+	Authenticate(r *http.Request) (auth.Principal, bool, error)
+}
+
+// Authenticate stores the principal resolved by the first matching
+// authenticator in the request context. Requests without credentials are
+// passed through anonymously and authorization is left to the business layer.
+func Authenticate(authenticators ...Authenticator) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, a := range authenticators {
+				p, ok, err := a.Authenticate(r)
+				if err != nil {
+					if errors.Is(err, auth.ErrUnauthenticated) {
+						httpErrors.Unauthorized(w, err.Error())
+						return
+					}
+					httpErrors.Internal(w, r, "unable to authenticate request", err)
+					return
+				}
+				if ok {
+					ctx := auth.SetPrincipal(r.Context(), p)
+					ctx = logger.With(ctx, "principal", p.Subject)
+					r = r.WithContext(ctx)
+					break
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ProxyHeaders authenticates requests by trusting the identity headers set by
+// an authenticating reverse proxy in front of the service.
+type ProxyHeaders struct {
+	SubjectHeader string
+	RolesHeader   string
+}
+
+// Authenticate implements Authenticator.
+func (h ProxyHeaders) Authenticate(r *http.Request) (auth.Principal, bool, error) {
+	subject := r.Header.Get(h.SubjectHeader)
+	if subject == "" {
+		return auth.Principal{}, false, nil
+	}
+
+	p := auth.Principal{Subject: subject}
+	for _, role := range strings.Split(r.Header.Get(h.RolesHeader), ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			p.Roles = append(p.Roles, auth.Role(role))
+		}
+	}
+	return p, true, nil
+}
+
+// Authorize rejects requests whose principal lacks perm. It is meant for
+// endpoints that are not backed by a business service doing its own checks.
+func Authorize(authz auth.Authorizer, perm auth.Permission) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			err := authz.Authorize(r.Context(), perm)
+
+			var forbidden auth.ErrForbidden
+			switch {
+			case err == nil:
+				next.ServeHTTP(w, r)
+			case errors.Is(err, auth.ErrUnauthenticated):
+				httpErrors.Unauthorized(w, "authentication required")
+			case errors.As(err, &forbidden):
+				httpErrors.Forbidden(w, forbidden.DetailCode(), forbidden.Error())
+			default:
+				httpErrors.Internal(w, r, "unable to authorize request", err)
+			}
+		})
+	}
+}
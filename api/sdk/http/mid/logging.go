@@ -0,0 +1,96 @@
+package mid
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/aborilov/hippo/foundation/logger"
+	"github.com/aborilov/hippo/foundation/requestid"
+	"github.com/go-logr/logr"
+	"github.com/gorilla/mux"
+)
+
+// RequestIDHeader is the header a request identifier is read from and
+// echoed back in.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLen bounds request identifiers accepted from clients.
+const maxRequestIDLen = 128
+
+// RequestID propagates the X-Request-ID of the request or generates a new one
+// and stores it in the request context.
+func RequestID() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(RequestIDHeader)
+			if !validRequestID(id) {
+				id = requestid.New()
+			}
+			w.Header().Set(RequestIDHeader, id)
+			next.ServeHTTP(w, r.WithContext(requestid.NewContext(r.Context(), id)))
+		})
+	}
+}
+
+// Logger attaches a logger tagged with the request identifier to the request
+// context.
+func Logger(log logr.Logger) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			l := log.WithValues("request_id", requestid.FromContext(r.Context()))
+			next.ServeHTTP(w, r.WithContext(logger.NewContext(r.Context(), l)))
+		})
+	}
+}
+
+// Route adds the template of the matched route to the request logger and
+// reports it to the Metrics middleware. It must be installed on the router so
+// the route is known.
+func Route() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if route := mux.CurrentRoute(r); route != nil {
+				if tmpl, err := route.GetPathTemplate(); err == nil {
+					if mr, ok := r.Context().Value(routeKey{}).(*matchedRoute); ok {
+						mr.template = tmpl
+					}
+					r = r.WithContext(logger.With(r.Context(), "route", tmpl))
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Logging writes an access log line for every request.
+func Logging() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rr := &responseRecorder{ResponseWriter: w}
+
+			next.ServeHTTP(rr, r)
+
+			logger.FromContext(r.Context()).WithName(logName).Info("request completed",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", rr.Status(),
+				"bytes", rr.bytes,
+				"latency", time.Since(start).String(),
+				"remote_addr", r.RemoteAddr,
+			)
+		})
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
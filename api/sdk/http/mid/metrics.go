@@ -0,0 +1,59 @@
+package mid
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aborilov/hippo/foundation/metrics"
+	"github.com/gorilla/mux"
+)
+
+// unmatchedRoute labels requests no route matched, keeping the label
+// cardinality bounded.
+const unmatchedRoute = "unmatched"
+
+// HTTPMetrics holds the request metrics recorded by the Metrics middleware.
+type HTTPMetrics struct {
+	requests *metrics.CounterVec
+	duration *metrics.HistogramVec
+}
+
+// NewHTTPMetrics creates the request metrics and registers them with reg.
+func NewHTTPMetrics(reg *metrics.Registry) *HTTPMetrics {
+	m := HTTPMetrics{
+		requests: metrics.NewCounterVec("hippo_http_requests_total",
+			"Number of HTTP requests served.", "route", "method", "code"),
+		duration: metrics.NewHistogramVec("hippo_http_request_duration_seconds",
+			"Latency of HTTP requests.", metrics.DefBuckets, "route", "method", "code"),
+	}
+	reg.Register(m.requests, m.duration)
+	return &m
+}
+
+type routeKey struct{}
+
+// matchedRoute is filled in by Route once the router has matched a request.
+type matchedRoute struct {
+	template string
+}
+
+// Metrics records request counts and latencies labelled by route template,
+// method and status class. It wraps the router so unmatched requests are
+// counted too, and relies on Route being installed on the router.
+func Metrics(m *HTTPMetrics) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			route := &matchedRoute{template: unmatchedRoute}
+			rr := &responseRecorder{ResponseWriter: w}
+
+			next.ServeHTTP(rr, r.WithContext(context.WithValue(r.Context(), routeKey{}, route)))
+
+			code := strconv.Itoa(rr.Status()/100) + "xx"
+			m.requests.Inc(route.template, r.Method, code)
+			m.duration.Observe(time.Since(start).Seconds(), route.template, r.Method, code)
+		})
+	}
+}
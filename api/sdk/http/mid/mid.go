@@ -0,0 +1,61 @@
+package mid
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// logName names the logger of the middleware so its verbosity can be tuned
+// separately.
+const logName = "http"
+
+// Wrap applies the middleware to h so the first one listed runs first.
+func Wrap(h http.Handler, mw ...mux.MiddlewareFunc) http.Handler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+	return h
+}
+
+// responseRecorder captures the status and size of a response.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	if rr.status == 0 {
+		rr.status = status
+	}
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	if rr.status == 0 {
+		rr.status = http.StatusOK
+	}
+	n, err := rr.ResponseWriter.Write(b)
+	rr.bytes += n
+	return n, err
+}
+
+// Flush lets streaming handlers flush through the recorder.
+func (rr *responseRecorder) Flush() {
+	if f, ok := rr.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (rr *responseRecorder) Unwrap() http.ResponseWriter {
+	return rr.ResponseWriter
+}
+
+func (rr *responseRecorder) Status() int {
+	if rr.status == 0 {
+		return http.StatusOK
+	}
+	return rr.status
+}
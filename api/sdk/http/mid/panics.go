@@ -0,0 +1,38 @@
+package mid
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	httpErrors "github.com/aborilov/hippo/api/sdk/http/errors"
+	"github.com/aborilov/hippo/foundation/logger"
+	"github.com/gorilla/mux"
+)
+
+// Panics recovers from panics in the handler chain, logs them with the stack
+// trace and responds with a 500 ErrorResponse.
+func Panics() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				rec := recover()
+				if rec == nil {
+					return
+				}
+				if rec == http.ErrAbortHandler {
+					panic(rec)
+				}
+
+				logger.FromContext(r.Context()).WithName(logName).Error(fmt.Errorf("panic: %v", rec), "handler panicked",
+					"method", r.Method,
+					"path", r.URL.Path,
+					"stack", string(debug.Stack()),
+				)
+				httpErrors.InternalError.SetMessage("internal server error").Write(w)
+			}()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
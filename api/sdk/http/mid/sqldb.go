@@ -0,0 +1,92 @@
+package mid
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aborilov/hippo/business/sdk/sqldb"
+	"github.com/gorilla/mux"
+)
+
+// PrimaryCookie is the cookie that keeps the reads of a client on the
+// primary database for a while after it has written. It holds the end of
+// that window in Unix milliseconds.
+const PrimaryCookie = "hippo_primary_until"
+
+// ReadYourWrites pins the reads of a request to the primary database once the
+// request has written, so responses never reflect replication lag. A request
+// that writes answers with PrimaryCookie set to window from now, window being
+// the replication lag the replicas are allowed, and requests carrying the
+// cookie read from the primary until then. Later values than now plus window
+// are not honoured, so a client can't pin itself for longer.
+func ReadYourWrites(window time.Duration) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			now := time.Now()
+			ctx := sqldb.WithReadYourWrites(r.Context())
+			if c, err := r.Cookie(PrimaryCookie); err == nil {
+				until, err := strconv.ParseInt(c.Value, 10, 64)
+				if err == nil && now.UnixMilli() < until && until <= now.Add(window).UnixMilli() {
+					ctx = sqldb.WithPrimary(ctx)
+				}
+			}
+			r = r.WithContext(ctx)
+
+			pw := &pinWriter{ResponseWriter: w, r: r, window: window}
+			next.ServeHTTP(pw, r)
+			pw.pin()
+		})
+	}
+}
+
+// pinWriter sets PrimaryCookie on the response of a request that has
+// written, just before the headers are sent.
+type pinWriter struct {
+	http.ResponseWriter
+	r      *http.Request
+	window time.Duration
+	done   bool
+}
+
+func (pw *pinWriter) pin() {
+	if pw.done {
+		return
+	}
+	pw.done = true
+	if !sqldb.Wrote(pw.r.Context()) {
+		return
+	}
+	until := time.Now().Add(pw.window)
+	http.SetCookie(pw.ResponseWriter, &http.Cookie{
+		Name:     PrimaryCookie,
+		Value:    strconv.FormatInt(until.UnixMilli(), 10),
+		Path:     "/",
+		Expires:  until,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (pw *pinWriter) WriteHeader(status int) {
+	pw.pin()
+	pw.ResponseWriter.WriteHeader(status)
+}
+
+func (pw *pinWriter) Write(b []byte) (int, error) {
+	pw.pin()
+	return pw.ResponseWriter.Write(b)
+}
+
+// Flush lets streaming handlers flush through the writer.
+func (pw *pinWriter) Flush() {
+	pw.pin()
+	if f, ok := pw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (pw *pinWriter) Unwrap() http.ResponseWriter {
+	return pw.ResponseWriter
+}
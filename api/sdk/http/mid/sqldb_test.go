@@ -0,0 +1,80 @@
+package mid_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aborilov/hippo/api/sdk/http/mid"
+	"github.com/aborilov/hippo/business/sdk/sqldb"
+	"github.com/jmoiron/sqlx"
+)
+
+func open(t *testing.T, host string) *sqlx.DB {
+	t.Helper()
+
+	// nothing connects: the handles are only told apart
+	db, err := sqlx.Open("pgx", "postgres://"+host+"/hippo")
+	if err != nil {
+		t.Fatalf("open %s: %s", host, err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestReadYourWritesAcrossRequests(t *testing.T) {
+	primary, replica := open(t, "primary"), open(t, "replica")
+	cluster := sqldb.NewCluster(primary, replica)
+
+	var read *sqlx.DB
+	h := mid.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			cluster.Writer(r.Context())
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		read = cluster.Reader(r.Context())
+	}), mid.ReadYourWrites(5*time.Second))
+
+	serve := func(method string, cookies ...*http.Cookie) *http.Response {
+		req := httptest.NewRequest(method, "/medication/", nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rec := httptest.NewRecorder()
+		read = nil
+		h.ServeHTTP(rec, req)
+		return rec.Result()
+	}
+
+	if cookies := serve(http.MethodGet).Cookies(); len(cookies) > 0 {
+		t.Errorf("a read set %v", cookies)
+	}
+	if read != replica {
+		t.Error("a client that hasn't written reads from the primary")
+	}
+
+	cookies := serve(http.MethodPost).Cookies()
+	if len(cookies) != 1 || cookies[0].Name != mid.PrimaryCookie {
+		t.Fatalf("got cookies %v after a write, want %s", cookies, mid.PrimaryCookie)
+	}
+
+	serve(http.MethodGet, cookies...)
+	if read != primary {
+		t.Error("the read following a write went to a replica")
+	}
+
+	expired := &http.Cookie{Name: mid.PrimaryCookie, Value: strconv.FormatInt(time.Now().Add(-time.Second).UnixMilli(), 10)}
+	serve(http.MethodGet, expired)
+	if read != replica {
+		t.Error("an expired pin kept reads on the primary")
+	}
+
+	forged := &http.Cookie{Name: mid.PrimaryCookie, Value: strconv.FormatInt(time.Now().Add(time.Hour).UnixMilli(), 10)}
+	serve(http.MethodGet, forged)
+	if read != replica {
+		t.Error("a pin beyond the window kept reads on the primary")
+	}
+}
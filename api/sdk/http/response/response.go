@@ -4,14 +4,14 @@ import (
 	"encoding/json"
 	"net/http"
 
-	"github.com/aborilov/hippo/api/sdk/http/errors"
+	"github.com/aborilov/hippo/foundation/logger"
 )
 
-func WriteJSON(w http.ResponseWriter, response interface{}) {
+func WriteJSON(w http.ResponseWriter, r *http.Request, response interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		errors.Internal(w, "can't write json to response", err)
+		logger.FromContext(r.Context()).Error(err, "can't write json to response")
 	}
 }
 
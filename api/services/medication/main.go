@@ -2,22 +2,36 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/aborilov/hippo/api/sdk/http/debug"
+	"github.com/aborilov/hippo/api/sdk/http/mid"
+	"github.com/aborilov/hippo/app/check"
 	"github.com/aborilov/hippo/app/medication"
+	"github.com/aborilov/hippo/business/apikey"
+	apikeypg "github.com/aborilov/hippo/business/apikey/repo/pg"
 	svc "github.com/aborilov/hippo/business/medication"
+	catalogpg "github.com/aborilov/hippo/business/medication/catalog/repo/pg"
+	"github.com/aborilov/hippo/business/medication/model"
 	"github.com/aborilov/hippo/business/medication/repo/pg"
+	"github.com/aborilov/hippo/business/medication/repo/pgpool"
+	"github.com/aborilov/hippo/business/sdk/auth"
+	"github.com/aborilov/hippo/business/sdk/migrate"
 	"github.com/aborilov/hippo/business/sdk/sqldb"
 	"github.com/aborilov/hippo/foundation/logger"
+	"github.com/aborilov/hippo/foundation/metrics"
 	"github.com/ardanlabs/conf/v3"
+	"github.com/go-logr/logr"
 	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap/zapcore"
 )
 
 var build = "develop"
@@ -25,6 +39,7 @@ var build = "develop"
 func main() {
 	ctx := context.Background()
 	if err := run(ctx); err != nil {
+		fmt.Println("msg", err)
 		os.Exit(1)
 	}
 }
@@ -33,11 +48,15 @@ func run(ctx context.Context) error {
 	cfg := struct {
 		conf.Version
 		Web struct {
-			ReadTimeout     time.Duration `conf:"default:5s"`
-			WriteTimeout    time.Duration `conf:"default:10s"`
-			IdleTimeout     time.Duration `conf:"default:120s"`
-			ShutdownTimeout time.Duration `conf:"default:20s"`
-			APIHost         string        `conf:"default:0.0.0.0:6000"`
+			ReadTimeout       time.Duration `conf:"default:5s"`
+			WriteTimeout      time.Duration `conf:"default:10s"`
+			IdleTimeout       time.Duration `conf:"default:120s"`
+			ShutdownTimeout   time.Duration `conf:"default:20s"`
+			DrainTimeout      time.Duration `conf:"default:5s,help:time readiness fails before the API stops"`
+			ReadyTimeout      time.Duration `conf:"default:2s"`
+			APIHost           string        `conf:"default:0.0.0.0:6000"`
+			DebugHost         string        `conf:"default:0.0.0.0:6010"`
+			DebugWriteTimeout time.Duration `conf:"default:2m,help:write timeout of the debug listener; above the 30s pprof profiles take"`
 		}
 		DB struct {
 			User         string `conf:"default:postgres"`
@@ -46,7 +65,39 @@ func run(ctx context.Context) error {
 			Name         string `conf:"default:postgres"`
 			MaxIdleConns int    `conf:"default:0"`
 			MaxOpenConns int    `conf:"default:0"`
-			DisableTLS   bool   `conf:"default:true"`
+
+			SSLMode          string        `conf:"default:disable,help:disable allow prefer require verify-ca or verify-full"`
+			DisableTLS       string        `conf:"help:deprecated alias of ssl-mode where false means require"`
+			SSLRootCert      string        `conf:"help:CA bundle used to verify the server"`
+			SSLCert          string        `conf:"help:client certificate"`
+			SSLKey           string        `conf:"help:client certificate key"`
+			ConnectTimeout   time.Duration `conf:"default:10s"`
+			StatementTimeout time.Duration `conf:"default:30s"`
+
+			Driver         string        `conf:"default:sql,help:sql or pgxpool for the medication repository"`
+			StartupTimeout time.Duration `conf:"default:60s"`
+			Migrate        bool          `conf:"default:false,help:apply pending migrations at startup"`
+			MigrateTimeout time.Duration `conf:"default:5m,help:time to wait for the migration lock and run migrations"`
+
+			ReplicaHosts         []string      `conf:"help:read replica hosts separated by ;"`
+			ReplicaDSNs          []string      `conf:"mask,help:read replica postgres urls separated by ; overriding the primary settings"`
+			ReplicaCheckInterval time.Duration `conf:"default:10s"`
+			ReadYourWrites       bool          `conf:"default:true,help:read from the primary after a client writes"`
+			ReplicationLag       time.Duration `conf:"default:5s,help:replica lag allowed; clients read from the primary this long after writing"`
+
+			SlowQueryThreshold time.Duration `conf:"default:200ms,help:log statements slower than this; 0s disables"`
+		}
+		Auth struct {
+			Policy            auth.Policy `conf:"default:viewer=medication:read;pharmacist=medication:read|medication:write;admin=*"`
+			TrustProxyHeaders bool        `conf:"default:false"`
+			SubjectHeader     string      `conf:"default:X-Auth-Subject"`
+			RolesHeader       string      `conf:"default:X-Auth-Roles"`
+		}
+		Log struct {
+			Format string `conf:"default:console,help:console or json"`
+			Level  string `conf:"default:info,help:zap level name or logr verbosity"`
+			Levels string `conf:"help:per logger overrides as name:level;name:level"`
+			File   string `conf:"help:JSON log level settings applied at startup and on SIGHUP"`
 		}
 	}{
 		Version: conf.Version{
@@ -65,105 +116,319 @@ func run(ctx context.Context) error {
 		return fmt.Errorf("parsing config: %w", err)
 	}
 
-	fmt.Println("starting service", "version", cfg.Build)
-	defer fmt.Println("shutdown complete")
+	levels := logger.NewLevels(zapcore.InfoLevel)
+	if err := loadLogLevels(levels, cfg.Log.Level, cfg.Log.Levels, cfg.Log.File); err != nil {
+		return fmt.Errorf("loading log levels: %w", err)
+	}
+
+	log, err := logger.NewLogger(logger.WithFormat(cfg.Log.Format), logger.WithLevels(levels))
+	if err != nil {
+		return fmt.Errorf("constructing logger: %w", err)
+	}
+	log = log.WithValues("service", "medication")
+	logger.SetDefault(log)
+
+	log.Info("starting service", "version", cfg.Build)
+	defer log.Info("shutdown complete")
 
 	out, err := conf.String(&cfg)
 	if err != nil {
 		return fmt.Errorf("generating config for output: %w", err)
 	}
-	fmt.Println("startup", "config", out)
+	log.Info("startup", "config", out)
+	debug.PublishInfo(cfg.Build, out)
 
-	fmt.Println("startup", "status", "initializing database support", "hostport", cfg.DB.Host)
+	log.Info("startup", "status", "initializing database support", "hostport", cfg.DB.Host)
 
-	db, err := sqldb.Open(sqldb.Config{
+	sslMode, err := sqldb.LegacySSLMode(cfg.DB.SSLMode, cfg.DB.DisableTLS)
+	if err != nil {
+		return fmt.Errorf("db config: %w", err)
+	}
+	if cfg.DB.DisableTLS != "" {
+		log.Info("startup", "warning", "HIPPO_DB_DISABLE_TLS is deprecated, use HIPPO_DB_SSL_MODE", "sslmode", sslMode)
+	}
+
+	dbCfg := sqldb.Config{
 		User:         cfg.DB.User,
 		Password:     cfg.DB.Password,
 		Host:         cfg.DB.Host,
 		Name:         cfg.DB.Name,
 		MaxIdleConns: cfg.DB.MaxIdleConns,
 		MaxOpenConns: cfg.DB.MaxOpenConns,
-		DisableTLS:   cfg.DB.DisableTLS,
-	})
+
+		SSLMode:          sslMode,
+		SSLRootCert:      cfg.DB.SSLRootCert,
+		SSLCert:          cfg.DB.SSLCert,
+		SSLKey:           cfg.DB.SSLKey,
+		ConnectTimeout:   cfg.DB.ConnectTimeout,
+		StatementTimeout: cfg.DB.StatementTimeout,
+	}
+
+	replicas, err := sqldb.ReplicaConfigs(dbCfg, cfg.DB.ReplicaHosts, cfg.DB.ReplicaDSNs)
+	if err != nil {
+		return fmt.Errorf("db config: %w", err)
+	}
+
+	cluster, err := sqldb.OpenCluster(dbCfg, replicas)
 	if err != nil {
 		return fmt.Errorf("connecting to db: %w", err)
 	}
 
-	defer db.Close()
+	defer cluster.Close()
+	db := cluster.Primary()
+
+	log.Info("startup", "status", "waiting for database", "timeout", cfg.DB.StartupTimeout)
+
+	statusCtx, cancel := context.WithTimeout(ctx, cfg.DB.StartupTimeout)
+	defer cancel()
+
+	if err := sqldb.StatusCheck(statusCtx, db); err != nil {
+		return fmt.Errorf("status check database: %w", err)
+	}
+
+	if cfg.DB.Migrate {
+		log.Info("startup", "status", "migrating database", "timeout", cfg.DB.MigrateTimeout)
 
-	fmt.Println(ctx, "startup", "status", "initializing API support")
+		migrateCtx, cancel := context.WithTimeout(ctx, cfg.DB.MigrateTimeout)
+		defer cancel()
+
+		if err := migrate.Migrate(migrateCtx, db); err != nil {
+			return fmt.Errorf("migrating database: %w", err)
+		}
+	} else if err := migrate.Verify(statusCtx, db); err != nil {
+		return fmt.Errorf("verify migrations: %w", err)
+	}
+
+	if len(replicas) > 0 {
+		log.Info("startup", "status", "monitoring read replicas", "replicas", len(replicas))
+
+		monitorCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go cluster.Monitor(monitorCtx, cfg.DB.ReplicaCheckInterval, cfg.Web.ReadyTimeout)
+	}
+
+	log.Info("startup", "status", "initializing API support")
 
 	shutdown := make(chan os.Signal, 1)
 	signal.Notify(shutdown, syscall.SIGINT, syscall.SIGTERM)
 
+	reg := metrics.NewRegistry()
+	reg.Register(
+		metrics.NewRuntimeCollector(),
+		metrics.NewBuildInfo("hippo", build),
+		sqldb.ClusterCollector(cluster),
+	)
+	httpMetrics := mid.NewHTTPMetrics(reg)
+
+	var repo model.Repository
+	switch cfg.DB.Driver {
+	case sqldb.DriverSQL:
+		repo, err = pg.NewRepository(cluster, sqldb.NewQueries(cfg.DB.SlowQueryThreshold, reg))
+
+	case sqldb.DriverPGXPool:
+		var pool *pgxpool.Pool
+		if pool, err = openPool(ctx, log, dbCfg, cfg.DB.StartupTimeout); err != nil {
+			return fmt.Errorf("connecting to db pool: %w", err)
+		}
+		defer pool.Close()
+
+		reg.Register(sqldb.PoolStatsCollector("primary", pool))
+		repo, err = pgpool.NewRepository(pool)
+
+	default:
+		return fmt.Errorf("unsupported db driver %q", cfg.DB.Driver)
+	}
+	if err != nil {
+		return fmt.Errorf("constructing medication repository: %w", err)
+	}
+
 	r := mux.NewRouter()
-	repo, err := pg.NewRepository(db)
+	medSvc, err := svc.NewService(repo, cfg.Auth.Policy)
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("constructing medication service: %w", err)
 	}
-	medSvc, err := svc.NewService(repo)
+	medSvc = svc.NewInstrumentedService(medSvc, reg)
+	keyRepo, err := apikeypg.NewRepository(db)
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("constructing api key repository: %w", err)
 	}
-	logr, err := logger.NewLogger()
+	keySvc, err := apikey.NewService(keyRepo, cfg.Auth.Policy)
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("constructing api key service: %w", err)
 	}
-	app := medication.NewApp(logr, medSvc)
+
+	authenticators := []mid.Authenticator{mid.APIKeys{Service: keySvc}}
+	if cfg.Auth.TrustProxyHeaders {
+		authenticators = append(authenticators, mid.ProxyHeaders{
+			SubjectHeader: cfg.Auth.SubjectHeader,
+			RolesHeader:   cfg.Auth.RolesHeader,
+		})
+	}
+	r.Use(mid.Route(), mid.Authenticate(authenticators...))
+
+	jobStore, err := catalogpg.NewJobStore(db)
+	if err != nil {
+		return fmt.Errorf("constructing import job store: %w", err)
+	}
+	app := medication.NewApp(medSvc, cfg.Auth.Policy, jobStore)
 	if err := app.RegisterHandlers(r); err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("registering medication handlers: %w", err)
+	}
+
+	checkApp := check.NewApp(build, db, cfg.Web.ReadyTimeout)
+	if err := checkApp.RegisterHandlers(r); err != nil {
+		return fmt.Errorf("registering check handlers: %w", err)
+	}
+	if err := printRoutes(log, r); err != nil {
+		return fmt.Errorf("listing routes: %w", err)
+	}
+
+	apiMid := []mux.MiddlewareFunc{mid.RequestID(), mid.Logger(log), mid.Logging(), mid.Metrics(httpMetrics), mid.Panics()}
+	if cfg.DB.ReadYourWrites {
+		apiMid = append(apiMid, mid.ReadYourWrites(cfg.DB.ReplicationLag))
 	}
-	printRoutes(r)
 
 	api := http.Server{
 		Addr:         cfg.Web.APIHost,
-		Handler:      r,
+		Handler:      mid.Wrap(r, apiMid...),
 		ReadTimeout:  cfg.Web.ReadTimeout,
 		WriteTimeout: cfg.Web.WriteTimeout,
 		IdleTimeout:  cfg.Web.IdleTimeout,
+		ErrorLog:     logger.NewStdLogger(log),
 	}
 
-	serverErrors := make(chan error, 1)
+	debugMux := debug.Mux()
+	debugMux.Handle("/debug/routes", debug.RoutesHandler(r))
+	debugMux.Handle("/metrics", reg.Handler())
+	debugMux.Handle("/debug/loglevel", mid.Wrap(debug.LogLevel(levels),
+		mid.RequestID(), mid.Logger(log), mid.Logging(), mid.Panics(),
+		mid.Authenticate(authenticators...), mid.Authorize(cfg.Auth.Policy, auth.PermLogLevel),
+	))
+
+	debugSrv := http.Server{
+		Addr:         cfg.Web.DebugHost,
+		Handler:      debugMux,
+		ReadTimeout:  cfg.Web.ReadTimeout,
+		WriteTimeout: cfg.Web.DebugWriteTimeout,
+		IdleTimeout:  cfg.Web.IdleTimeout,
+		ErrorLog:     logger.NewStdLogger(log),
+	}
+
+	serverErrors := make(chan error, 2)
 
 	go func() {
-		fmt.Println("startup", "status", "api router started", "host", api.Addr)
+		log.Info("startup", "status", "api router started", "host", api.Addr)
 
 		serverErrors <- api.ListenAndServe()
 	}()
 
-	select {
-	case err := <-serverErrors:
-		return fmt.Errorf("server error: %w", err)
+	go func() {
+		log.Info("startup", "status", "debug router started", "host", debugSrv.Addr)
 
-	case sig := <-shutdown:
-		fmt.Println("shutdown", "status", "shutdown started", "signal", sig)
-		defer fmt.Println("shutdown", "status", "shutdown complete", "signal", sig)
+		if err := debugSrv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			serverErrors <- fmt.Errorf("debug: %w", err)
+		}
+	}()
 
-		ctx, cancel := context.WithTimeout(ctx, cfg.Web.ShutdownTimeout)
-		defer cancel()
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	defer signal.Stop(reload)
 
-		if err := api.Shutdown(ctx); err != nil {
-			api.Close()
-			return fmt.Errorf("could not stop server gracefully: %w", err)
+	for {
+		select {
+		case err := <-serverErrors:
+			return fmt.Errorf("server error: %w", err)
+
+		case <-reload:
+			if err := loadLogLevels(levels, cfg.Log.Level, cfg.Log.Levels, cfg.Log.File); err != nil {
+				log.Error(err, "reload", "status", "log levels not reloaded")
+				continue
+			}
+			log.Info("reload", "status", "log levels reloaded", "levels", levels.Settings())
+
+		case sig := <-shutdown:
+			log.Info("shutdown", "status", "shutdown started", "signal", sig)
+			defer log.Info("shutdown", "status", "shutdown complete", "signal", sig)
+
+			checkApp.Drain()
+			log.Info("shutdown", "status", "draining", "timeout", cfg.Web.DrainTimeout)
+			time.Sleep(cfg.Web.DrainTimeout)
+
+			ctx, cancel := context.WithTimeout(ctx, cfg.Web.ShutdownTimeout)
+			defer cancel()
+
+			if err := debugSrv.Shutdown(ctx); err != nil {
+				debugSrv.Close()
+			}
+
+			if err := api.Shutdown(ctx); err != nil {
+				api.Close()
+				return fmt.Errorf("could not stop server gracefully: %w", err)
+			}
+
+			return nil
 		}
 	}
-
-	return nil
 }
 
-func printRoutes(r *mux.Router) {
-	r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
-		path, err := route.GetPathTemplate()
-		if err != nil {
-			return err
-		}
+// openPool opens the native pool used by the pgxpool driver and waits for
+// the database to answer through it.
+func openPool(ctx context.Context, log logr.Logger, cfg sqldb.Config, timeout time.Duration) (*pgxpool.Pool, error) {
+	log.Info("startup", "status", "initializing native pool", "hostport", cfg.Host)
 
-		methods, err := route.GetMethods()
-		if err != nil {
-			methods = []string{"ANY"}
-		}
+	pool, err := sqldb.OpenPool(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	statusCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if err := sqldb.PoolStatusCheck(statusCtx, pool); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("status check: %w", err)
+	}
+	return pool, nil
+}
 
-		fmt.Printf("Path: %s, Methods: %v\n", path, methods)
+// loadLogLevels resets levels to the configured level and overrides, then
+// applies the settings file when one is configured.
+func loadLogLevels(levels *logger.Levels, level string, named string, file string) error {
+	def, err := logger.ParseLevel(level)
+	if err != nil {
+		return fmt.Errorf("level: %w", err)
+	}
+	overrides, err := logger.ParseNamedLevels(named)
+	if err != nil {
+		return fmt.Errorf("levels: %w", err)
+	}
+
+	if file == "" {
+		levels.Set(def, overrides)
 		return nil
-	})
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("read settings: %w", err)
+	}
+	var s logger.Settings
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("parse settings %s: %w", file, err)
+	}
+
+	levels.Set(def, overrides)
+	return levels.Apply(s)
+}
+
+func printRoutes(log logr.Logger, r *mux.Router) error {
+	routes, err := debug.Routes(r)
+	if err != nil {
+		return err
+	}
+
+	for _, route := range routes {
+		log.Info("startup", "route", route.Path, "methods", route.Methods)
+	}
+	return nil
 }
@@ -0,0 +1,147 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aborilov/hippo/business/apikey"
+	"github.com/aborilov/hippo/business/apikey/model"
+	"github.com/aborilov/hippo/business/apikey/repo/pg"
+	"github.com/aborilov/hippo/business/sdk/auth"
+	"github.com/google/uuid"
+)
+
+// APIKey manages the API keys used by machine clients.
+func APIKey(cfg DBConfig, id Identity, args []string) error {
+	if len(args) == 0 {
+		apiKeyUsage()
+		return ErrHelp
+	}
+
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	repo, err := pg.NewRepository(db)
+	if err != nil {
+		return err
+	}
+	svc, err := apikey.NewService(repo, id.Policy)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(id.context(context.Background()), 10*time.Second)
+	defer cancel()
+
+	switch args[0] {
+	case "create":
+		return apiKeyCreate(ctx, svc, args[1:])
+	case "list":
+		return apiKeyList(ctx, svc)
+	case "revoke":
+		return apiKeyRevoke(ctx, svc, args[1:])
+	default:
+		apiKeyUsage()
+		return ErrHelp
+	}
+}
+
+func apiKeyCreate(ctx context.Context, svc model.Service, args []string) error {
+	fs := flag.NewFlagSet("apikey create", flag.ContinueOnError)
+	name := fs.String("name", "", "name of the client the key is issued to")
+	perms := fs.String("perms", "", "comma separated list of granted permissions")
+	expires := fs.Duration("expires", 0, "lifetime of the key, 0 never expires")
+	if err := fs.Parse(args); err != nil {
+		return ErrHelp
+	}
+
+	nk := model.NewAPIKey{Name: *name}
+	for _, p := range strings.Split(*perms, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			nk.Permissions = append(nk.Permissions, auth.Permission(p))
+		}
+	}
+	if *expires > 0 {
+		t := time.Now().Add(*expires).UTC()
+		nk.ExpiresAt = &t
+	}
+
+	k, key, err := svc.Create(ctx, nk)
+	if err != nil {
+		return fmt.Errorf("create api key: %w", err)
+	}
+
+	fmt.Println("id:  ", k.ID)
+	fmt.Println("key: ", key)
+	fmt.Println("store the key now, it can't be shown again")
+	return nil
+}
+
+func apiKeyList(ctx context.Context, svc model.Service) error {
+	keys, err := svc.List(ctx)
+	if err != nil {
+		return fmt.Errorf("list api keys: %w", err)
+	}
+
+	now := time.Now()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tPREFIX\tPERMISSIONS\tCREATED\tEXPIRES\tLAST USED\tSTATUS")
+	for _, k := range keys {
+		perms := make([]string, len(k.Permissions))
+		for i, p := range k.Permissions {
+			perms[i] = string(p)
+		}
+
+		status := "active"
+		switch {
+		case k.RevokedAt != nil:
+			status = "revoked"
+		case !k.Active(now):
+			status = "expired"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			k.ID, k.Name, k.Prefix, strings.Join(perms, ","),
+			formatTime(&k.CreatedAt), formatTime(k.ExpiresAt), formatTime(k.LastUsedAt), status)
+	}
+	return w.Flush()
+}
+
+func apiKeyRevoke(ctx context.Context, svc model.Service, args []string) error {
+	if len(args) != 1 {
+		apiKeyUsage()
+		return ErrHelp
+	}
+	id, err := uuid.Parse(args[0])
+	if err != nil {
+		return fmt.Errorf("parse api key id: %w", err)
+	}
+
+	if err := svc.Revoke(ctx, id); err != nil {
+		return fmt.Errorf("revoke api key: %w", err)
+	}
+
+	fmt.Println("api key revoked")
+	return nil
+}
+
+func apiKeyUsage() {
+	fmt.Println("apikey create --name <name> --perms <perm,...> [--expires <duration>]")
+	fmt.Println("apikey list")
+	fmt.Println("apikey revoke <id>")
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,18 @@
+package commands
+
+import (
+	"context"
+
+	"github.com/aborilov/hippo/business/sdk/auth"
+)
+
+// Identity is the principal the admin tool acts as and the policy its
+// permissions are checked against.
+type Identity struct {
+	Principal auth.Principal
+	Policy    auth.Policy
+}
+
+func (id Identity) context(ctx context.Context) context.Context {
+	return auth.SetPrincipal(ctx, id.Principal)
+}
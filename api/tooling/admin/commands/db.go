@@ -0,0 +1,41 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aborilov/hippo/business/sdk/sqldb"
+	"github.com/jmoiron/sqlx"
+)
+
+// DBConfig is the database the commands connect to.
+type DBConfig struct {
+	sqldb.Config
+
+	// StartupTimeout is how long commands wait for the database to accept
+	// connections.
+	StartupTimeout time.Duration
+
+	// MigrateTimeout bounds waiting for the migration lock and running or
+	// rolling back migrations.
+	MigrateTimeout time.Duration
+}
+
+// openDB opens the database and waits until it is ready.
+func openDB(cfg DBConfig) (*sqlx.DB, error) {
+	db, err := sqldb.Open(cfg.Config)
+	if err != nil {
+		return nil, fmt.Errorf("connect database: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.StartupTimeout)
+	defer cancel()
+
+	if err := sqldb.StatusCheck(ctx, db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("status check database: %w", err)
+	}
+
+	return db, nil
+}
@@ -0,0 +1,118 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/aborilov/hippo/business/medication"
+	"github.com/aborilov/hippo/business/medication/catalog"
+	"github.com/aborilov/hippo/business/medication/model"
+	"github.com/aborilov/hippo/business/medication/repo/pg"
+	"github.com/aborilov/hippo/business/sdk/sqldb"
+)
+
+// Export writes the medications to a csv, ndjson or xlsx file, or to stdout,
+// streaming them from the database.
+func Export(cfg DBConfig, id Identity, args []string) (err error) {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	out := fs.String("out", "", "file to write, stdout by default")
+	format := fs.String("format", "", "csv, ndjson or xlsx, taken from the --out extension by default")
+	name := fs.String("name", "", "only medications whose name contains this")
+	form := fs.String("form", "", "only medications of this form")
+	prefix := fs.String("external-id-prefix", "", "only medications whose external id starts with this")
+	atc := fs.String("atc", "", "only medications classified under this ATC code")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 {
+		fmt.Println("export [--out <file>] [--format csv|ndjson|xlsx] [--name <text>] [--form <form>] [--external-id-prefix <prefix>] [--atc <code>]")
+		return ErrHelp
+	}
+
+	f := model.Filter{Name: *name, ExternalIDPrefix: *prefix}
+	if *atc != "" {
+		code, err := model.ParseATC(*atc)
+		if err != nil {
+			return err
+		}
+		f.ATC = code
+	}
+	if *form != "" {
+		v, err := model.FormString(*form)
+		if err != nil {
+			return err
+		}
+		f.Form = v
+	}
+
+	fileFormat, err := exportFormat(*format, *out)
+	if err != nil {
+		return err
+	}
+
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	repo, err := pg.NewRepository(sqldb.NewCluster(db), nil)
+	if err != nil {
+		return err
+	}
+	svc, err := medication.NewService(repo, id.Policy)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if errClose := file.Close(); errClose != nil && err == nil {
+				err = fmt.Errorf("close %s: %w", *out, errClose)
+			}
+		}()
+		w = file
+	}
+
+	ctx, cancel := context.WithTimeout(id.context(context.Background()), time.Hour)
+	defer cancel()
+
+	cw, err := catalog.NewWriter(w, fileFormat)
+	if err != nil {
+		return err
+	}
+	var n int
+	err = svc.Export(ctx, f, func(m *model.Medication) error {
+		n++
+		return cw.Write(m)
+	})
+	if err != nil {
+		return fmt.Errorf("export medications: %w", err)
+	}
+	if err := cw.Close(); err != nil {
+		return fmt.Errorf("export medications: %w", err)
+	}
+
+	if *out != "" {
+		fmt.Printf("exported %d medications to %s\n", n, *out)
+	}
+	return nil
+}
+
+// exportFormat returns the format named by the flag, or else the one of the
+// output file, defaulting to csv on stdout.
+func exportFormat(format, out string) (catalog.Format, error) {
+	switch {
+	case format != "":
+		return catalog.ParseFormat(format)
+	case out != "":
+		return catalog.FormatOf(out)
+	}
+	return catalog.FormatCSV, nil
+}
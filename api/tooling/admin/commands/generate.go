@@ -0,0 +1,103 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/aborilov/hippo/business/medication"
+	"github.com/aborilov/hippo/business/medication/model"
+	"github.com/aborilov/hippo/business/medication/repo/pg"
+	"github.com/aborilov/hippo/business/sdk/sqldb"
+)
+
+// generateBatchSize is the number of medications written per BulkCreate
+// call.
+const generateBatchSize = 5000
+
+// Generate writes synthetic medications for load and demo environments, or
+// removes them with --purge.
+func Generate(cfg DBConfig, id Identity, args []string) error {
+	fs := flag.NewFlagSet("generate", flag.ContinueOnError)
+	count := fs.Int("count", 1000, "number of medications to generate")
+	seed := fs.Uint64("seed", 1, "seed of the generator, the same seed yields the same medications and skips those already written")
+	purge := fs.Bool("purge", false, "delete every generated medication instead")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 || *count < 0 {
+		fmt.Println("generate [--count <n>] [--seed <s>]")
+		fmt.Println("generate --purge")
+		return ErrHelp
+	}
+
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	repo, err := pg.NewRepository(sqldb.NewCluster(db), nil)
+	if err != nil {
+		return err
+	}
+	svc, err := medication.NewService(repo, id.Policy)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(id.context(context.Background()), 30*time.Minute)
+	defer cancel()
+
+	if *purge {
+		n, err := svc.Purge(ctx, medication.GeneratedPrefix)
+		if err != nil {
+			return fmt.Errorf("purge generated medications: %w", err)
+		}
+		fmt.Printf("purged %d generated medications\n", n)
+		return nil
+	}
+
+	// Rows are generated in the same order on every run, so the ones an
+	// earlier run already wrote, completely or partially, are skipped.
+	existing := make([]bool, *count)
+	var skipped int
+	f := model.Filter{ExternalIDPrefix: medication.GeneratedSeedPrefix(*seed)}
+	err = svc.Export(ctx, f, func(m *model.Medication) error {
+		if i, ok := medication.GeneratedIndex(*seed, m.ExternalID); ok && i < *count {
+			existing[i] = true
+			skipped++
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("list generated medications: %w", err)
+	}
+
+	start := time.Now()
+	var (
+		total int64
+		next  int
+	)
+	for batch := range medication.Generate(*seed, *count, generateBatchSize) {
+		todo := batch[:0]
+		for i, m := range batch {
+			if !existing[next+i] {
+				todo = append(todo, m)
+			}
+		}
+		next += len(batch)
+		if len(todo) == 0 {
+			continue
+		}
+
+		n, err := svc.BulkCreate(ctx, todo)
+		if err != nil {
+			return fmt.Errorf("write generated medications: %w", err)
+		}
+		total += n
+		fmt.Printf("generated %d/%d medications\n", total, *count-skipped)
+	}
+
+	fmt.Printf("generated %d medications with seed %d in %s, %d already present\n",
+		total, *seed, time.Since(start).Round(time.Millisecond), skipped)
+	return nil
+}
@@ -0,0 +1,91 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aborilov/hippo/business/medication"
+	"github.com/aborilov/hippo/business/medication/catalog"
+	"github.com/aborilov/hippo/business/medication/repo/pg"
+	"github.com/aborilov/hippo/business/sdk/sqldb"
+)
+
+// Import loads the medication catalog from a CSV or NDJSON file. It prints
+// the changes the catalog makes and only writes them with --apply.
+func Import(cfg DBConfig, id Identity, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	file := fs.String("file", "", "catalog file, .csv or .ndjson")
+	format := fs.String("format", "", "csv or ndjson, taken from the file extension by default")
+	mapping := fs.String("map", "", `column to field mapping, such as "Drug Name=name,Strength=dosage"`)
+	scope := fs.String("scope", catalog.DefaultScope, "external id prefix owned by the catalog")
+	apply := fs.Bool("apply", false, "write the changes, in a single transaction")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 || *file == "" {
+		fmt.Println("import --file <catalog> [--format csv|ndjson] [--map <column=field,...>] [--scope <prefix>] [--apply]")
+		return ErrHelp
+	}
+
+	opts := catalog.Options{
+		Scope:  *scope,
+		DryRun: !*apply,
+	}
+	var err error
+	if *format != "" {
+		opts.Format, err = catalog.ParseFormat(*format)
+	} else {
+		opts.Format, err = catalog.FormatOf(*file)
+	}
+	if err != nil {
+		return err
+	}
+	if opts.Mapping, err = catalog.ParseMapping(*mapping); err != nil {
+		return err
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	repo, err := pg.NewRepository(sqldb.NewCluster(db), nil)
+	if err != nil {
+		return err
+	}
+	svc, err := medication.NewService(repo, id.Policy)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(id.context(context.Background()), 10*time.Minute)
+	defer cancel()
+
+	report, err := catalog.Import(ctx, svc, f, opts)
+	if errors.As(err, &catalog.ErrRejected{}) {
+		for _, e := range report.Errors {
+			fmt.Println(e)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("import %s: %w", *file, err)
+	}
+
+	if err := report.Plan.WriteDiff(os.Stdout); err != nil {
+		return err
+	}
+	if report.Applied {
+		fmt.Printf("applied %d rows from %s\n", report.Rows, *file)
+	} else {
+		fmt.Println("dry run, nothing written: run again with --apply to write the changes")
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aborilov/hippo/business/medication"
+	"github.com/aborilov/hippo/business/medication/atc"
+	"github.com/aborilov/hippo/business/medication/repo/pg"
+	"github.com/aborilov/hippo/business/sdk/sqldb"
+)
+
+// ImportATC loads the ATC classification from a local CSV file. It prints a
+// summary and only writes the changes with --apply.
+func ImportATC(cfg DBConfig, id Identity, args []string) error {
+	fs := flag.NewFlagSet("import-atc", flag.ContinueOnError)
+	file := fs.String("file", "", "csv file with atc_code and atc_name columns")
+	apply := fs.Bool("apply", false, "write the changes, in a single transaction")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 || *file == "" {
+		fmt.Println("import-atc --file <atc.csv> [--apply]")
+		return ErrHelp
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	repo, err := pg.NewRepository(sqldb.NewCluster(db), nil)
+	if err != nil {
+		return err
+	}
+	svc, err := medication.NewService(repo, id.Policy)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(id.context(context.Background()), 5*time.Minute)
+	defer cancel()
+
+	sum, err := atc.Import(ctx, svc, f, atc.Options{DryRun: !*apply})
+	if err != nil {
+		return fmt.Errorf("import %s: %w", *file, err)
+	}
+	if err := sum.Write(os.Stdout); err != nil {
+		return err
+	}
+	if !sum.Applied {
+		fmt.Println("dry run, nothing written: run again with --apply to write the changes")
+	}
+	return nil
+}
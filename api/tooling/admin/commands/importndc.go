@@ -0,0 +1,80 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aborilov/hippo/business/medication"
+	"github.com/aborilov/hippo/business/medication/openfda"
+	"github.com/aborilov/hippo/business/medication/repo/pg"
+	"github.com/aborilov/hippo/business/sdk/sqldb"
+)
+
+// ImportNDC loads the FDA NDC directory from an openFDA drug-ndc download.
+// It prints a summary and the changes, and only writes them with --apply.
+func ImportNDC(cfg DBConfig, id Identity, args []string) error {
+	fs := flag.NewFlagSet("import-ndc", flag.ContinueOnError)
+	file := fs.String("file", "", "drug-ndc download, .json or .json.zip")
+	formMap := fs.String("form-map", "", `extra dosage form mappings, such as "LOTION=cream,KIT=tablet"`)
+	prune := fs.Bool("prune", false, "delete imported medications whose product is no longer listed")
+	apply := fs.Bool("apply", false, "write the changes, in a single transaction")
+	verbose := fs.Bool("v", false, "print every change")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 || *file == "" {
+		fmt.Println("import-ndc --file <drug-ndc.json> [--form-map <FDA FORM=form,...>] [--prune] [--apply] [-v]")
+		return ErrHelp
+	}
+
+	forms, err := openfda.ParseFormMap(*formMap)
+	if err != nil {
+		return err
+	}
+
+	f, err := openfda.Open(*file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	db, err := openDB(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	repo, err := pg.NewRepository(sqldb.NewCluster(db), nil)
+	if err != nil {
+		return err
+	}
+	svc, err := medication.NewService(repo, id.Policy)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(id.context(context.Background()), 30*time.Minute)
+	defer cancel()
+
+	sum, err := openfda.Import(ctx, svc, f, openfda.Options{
+		Forms:  forms,
+		Prune:  *prune,
+		DryRun: !*apply,
+	})
+	if err != nil {
+		return fmt.Errorf("import %s: %w", *file, err)
+	}
+
+	if *verbose {
+		if err := sum.Plan.WriteDiff(os.Stdout); err != nil {
+			return err
+		}
+	}
+	if err := sum.Write(os.Stdout); err != nil {
+		return err
+	}
+	if !sum.Applied {
+		fmt.Println("dry run, nothing written: run again with --apply to write the changes")
+	}
+	return nil
+}
@@ -3,27 +3,65 @@ package commands
 import (
 	"context"
 	"errors"
+	"flag"
 	"fmt"
-	"time"
+	"os"
+	"strconv"
+	"text/tabwriter"
 
 	"github.com/aborilov/hippo/business/sdk/migrate"
-	"github.com/aborilov/hippo/business/sdk/sqldb"
+	"github.com/jmoiron/sqlx"
 )
 
 // ErrHelp provides context that help was given.
 var ErrHelp = errors.New("provided help")
 
-// Migrate creates the schema in the database.
-func Migrate(cfg sqldb.Config) error {
-	db, err := sqldb.Open(cfg)
+// Migrate creates the schema in the database, reports on the migrations
+// with the status and plan subcommands, or reverts them with rollback.
+func Migrate(cfg DBConfig, args []string) error {
+	var (
+		sub string
+		to  float64
+	)
+	switch {
+	case len(args) == 0:
+	case len(args) == 1 && (args[0] == "status" || args[0] == "plan"):
+		sub = args[0]
+	case args[0] == "rollback":
+		sub = args[0]
+		fs := flag.NewFlagSet("migrate rollback", flag.ContinueOnError)
+		v := fs.String("to", "", "version to roll back to, 0 reverts every migration")
+		if err := fs.Parse(args[1:]); err != nil || *v == "" || fs.NArg() > 0 {
+			migrateUsage()
+			return ErrHelp
+		}
+		var err error
+		if to, err = strconv.ParseFloat(*v, 64); err != nil {
+			return fmt.Errorf("parse version: %w", err)
+		}
+	default:
+		migrateUsage()
+		return ErrHelp
+	}
+
+	db, err := openDB(cfg)
 	if err != nil {
-		return fmt.Errorf("connect database: %w", err)
+		return err
 	}
 	defer db.Close()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.MigrateTimeout)
 	defer cancel()
 
+	switch sub {
+	case "status":
+		return migrateStatus(ctx, db)
+	case "plan":
+		return migratePlan(ctx, db)
+	case "rollback":
+		return migrateRollback(ctx, db, to)
+	}
+
 	if err := migrate.Migrate(ctx, db); err != nil {
 		return fmt.Errorf("migrate database: %w", err)
 	}
@@ -31,3 +69,80 @@ func Migrate(cfg sqldb.Config) error {
 	fmt.Println("migrations complete")
 	return nil
 }
+
+func migrateStatus(ctx context.Context, db *sqlx.DB) error {
+	migs, err := migrate.Status(ctx, db)
+	if err != nil {
+		return fmt.Errorf("migration status: %w", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tDESCRIPTION\tAPPLIED\tCHECKSUM\tREVERSIBLE")
+	for _, m := range migs {
+		applied, checksum := "-", "pending"
+		if m.Applied {
+			applied = formatTime(&m.AppliedAt)
+			checksum = "ok"
+		}
+		if m.Drifted() {
+			checksum = "DRIFTED"
+		}
+		reversible := "yes"
+		if m.Down == "" {
+			reversible = "no"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", formatVersion(m.Version), m.Description, applied, checksum, reversible)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	return migrate.Verify(ctx, db)
+}
+
+func migratePlan(ctx context.Context, db *sqlx.DB) error {
+	if err := migrate.Verify(ctx, db); err != nil {
+		return err
+	}
+
+	migs, err := migrate.Plan(ctx, db)
+	if err != nil {
+		return fmt.Errorf("migration plan: %w", err)
+	}
+	if len(migs) == 0 {
+		fmt.Println("-- database is up to date")
+		return nil
+	}
+
+	for _, m := range migs {
+		fmt.Printf("-- Version: %s\n-- Description: %s\n%s\n\n", formatVersion(m.Version), m.Description, m.Script)
+	}
+	return nil
+}
+
+func migrateRollback(ctx context.Context, db *sqlx.DB, to float64) error {
+	migs, err := migrate.Rollback(ctx, db, to)
+	if err != nil {
+		return fmt.Errorf("roll back migrations: %w", err)
+	}
+	if len(migs) == 0 {
+		fmt.Println("nothing to roll back")
+		return nil
+	}
+
+	for _, m := range migs {
+		fmt.Printf("rolled back %s: %s\n", formatVersion(m.Version), m.Description)
+	}
+	return nil
+}
+
+func migrateUsage() {
+	fmt.Println("migrate         apply the pending migrations")
+	fmt.Println("migrate status  list the migrations and whether they were applied")
+	fmt.Println("migrate plan    print the SQL of the pending migrations without running it")
+	fmt.Println("migrate rollback --to <version>  revert the migrations applied after version")
+}
+
+func formatVersion(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
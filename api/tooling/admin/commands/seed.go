@@ -2,25 +2,50 @@ package commands
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"time"
 
-	"github.com/aborilov/hippo/business/sdk/migrate"
+	"github.com/aborilov/hippo/business/medication"
+	"github.com/aborilov/hippo/business/medication/repo/pg"
+	"github.com/aborilov/hippo/business/sdk/fixture"
 	"github.com/aborilov/hippo/business/sdk/sqldb"
 )
 
-// Seed loads test data into the database.
-func Seed(cfg sqldb.Config) error {
-	db, err := sqldb.Open(cfg)
+// Seed loads the fixtures of an environment into the database. Fixtures are
+// upserted by their stable key, so seeding can be repeated.
+func Seed(cfg DBConfig, id Identity, args []string) error {
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	env := fs.String("env", "dev", "environment whose fixtures are loaded: dev, demo or test")
+	dir := fs.String("dir", "./fixtures", "directory holding one fixture directory per environment")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 {
+		fmt.Println("seed [--env <env>] [--dir <dir>]")
+		return ErrHelp
+	}
+
+	db, err := openDB(cfg)
 	if err != nil {
-		return fmt.Errorf("connect database: %w", err)
+		return err
 	}
 	defer db.Close()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	repo, err := pg.NewRepository(sqldb.NewCluster(db), nil)
+	if err != nil {
+		return err
+	}
+	svc, err := medication.NewService(repo, id.Policy)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(id.context(context.Background()), time.Minute)
 	defer cancel()
 
-	if err := migrate.Seed(ctx, db); err != nil {
+	results, err := fixture.Load(ctx, *dir, *env, medication.NewFixtureLoader(svc))
+	for _, r := range results {
+		fmt.Printf("loaded %d fixtures from %s\n", r.Count, r.File)
+	}
+	if err != nil {
 		return fmt.Errorf("seed database: %w", err)
 	}
 
@@ -4,9 +4,12 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/aborilov/hippo/api/tooling/admin/commands"
+	"github.com/aborilov/hippo/business/sdk/auth"
 	"github.com/aborilov/hippo/business/sdk/sqldb"
+	"github.com/aborilov/hippo/foundation/logger"
 	"github.com/ardanlabs/conf/v3"
 )
 
@@ -22,7 +25,21 @@ type config struct {
 		Name         string `conf:"default:postgres"`
 		MaxIdleConns int    `conf:"default:0"`
 		MaxOpenConns int    `conf:"default:0"`
-		DisableTLS   bool   `conf:"default:true"`
+
+		SSLMode          string        `conf:"default:disable,help:disable allow prefer require verify-ca or verify-full"`
+		DisableTLS       string        `conf:"help:deprecated alias of ssl-mode where false means require"`
+		SSLRootCert      string        `conf:"help:CA bundle used to verify the server"`
+		SSLCert          string        `conf:"help:client certificate"`
+		SSLKey           string        `conf:"help:client certificate key"`
+		ConnectTimeout   time.Duration `conf:"default:10s"`
+		StatementTimeout time.Duration `conf:"default:0s,help:zero leaves long migrations unbounded"`
+		StartupTimeout   time.Duration `conf:"default:60s,help:time to wait for the database to accept connections"`
+		MigrateTimeout   time.Duration `conf:"default:5m,help:time to wait for the migration lock and run migrations"`
+	}
+	Auth struct {
+		Subject string      `conf:"default:admin-cli"`
+		Roles   []auth.Role `conf:"default:admin"`
+		Policy  auth.Policy `conf:"default:viewer=medication:read;pharmacist=medication:read|medication:write;admin=*"`
 	}
 }
 
@@ -60,44 +77,112 @@ func run() error {
 		return fmt.Errorf("parsing config: %w", err)
 	}
 
+	log, err := logger.NewLogger()
+	if err != nil {
+		return fmt.Errorf("constructing logger: %w", err)
+	}
+	logger.SetDefault(log.WithValues("service", "admin"))
+
 	return processCommands(cfg.Args, cfg)
 }
 
 // processCommands handles the execution of the commands specified on
 // the command line.
 func processCommands(args conf.Args, cfg config) error {
-	dbConfig := sqldb.Config{
-		User:         cfg.DB.User,
-		Password:     cfg.DB.Password,
-		Host:         cfg.DB.Host,
-		Name:         cfg.DB.Name,
-		MaxIdleConns: cfg.DB.MaxIdleConns,
-		MaxOpenConns: cfg.DB.MaxOpenConns,
-		DisableTLS:   cfg.DB.DisableTLS,
+	sslMode, err := sqldb.LegacySSLMode(cfg.DB.SSLMode, cfg.DB.DisableTLS)
+	if err != nil {
+		return fmt.Errorf("db config: %w", err)
+	}
+	if cfg.DB.DisableTLS != "" {
+		logger.Default().Info("HIPPO_DB_DISABLE_TLS is deprecated, use HIPPO_DB_SSL_MODE", "sslmode", sslMode)
+	}
+
+	dbConfig := commands.DBConfig{
+		Config: sqldb.Config{
+			User:         cfg.DB.User,
+			Password:     cfg.DB.Password,
+			Host:         cfg.DB.Host,
+			Name:         cfg.DB.Name,
+			MaxIdleConns: cfg.DB.MaxIdleConns,
+			MaxOpenConns: cfg.DB.MaxOpenConns,
+
+			SSLMode:          sslMode,
+			SSLRootCert:      cfg.DB.SSLRootCert,
+			SSLCert:          cfg.DB.SSLCert,
+			SSLKey:           cfg.DB.SSLKey,
+			ConnectTimeout:   cfg.DB.ConnectTimeout,
+			StatementTimeout: cfg.DB.StatementTimeout,
+		},
+		StartupTimeout: cfg.DB.StartupTimeout,
+		MigrateTimeout: cfg.DB.MigrateTimeout,
+	}
+
+	id := commands.Identity{
+		Principal: auth.Principal{
+			Subject: cfg.Auth.Subject,
+			Roles:   cfg.Auth.Roles,
+		},
+		Policy: cfg.Auth.Policy,
 	}
 
 	switch args.Num(0) {
 	case "migrate":
-		if err := commands.Migrate(dbConfig); err != nil {
+		if err := commands.Migrate(dbConfig, args[1:]); err != nil {
 			return fmt.Errorf("migrating database: %w", err)
 		}
 
 	case "seed":
-		if err := commands.Seed(dbConfig); err != nil {
+		if err := commands.Seed(dbConfig, id, args[1:]); err != nil {
 			return fmt.Errorf("seeding database: %w", err)
 		}
 
 	case "migrate-seed":
-		if err := commands.Migrate(dbConfig); err != nil {
+		if err := commands.Migrate(dbConfig, nil); err != nil {
 			return fmt.Errorf("migrating database: %w", err)
 		}
-		if err := commands.Seed(dbConfig); err != nil {
+		if err := commands.Seed(dbConfig, id, args[1:]); err != nil {
 			return fmt.Errorf("seeding database: %w", err)
 		}
 
+	case "generate":
+		if err := commands.Generate(dbConfig, id, args[1:]); err != nil {
+			return fmt.Errorf("generating data: %w", err)
+		}
+
+	case "import":
+		if err := commands.Import(dbConfig, id, args[1:]); err != nil {
+			return fmt.Errorf("importing catalog: %w", err)
+		}
+
+	case "import-ndc":
+		if err := commands.ImportNDC(dbConfig, id, args[1:]); err != nil {
+			return fmt.Errorf("importing ndc directory: %w", err)
+		}
+
+	case "import-atc":
+		if err := commands.ImportATC(dbConfig, id, args[1:]); err != nil {
+			return fmt.Errorf("importing atc classification: %w", err)
+		}
+
+	case "export":
+		if err := commands.Export(dbConfig, id, args[1:]); err != nil {
+			return fmt.Errorf("exporting catalog: %w", err)
+		}
+
+	case "apikey":
+		if err := commands.APIKey(dbConfig, id, args[1:]); err != nil {
+			return fmt.Errorf("managing api keys: %w", err)
+		}
+
 	default:
-		fmt.Println("migrate:    create the schema in the database")
-		fmt.Println("seed:       add data to the database")
+		fmt.Println("migrate:    create the schema in the database, or show its status and plan")
+		fmt.Println("seed:       load the fixtures of an environment")
+		fmt.Println("generate:   write or purge synthetic medications")
+		fmt.Println("import:     diff or apply a medication catalog from a csv or ndjson file")
+		fmt.Println("import-ndc: diff or apply the FDA NDC directory from an openFDA drug-ndc download")
+		fmt.Println("import-atc: diff or apply the ATC classification from a csv file")
+		fmt.Println("export:     write the medications to a csv, ndjson or xlsx file")
+		fmt.Println("apikey:     create, list and revoke api keys")
 		fmt.Println("provide a command to get more help.")
 		return commands.ErrHelp
 	}
@@ -0,0 +1,123 @@
+// Package check provides the liveness and readiness endpoints used by the
+// orchestrator and the load balancer.
+package check
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/aborilov/hippo/api/sdk/http/response"
+	"github.com/aborilov/hippo/business/sdk/migrate"
+	"github.com/gorilla/mux"
+	"github.com/jmoiron/sqlx"
+)
+
+// Check statuses.
+const (
+	statusOK       = "ok"
+	statusUp       = "up"
+	statusDraining = "draining"
+	statusFailed   = "failed"
+)
+
+type App struct {
+	build    string
+	db       *sqlx.DB
+	timeout  time.Duration
+	draining atomic.Bool
+}
+
+// NewApp returns the check endpoints. Readiness checks against the database
+// give up after timeout.
+func NewApp(build string, db *sqlx.DB, timeout time.Duration) *App {
+	return &App{
+		build:   build,
+		db:      db,
+		timeout: timeout,
+	}
+}
+
+func (app *App) RegisterHandlers(router *mux.Router) error {
+	router.Path("/liveness").Methods("GET").HandlerFunc(app.Liveness)
+	router.Path("/readiness").Methods("GET").HandlerFunc(app.Readiness)
+	return nil
+}
+
+// Drain makes readiness fail so the load balancer stops routing traffic
+// to this instance before it shuts down.
+func (app *App) Drain() {
+	app.draining.Store(true)
+}
+
+type liveness struct {
+	Status     string `json:"status"`
+	Build      string `json:"build"`
+	Host       string `json:"host"`
+	PID        int    `json:"pid"`
+	GOMAXPROCS int    `json:"gomaxprocs"`
+	Goroutines int    `json:"goroutines"`
+}
+
+// Liveness reports that the process is up together with build information.
+func (app *App) Liveness(w http.ResponseWriter, r *http.Request) {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unavailable"
+	}
+
+	response.WriteJSON(w, r, liveness{
+		Status:     statusUp,
+		Build:      app.build,
+		Host:       host,
+		PID:        os.Getpid(),
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		Goroutines: runtime.NumGoroutine(),
+	})
+}
+
+type readiness struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// Readiness reports whether the instance can serve traffic: it is not
+// draining, the database answers and its schema is at the version the
+// binary expects.
+func (app *App) Readiness(w http.ResponseWriter, r *http.Request) {
+	rv := readiness{Status: statusOK, Checks: map[string]string{}}
+
+	if app.draining.Load() {
+		rv.Status = statusDraining
+		response.WriteJSONWithStatus(w, http.StatusServiceUnavailable, rv)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), app.timeout)
+	defer cancel()
+
+	// the version query doubles as the database ping
+	applied, err := migrate.AppliedVersion(ctx, app.db)
+	switch expected := migrate.ExpectedVersion(); {
+	case err != nil:
+		rv.Status = statusFailed
+		rv.Checks["database"] = err.Error()
+	case applied != expected:
+		rv.Status = statusFailed
+		rv.Checks["database"] = statusOK
+		rv.Checks["migrations"] = fmt.Sprintf("schema version %v, expected %v", applied, expected)
+	default:
+		rv.Checks["database"] = statusOK
+		rv.Checks["migrations"] = statusOK
+	}
+
+	if rv.Status != statusOK {
+		response.WriteJSONWithStatus(w, http.StatusServiceUnavailable, rv)
+		return
+	}
+	response.WriteJSON(w, r, rv)
+}
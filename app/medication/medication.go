@@ -4,39 +4,74 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	httpErrors "github.com/aborilov/hippo/api/sdk/http/errors"
 	"github.com/aborilov/hippo/api/sdk/http/response"
+	"github.com/aborilov/hippo/business/medication/catalog"
 	"github.com/aborilov/hippo/business/medication/model"
-	"github.com/go-logr/logr"
+	"github.com/aborilov/hippo/business/sdk/auth"
+	"github.com/aborilov/hippo/foundation/logger"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
+const logName = "medication.app"
+
+// maxCatalogSize is the largest catalog accepted by Import.
+const maxCatalogSize = 32 << 20
+
+// exportWriteTimeout bounds each write of an export, which replaces the
+// server write timeout for the whole response so large exports can stream
+// for as long as the client keeps reading.
+const exportWriteTimeout = 30 * time.Second
+
 type App struct {
 	service model.Service
-	log     logr.Logger
+	imports *catalog.Jobs
 }
 
-func NewApp(log logr.Logger, svc model.Service) *App {
+func NewApp(svc model.Service, authz auth.Authorizer, jobs catalog.JobStore) *App {
 	return &App{
 		service: svc,
-		log:     log,
+		imports: catalog.NewJobs(authz, jobs),
 	}
 }
 
 func (app *App) RegisterHandlers(router *mux.Router) error {
+	// scanners of the receiving and dispensing workflows post to the root
+	router.Path("/scan").Methods("POST").HandlerFunc(app.Scan)
+
 	subrouter := router.PathPrefix("/medication").Subrouter()
 
 	subrouter.Path("/").Methods("GET").HandlerFunc(app.List)
+	subrouter.Path("/export").Methods("GET").HandlerFunc(app.Export)
+	subrouter.Path("/lookup").Methods("GET").HandlerFunc(app.Lookup)
+	subrouter.Path("/atc").Methods("GET").HandlerFunc(app.ATC)
+	subrouter.Path("/atc/{code}").Methods("GET").HandlerFunc(app.ATC)
+	subrouter.Path("/atc/{code}/medications").Methods("GET").HandlerFunc(app.ATCMedications)
 	subrouter.Path("/{id}").Methods("GET").HandlerFunc(app.Get)
 	subrouter.Path("/{id}").Methods("DELETE").HandlerFunc(app.Delete)
 	subrouter.Path("/").Methods("POST").HandlerFunc(app.Create)
 	subrouter.Path("/{id}").Methods("PUT").HandlerFunc(app.Update)
+	subrouter.Path("/{id}/codes").Methods("GET").HandlerFunc(app.Codes)
+	subrouter.Path("/{id}/codes").Methods("PUT").HandlerFunc(app.SetCodes)
+	subrouter.Path("/{id}/atc").Methods("GET").HandlerFunc(app.Classification)
+	subrouter.Path("/{id}/atc").Methods("PUT").HandlerFunc(app.SetClassification)
+	subrouter.Path("/external/{external_id}").Methods("PUT").HandlerFunc(app.Upsert)
+	subrouter.Path("/import").Methods("POST").HandlerFunc(app.Import)
+	subrouter.Path("/import/{job_id}").Methods("GET").HandlerFunc(app.ImportStatus)
 	return nil
 }
 
+// Update replaces the medication with the body. Fields left out of the body
+// are stored empty, except the external id which is kept unless the body
+// sets a new one.
 func (app *App) Update(w http.ResponseWriter, r *http.Request) {
 	idStr, ok := mux.Vars(r)["id"]
 	if !ok {
@@ -48,15 +83,6 @@ func (app *App) Update(w http.ResponseWriter, r *http.Request) {
 		httpErrors.BadRequest(w, fmt.Sprintf("unable to parse id: %s", err))
 		return
 	}
-	_, err = app.service.Get(r.Context(), id)
-	if err != nil {
-		if errors.As(err, &model.ErrNotFound{}) {
-			httpErrors.NotFound(w, err.Error())
-			return
-		}
-		httpErrors.Internal(w, "unable to get medication", err)
-		return
-	}
 	decoder := json.NewDecoder(r.Body)
 	m := Medication{}
 	if err := decoder.Decode(&m); err != nil {
@@ -65,18 +91,19 @@ func (app *App) Update(w http.ResponseWriter, r *http.Request) {
 	}
 	s, err := m.ToService()
 	if err != nil {
-		httpErrors.Internal(w, "can't convert to service model", err)
+		httpErrors.Internal(w, r, "can't convert to service model", err)
 		return
 	}
-	// force id from path
+	// force id from path; an empty external id keeps the stored one
 	s.ID = id
 	n, err := app.service.Update(r.Context(), s)
 	if err != nil {
-		httpErrors.Internal(w, "unable to update medication", err)
+		serviceError(w, r, "unable to update medication", err)
 		return
 	}
+	logger.FromContext(r.Context()).WithName(logName).Info("medication updated", "id", n.ID)
 	rv := serviceToMedication(n)
-	response.WriteJSON(w, rv)
+	response.WriteJSON(w, r, rv)
 }
 
 func (app *App) Create(w http.ResponseWriter, r *http.Request) {
@@ -88,29 +115,133 @@ func (app *App) Create(w http.ResponseWriter, r *http.Request) {
 	}
 	s, err := m.ToService()
 	if err != nil {
-		httpErrors.Internal(w, "can't convert to service model", err)
+		httpErrors.Internal(w, r, "can't convert to service model", err)
 		return
 	}
 	n, err := app.service.Create(r.Context(), s)
 	if err != nil {
-		httpErrors.Internal(w, "unable to create medication", err)
+		serviceError(w, r, "unable to create medication", err)
 		return
 	}
+	logger.FromContext(r.Context()).WithName(logName).Info("medication created", "id", n.ID)
 	rv := serviceToMedication(n)
-	response.WriteJSON(w, rv)
+	response.WriteJSON(w, r, rv)
+}
+
+// Upsert creates or updates the medication identified by the external id in
+// the path, which lets sync jobs push the same record repeatedly.
+func (app *App) Upsert(w http.ResponseWriter, r *http.Request) {
+	externalID := mux.Vars(r)["external_id"]
+	decoder := json.NewDecoder(r.Body)
+	m := Medication{}
+	if err := decoder.Decode(&m); err != nil {
+		httpErrors.BadRequest(w, "Invalid JSON request body")
+		return
+	}
+	s, err := m.ToService()
+	if err != nil {
+		httpErrors.Internal(w, r, "can't convert to service model", err)
+		return
+	}
+	// force external id from path
+	s.ExternalID = externalID
+	n, err := app.service.Upsert(r.Context(), s)
+	if err != nil {
+		serviceError(w, r, "unable to upsert medication", err)
+		return
+	}
+	logger.FromContext(r.Context()).WithName(logName).Info("medication upserted", "id", n.ID, "external_id", n.ExternalID)
+	response.WriteJSON(w, r, serviceToMedication(n))
 }
 
 func (app *App) List(w http.ResponseWriter, r *http.Request) {
-	mm, err := app.service.List(r.Context())
+	f, err := parseFilter(r)
+	if err != nil {
+		httpErrors.BadRequest(w, err.Error())
+		return
+	}
+	mm, err := app.service.List(r.Context(), f)
 	if err != nil {
-		httpErrors.Internal(w, "unable to list medications", err)
+		serviceError(w, r, "unable to list medications", err)
 		return
 	}
 	meds := []*Medication{}
 	for _, m := range mm {
 		meds = append(meds, serviceToMedication(m))
 	}
-	response.WriteJSON(w, meds)
+	response.WriteJSON(w, r, meds)
+}
+
+// Export streams the medications matching the List filters as a csv, ndjson
+// or xlsx download. Rows are written as they are read from the database, so
+// the export is not bound by memory or by the server write timeout.
+func (app *App) Export(w http.ResponseWriter, r *http.Request) {
+	f, err := parseFilter(r)
+	if err != nil {
+		httpErrors.BadRequest(w, err.Error())
+		return
+	}
+	format := catalog.FormatCSV
+	if v := r.URL.Query().Get("format"); v != "" {
+		if format, err = catalog.ParseFormat(v); err != nil {
+			httpErrors.BadRequest(w, err.Error())
+			return
+		}
+	}
+
+	// the writer is only created with the first row, so errors raised
+	// before anything is streamed still get a proper error response
+	var cw catalog.Writer
+	start := func() (err error) {
+		w.Header().Set("Content-Type", format.MediaType())
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="medications.%s"`, format))
+		dw := deadlineWriter{w: w, rc: http.NewResponseController(w), timeout: exportWriteTimeout}
+		cw, err = catalog.NewWriter(dw, format)
+		return err
+	}
+
+	var n int
+	err = app.service.Export(r.Context(), f, func(m *model.Medication) error {
+		if cw == nil {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		n++
+		return cw.Write(m)
+	})
+	if err == nil && cw == nil {
+		err = start()
+	}
+	if err == nil {
+		err = cw.Close()
+	}
+	log := logger.FromContext(r.Context()).WithName(logName)
+	switch {
+	case err != nil && cw == nil:
+		serviceError(w, r, "unable to export medications", err)
+	case err != nil:
+		// the response is under way, so the only way to tell the client
+		// the file is truncated is to drop the connection
+		log.Error(err, "medication export aborted", "format", format, "rows", n)
+		panic(http.ErrAbortHandler)
+	default:
+		log.Info("medications exported", "format", format, "rows", n)
+	}
+}
+
+// deadlineWriter moves the write deadline of a response forward before every
+// write, so a response fails when the client stops reading rather than after
+// a fixed time.
+type deadlineWriter struct {
+	w       http.ResponseWriter
+	rc      *http.ResponseController
+	timeout time.Duration
+}
+
+func (dw deadlineWriter) Write(p []byte) (int, error) {
+	_ = dw.rc.SetWriteDeadline(time.Now().Add(dw.timeout))
+	return dw.w.Write(p)
 }
 
 func (app *App) Delete(w http.ResponseWriter, r *http.Request) {
@@ -125,9 +256,10 @@ func (app *App) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if err := app.service.Delete(r.Context(), id); err != nil {
-		httpErrors.Internal(w, "unable to get medication", err)
+		serviceError(w, r, "unable to delete medication", err)
 		return
 	}
+	logger.FromContext(r.Context()).WithName(logName).Info("medication deleted", "id", id)
 
 	response.WriteJSONWithStatus(w, http.StatusNoContent, nil)
 }
@@ -145,13 +277,285 @@ func (app *App) Get(w http.ResponseWriter, r *http.Request) {
 	}
 	m, err := app.service.Get(r.Context(), id)
 	if err != nil {
-		if errors.As(err, &model.ErrNotFound{}) {
-			httpErrors.NotFound(w, err.Error())
+		serviceError(w, r, "unable to get medication", err)
+		return
+	}
+
+	response.WriteJSON(w, r, serviceToMedication(m))
+}
+
+// Lookup resolves the code in the code query parameter, as scanned from a
+// package barcode or typed in, to the medication it belongs to.
+func (app *App) Lookup(w http.ResponseWriter, r *http.Request) {
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		httpErrors.BadRequest(w, "the code query parameter is required")
+		return
+	}
+	m, matched, err := app.service.Lookup(r.Context(), code)
+	if err != nil {
+		serviceError(w, r, "unable to look up medication", err)
+		return
+	}
+	response.WriteJSON(w, r, Lookup{
+		Medication: serviceToMedication(m),
+		Matched:    serviceToCode(matched),
+	})
+}
+
+// Scan decodes the GS1 element string a scanner read from a package, such as
+// a DataMatrix with the GTIN, expiry, lot and serial, and answers with the
+// decoded package and its medication.
+func (app *App) Scan(w http.ResponseWriter, r *http.Request) {
+	var req ScanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpErrors.BadRequest(w, "Invalid JSON request body")
+		return
+	}
+	if req.Data == "" {
+		httpErrors.BadRequest(w, "data is required")
+		return
+	}
+	m, p, err := app.service.Scan(r.Context(), req.Data)
+	if err != nil {
+		serviceError(w, r, "unable to scan package", err)
+		return
+	}
+	response.WriteJSON(w, r, serviceToScan(m, p, time.Now()))
+}
+
+func (app *App) Codes(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		httpErrors.BadRequest(w, fmt.Sprintf("unable to parse id: %s", err))
+		return
+	}
+	codes, err := app.service.Codes(r.Context(), id)
+	if err != nil {
+		serviceError(w, r, "unable to get medication codes", err)
+		return
+	}
+	response.WriteJSON(w, r, serviceToCodes(codes))
+}
+
+// SetCodes replaces the codes of a medication with the list in the request
+// body and answers with the codes as stored.
+func (app *App) SetCodes(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		httpErrors.BadRequest(w, fmt.Sprintf("unable to parse id: %s", err))
+		return
+	}
+	var cc []Code
+	if err := json.NewDecoder(r.Body).Decode(&cc); err != nil {
+		httpErrors.BadRequest(w, "Invalid JSON request body")
+		return
+	}
+	codes := make([]model.Code, 0, len(cc))
+	for _, c := range cc {
+		codes = append(codes, c.ToService())
+	}
+	codes, err = app.service.SetCodes(r.Context(), id, codes)
+	if err != nil {
+		serviceError(w, r, "unable to set medication codes", err)
+		return
+	}
+	logger.FromContext(r.Context()).WithName(logName).Info("medication codes set", "id", id, "codes", len(codes))
+	response.WriteJSON(w, r, serviceToCodes(codes))
+}
+
+// ATC browses the ATC classification: the class in the path with the
+// classes above and below it, or the anatomical main groups without one.
+func (app *App) ATC(w http.ResponseWriter, r *http.Request) {
+	node, err := app.service.ATCNode(r.Context(), mux.Vars(r)["code"])
+	if err != nil {
+		serviceError(w, r, "unable to get atc class", err)
+		return
+	}
+	response.WriteJSON(w, r, serviceToATCNode(node))
+}
+
+// ATCMedications lists the medications classified under the class in the
+// path, at any level below it. It takes the List filters too.
+func (app *App) ATCMedications(w http.ResponseWriter, r *http.Request) {
+	f, err := parseFilter(r)
+	if err != nil {
+		httpErrors.BadRequest(w, err.Error())
+		return
+	}
+	node, err := app.service.ATCNode(r.Context(), mux.Vars(r)["code"])
+	if err != nil {
+		serviceError(w, r, "unable to get atc class", err)
+		return
+	}
+	f.ATC = node.Class.Code
+	mm, err := app.service.List(r.Context(), f)
+	if err != nil {
+		serviceError(w, r, "unable to list medications", err)
+		return
+	}
+	meds := []*Medication{}
+	for _, m := range mm {
+		meds = append(meds, serviceToMedication(m))
+	}
+	response.WriteJSON(w, r, meds)
+}
+
+func (app *App) Classification(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		httpErrors.BadRequest(w, fmt.Sprintf("unable to parse id: %s", err))
+		return
+	}
+	classes, err := app.service.Classification(r.Context(), id)
+	if err != nil {
+		serviceError(w, r, "unable to get medication classification", err)
+		return
+	}
+	response.WriteJSON(w, r, serviceToATCs(classes))
+}
+
+// SetClassification replaces the ATC classes of a medication with the list
+// of codes in the request body.
+func (app *App) SetClassification(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		httpErrors.BadRequest(w, fmt.Sprintf("unable to parse id: %s", err))
+		return
+	}
+	var codes []string
+	if err := json.NewDecoder(r.Body).Decode(&codes); err != nil {
+		httpErrors.BadRequest(w, "Invalid JSON request body")
+		return
+	}
+	classes, err := app.service.SetClassification(r.Context(), id, codes)
+	if err != nil {
+		serviceError(w, r, "unable to set medication classification", err)
+		return
+	}
+	logger.FromContext(r.Context()).WithName(logName).Info("medication classification set", "id", id, "classes", len(classes))
+	response.WriteJSON(w, r, serviceToATCs(classes))
+}
+
+// Import starts a background import of the catalog in the request body and
+// answers with the job to poll. The format is taken from the format query
+// parameter or the content type; scope, map and dry_run match the options of
+// the admin import command.
+func (app *App) Import(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	opts := catalog.Options{
+		Scope: q.Get("scope"),
+	}
+
+	var err error
+	if format := q.Get("format"); format != "" {
+		opts.Format, err = catalog.ParseFormat(format)
+	} else {
+		opts.Format, err = catalogFormat(r.Header.Get("Content-Type"))
+	}
+	if err != nil {
+		httpErrors.BadRequest(w, err.Error())
+		return
+	}
+	if opts.Mapping, err = catalog.ParseMapping(q.Get("map")); err != nil {
+		httpErrors.BadRequest(w, err.Error())
+		return
+	}
+	if v := q.Get("dry_run"); v != "" {
+		if opts.DryRun, err = strconv.ParseBool(v); err != nil {
+			httpErrors.BadRequest(w, fmt.Sprintf("unable to parse dry_run: %s", err))
 			return
 		}
-		httpErrors.Internal(w, "unable to get medication", err)
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxCatalogSize))
+	if err != nil {
+		httpErrors.BadRequest(w, fmt.Sprintf("unable to read catalog: %s", err))
+		return
+	}
+
+	job, err := app.imports.Start(r.Context(), app.service, data, opts)
+	if errors.Is(err, catalog.ErrTooManyJobs) {
+		httpErrors.TooMany(w, err.Error())
+		return
+	}
+	if err != nil {
+		serviceError(w, r, "unable to start catalog import", err)
 		return
 	}
+	logger.FromContext(r.Context()).WithName(logName).Info("catalog import started", "import_job", job.ID, "bytes", len(data), "dry_run", opts.DryRun)
+
+	w.Header().Set("Location", r.URL.Path+"/"+job.ID.String())
+	response.WriteJSONWithStatus(w, http.StatusAccepted, jobToImportJob(job))
+}
 
-	response.WriteJSON(w, serviceToMedication(m))
+// ImportStatus reports a catalog import started by the caller.
+func (app *App) ImportStatus(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(mux.Vars(r)["job_id"])
+	if err != nil {
+		httpErrors.BadRequest(w, fmt.Sprintf("unable to parse job id: %s", err))
+		return
+	}
+	job, err := app.imports.Get(r.Context(), id)
+	if err != nil && !errors.Is(err, catalog.ErrJobNotFound) {
+		httpErrors.Internal(w, r, "unable to get import job", err)
+		return
+	}
+	pr, _ := auth.GetPrincipal(r.Context())
+	if err != nil || job.Owner != pr.ID() {
+		httpErrors.NotFound(w, fmt.Sprintf("import job not found (ID: %s)", id))
+		return
+	}
+	response.WriteJSON(w, r, jobToImportJob(job))
+}
+
+// parseFilter reads the List filters from the query: name, form,
+// external_id_prefix and atc.
+func parseFilter(r *http.Request) (model.Filter, error) {
+	q := r.URL.Query()
+	f := model.Filter{
+		Name:             q.Get("name"),
+		ExternalIDPrefix: q.Get("external_id_prefix"),
+		ATC:              strings.ToUpper(strings.TrimSpace(q.Get("atc"))),
+	}
+	if v := q.Get("form"); v != "" {
+		form, err := model.FormString(v)
+		if err != nil {
+			return f, fmt.Errorf("unable to parse form: %s", err)
+		}
+		f.Form = form
+	}
+	return f, nil
+}
+
+// catalogFormat returns the catalog format of a content type.
+func catalogFormat(contentType string) (catalog.Format, error) {
+	mt, _, _ := mime.ParseMediaType(contentType)
+	switch mt {
+	case "text/csv":
+		return catalog.FormatCSV, nil
+	case "application/x-ndjson", "application/jsonl":
+		return catalog.FormatNDJSON, nil
+	}
+	return "", fmt.Errorf("unable to tell the catalog format of %q, set the format parameter to csv or ndjson", contentType)
+}
+
+// serviceError writes the API error matching an error returned by the service.
+func serviceError(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	var forbidden auth.ErrForbidden
+	switch {
+	case errors.As(err, &model.ErrNotFound{}), errors.As(err, &model.ErrCodeNotFound{}), errors.As(err, &model.ErrATCNotFound{}):
+		httpErrors.NotFound(w, err.Error())
+	case errors.As(err, &model.ErrExternalIDConflict{}), errors.As(err, &model.ErrCodeConflict{}), errors.As(err, &model.ErrCodeAmbiguous{}),
+		errors.As(err, &model.ErrScopeChanged{}):
+		httpErrors.Conflict(w, err.Error())
+	case errors.Is(err, model.ErrExternalIDRequired), errors.As(err, &model.ErrInvalid{}):
+		httpErrors.BadRequest(w, err.Error())
+	case errors.Is(err, auth.ErrUnauthenticated):
+		httpErrors.Unauthorized(w, "authentication required")
+	case errors.As(err, &forbidden):
+		httpErrors.Forbidden(w, forbidden.DetailCode(), forbidden.Error())
+	default:
+		httpErrors.Internal(w, r, msg, err)
+	}
 }
@@ -1,12 +1,24 @@
 package medication
 
-import "github.com/aborilov/hippo/business/medication/model"
+import (
+	"time"
+
+	"github.com/aborilov/hippo/business/medication/catalog"
+	"github.com/aborilov/hippo/business/medication/model"
+	"github.com/google/uuid"
+)
 
 type Medication struct {
 	ID     string `json:"id"`
 	Name   string `json:"name"`
 	Dosage int64  `json:"dosage"`
 	Form   string `json:"form"`
+
+	GenericName string `json:"generic_name,omitempty"`
+	Route       string `json:"route,omitempty"`
+	Strength    string `json:"strength,omitempty"`
+
+	ExternalID string `json:"external_id,omitempty"`
 }
 
 func (m *Medication) ToService() (*model.Medication, error) {
@@ -18,6 +30,11 @@ func (m *Medication) ToService() (*model.Medication, error) {
 		Name:   m.Name,
 		Dosage: m.Dosage,
 		Form:   f,
+
+		GenericName: m.GenericName,
+		Route:       m.Route,
+		Strength:    m.Strength,
+		ExternalID:  m.ExternalID,
 	}, nil
 }
 
@@ -27,5 +44,203 @@ func serviceToMedication(m *model.Medication) *Medication {
 		Name:   m.Name,
 		Dosage: m.Dosage,
 		Form:   m.Form.String(),
+
+		GenericName: m.GenericName,
+		Route:       m.Route,
+		Strength:    m.Strength,
+		ExternalID:  m.ExternalID,
+	}
+}
+
+// Code is a product code of a medication. Type is ndc, gtin or sku.
+type Code struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+func (c Code) ToService() model.Code {
+	return model.Code{Type: model.CodeType(c.Type), Value: c.Value}
+}
+
+func serviceToCode(c model.Code) Code {
+	return Code{Type: string(c.Type), Value: c.Value}
+}
+
+func serviceToCodes(codes []model.Code) []Code {
+	out := make([]Code, 0, len(codes))
+	for _, c := range codes {
+		out = append(out, serviceToCode(c))
+	}
+	return out
+}
+
+// Lookup is the medication a scanned code resolved to, and the code it
+// matched in normalized form.
+type Lookup struct {
+	Medication *Medication `json:"medication"`
+	Matched    Code        `json:"matched"`
+}
+
+// ScanRequest carries the element string sent by a scanner, with FNC1 sent
+// as the group separator "\u001d".
+type ScanRequest struct {
+	Data string `json:"data"`
+}
+
+// Scan is a decoded package barcode. Expiry is a date such as "2027-03-31".
+type Scan struct {
+	Medication *Medication `json:"medication"`
+	GTIN       string      `json:"gtin"`
+	Lot        string      `json:"lot,omitempty"`
+	Serial     string      `json:"serial,omitempty"`
+	Expiry     string      `json:"expiry,omitempty"`
+	Expired    bool        `json:"expired"`
+}
+
+func serviceToScan(m *model.Medication, p model.Package, now time.Time) Scan {
+	s := Scan{
+		Medication: serviceToMedication(m),
+		GTIN:       p.GTIN,
+		Lot:        p.Lot,
+		Serial:     p.Serial,
+		Expired:    p.Expired(now),
+	}
+	if !p.Expiry.IsZero() {
+		s.Expiry = p.Expiry.Format(time.DateOnly)
+	}
+	return s
+}
+
+// ATC is a class of the ATC classification. Level runs from 1 for
+// anatomical main groups to 5 for chemical substances.
+type ATC struct {
+	Code  string `json:"code"`
+	Name  string `json:"name"`
+	Level int    `json:"level"`
+}
+
+func serviceToATC(a model.ATC) ATC {
+	return ATC{Code: a.Code, Name: a.Name, Level: a.Level()}
+}
+
+func serviceToATCs(classes []model.ATC) []ATC {
+	out := make([]ATC, 0, len(classes))
+	for _, a := range classes {
+		out = append(out, serviceToATC(a))
+	}
+	return out
+}
+
+// ATCNode is a class with the classes above it, top level first, and the
+// classes directly below it. Class is omitted for the root of the
+// classification.
+type ATCNode struct {
+	Class    *ATC  `json:"class,omitempty"`
+	Path     []ATC `json:"path"`
+	Children []ATC `json:"children"`
+}
+
+func serviceToATCNode(n model.ATCNode) ATCNode {
+	node := ATCNode{
+		Path:     serviceToATCs(n.Path),
+		Children: serviceToATCs(n.Children),
+	}
+	if n.Class.Code != "" {
+		class := serviceToATC(n.Class)
+		node.Class = &class
+	}
+	return node
+}
+
+// ImportJob is the state of a catalog upload. Errors, Summary and Changes are
+// set once the job has finished.
+type ImportJob struct {
+	ID         string     `json:"id"`
+	Status     string     `json:"status"`
+	DryRun     bool       `json:"dry_run"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+
+	Rows    int              `json:"rows"`
+	Applied bool             `json:"applied"`
+	Errors  []ImportRowError `json:"errors,omitempty"`
+	Summary *ImportSummary   `json:"summary,omitempty"`
+	Changes []ImportChange   `json:"changes,omitempty"`
+}
+
+type ImportRowError struct {
+	Line   int    `json:"line"`
+	Field  string `json:"field,omitempty"`
+	Reason string `json:"reason"`
+}
+
+type ImportSummary struct {
+	Create    int `json:"create"`
+	Update    int `json:"update"`
+	Delete    int `json:"delete"`
+	Unchanged int `json:"unchanged"`
+}
+
+type ImportChange struct {
+	Op         string      `json:"op"`
+	Line       int         `json:"line,omitempty"`
+	ExternalID string      `json:"external_id"`
+	Fields     []string    `json:"fields,omitempty"`
+	Before     *Medication `json:"before,omitempty"`
+	After      *Medication `json:"after,omitempty"`
+}
+
+func jobToImportJob(j catalog.Job) *ImportJob {
+	out := &ImportJob{
+		ID:        j.ID.String(),
+		Status:    string(j.Status),
+		DryRun:    j.DryRun,
+		StartedAt: j.Started.UTC(),
+	}
+	if j.Status == catalog.JobRunning {
+		return out
+	}
+
+	finished := j.Finished.UTC()
+	out.FinishedAt = &finished
+	if j.Err != nil {
+		out.Error = j.Err.Error()
+	}
+	out.Rows = j.Report.Rows
+	out.Applied = j.Report.Applied
+	for _, e := range j.Report.Errors {
+		out.Errors = append(out.Errors, ImportRowError{Line: e.Line, Field: e.Field, Reason: e.Reason})
+	}
+	if len(out.Errors) > 0 {
+		return out
+	}
+
+	p := j.Report.Plan
+	out.Summary = &ImportSummary{
+		Create:    p.Count(catalog.OpCreate),
+		Update:    p.Count(catalog.OpUpdate),
+		Delete:    p.Count(catalog.OpDelete),
+		Unchanged: p.Unchanged,
+	}
+	for _, c := range p.Changes {
+		ch := ImportChange{
+			Op:         string(c.Op),
+			Line:       c.Line,
+			ExternalID: c.ExternalID(),
+			Fields:     c.Fields(),
+		}
+		if c.Before != nil {
+			ch.Before = serviceToMedication(c.Before)
+		}
+		if c.After != nil {
+			ch.After = serviceToMedication(c.After)
+			// a dry run doesn't assign ids to the medications it would create
+			if c.After.ID == uuid.Nil {
+				ch.After.ID = ""
+			}
+		}
+		out.Changes = append(out.Changes, ch)
 	}
+	return out
 }
@@ -0,0 +1,17 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidKey is returned when a key is unknown, expired or revoked.
+var ErrInvalidKey = errors.New("invalid api key")
+
+type ErrNotFound struct {
+	KeyID string
+}
+
+func (e ErrNotFound) Error() string {
+	return fmt.Sprintf("api key not found (ID: %s)", e.KeyID)
+}
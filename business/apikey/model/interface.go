@@ -0,0 +1,27 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"github.com/aborilov/hippo/business/sdk/auth"
+	"github.com/google/uuid"
+)
+
+type Service interface {
+	// Create stores a new key and returns it together with the plain text
+	// secret, which is not kept and can't be recovered later.
+	Create(context.Context, NewAPIKey) (*APIKey, string, error)
+	List(context.Context) ([]*APIKey, error)
+	Revoke(context.Context, uuid.UUID) error
+	// Authenticate resolves a plain text key to the principal it acts as.
+	Authenticate(context.Context, string) (auth.Principal, error)
+}
+
+type Repository interface {
+	Create(context.Context, *APIKey) (*APIKey, error)
+	List(context.Context) ([]*APIKey, error)
+	GetByHash(context.Context, string) (*APIKey, error)
+	Revoke(context.Context, uuid.UUID, time.Time) error
+	Touch(context.Context, uuid.UUID, time.Time) error
+}
@@ -0,0 +1,34 @@
+package model
+
+import (
+	"time"
+
+	"github.com/aborilov/hippo/business/sdk/auth"
+	"github.com/google/uuid"
+)
+
+type APIKey struct {
+	ID          uuid.UUID
+	Name        string
+	Prefix      string
+	Hash        string
+	Permissions []auth.Permission
+	CreatedAt   time.Time
+	ExpiresAt   *time.Time
+	LastUsedAt  *time.Time
+	RevokedAt   *time.Time
+}
+
+// Active reports whether the key can be used to authenticate at time now.
+func (k *APIKey) Active(now time.Time) bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return k.ExpiresAt == nil || now.Before(*k.ExpiresAt)
+}
+
+type NewAPIKey struct {
+	Name        string
+	Permissions []auth.Permission
+	ExpiresAt   *time.Time
+}
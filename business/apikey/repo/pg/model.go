@@ -0,0 +1,76 @@
+package pg
+
+import (
+	"database/sql/driver"
+	"time"
+
+	"github.com/aborilov/hippo/business/apikey/model"
+	"github.com/aborilov/hippo/business/sdk/auth"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var typeMap = pgtype.NewMap()
+
+// textArray maps a string slice onto a Postgres TEXT[] column.
+type textArray []string
+
+func (a *textArray) Scan(src any) error {
+	return typeMap.SQLScanner((*[]string)(a)).Scan(src)
+}
+
+func (a textArray) Value() (driver.Value, error) {
+	buf, err := typeMap.Encode(pgtype.TextArrayOID, pgtype.TextFormatCode, []string(a), nil)
+	if err != nil {
+		return nil, err
+	}
+	return string(buf), nil
+}
+
+type APIKey struct {
+	ID          uuid.UUID  `db:"id"`
+	Name        string     `db:"name"`
+	Prefix      string     `db:"prefix"`
+	Hash        string     `db:"hash"`
+	Permissions textArray  `db:"permissions"`
+	CreatedAt   time.Time  `db:"created_at"`
+	ExpiresAt   *time.Time `db:"expires_at"`
+	LastUsedAt  *time.Time `db:"last_used_at"`
+	RevokedAt   *time.Time `db:"revoked_at"`
+}
+
+func (k *APIKey) toService() *model.APIKey {
+	perms := make([]auth.Permission, len(k.Permissions))
+	for i, p := range k.Permissions {
+		perms[i] = auth.Permission(p)
+	}
+	return &model.APIKey{
+		ID:          k.ID,
+		Name:        k.Name,
+		Prefix:      k.Prefix,
+		Hash:        k.Hash,
+		Permissions: perms,
+		CreatedAt:   k.CreatedAt,
+		ExpiresAt:   k.ExpiresAt,
+		LastUsedAt:  k.LastUsedAt,
+		RevokedAt:   k.RevokedAt,
+	}
+}
+
+func fromServiceAPIKey(k *model.APIKey) *APIKey {
+	perms := make(textArray, len(k.Permissions))
+	for i, p := range k.Permissions {
+		perms[i] = string(p)
+	}
+	return &APIKey{
+		ID:          k.ID,
+		Name:        k.Name,
+		Prefix:      k.Prefix,
+		Hash:        k.Hash,
+		Permissions: perms,
+		CreatedAt:   k.CreatedAt,
+		ExpiresAt:   k.ExpiresAt,
+		LastUsedAt:  k.LastUsedAt,
+		RevokedAt:   k.RevokedAt,
+	}
+}
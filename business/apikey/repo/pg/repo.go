@@ -0,0 +1,93 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aborilov/hippo/business/apikey/model"
+	"github.com/doug-martin/goqu/v9"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	table = "api_key"
+)
+
+func NewRepository(db *sqlx.DB) (model.Repository, error) {
+	if db == nil {
+		return nil, errors.New(`"db" cannot be nil`)
+	}
+
+	r := &repository{
+		db: db,
+		gq: goqu.New("postgres", db),
+	}
+	return r, nil
+}
+
+type repository struct {
+	db *sqlx.DB
+	gq *goqu.Database
+}
+
+func (repo *repository) Create(ctx context.Context, k *model.APIKey) (*model.APIKey, error) {
+	rec := fromServiceAPIKey(k)
+	if _, err := repo.gq.Insert(table).Rows(rec).Executor().ExecContext(ctx); err != nil {
+		return nil, fmt.Errorf("unable to create api key: %w", err)
+	}
+	return rec.toService(), nil
+}
+
+func (repo *repository) List(ctx context.Context) ([]*model.APIKey, error) {
+	recs := []APIKey{}
+	err := repo.gq.From(table).Order(goqu.I("created_at").Asc()).ScanStructsContext(ctx, &recs)
+	if err != nil {
+		return nil, err
+	}
+	var keys []*model.APIKey
+	for _, r := range recs {
+		keys = append(keys, r.toService())
+	}
+	return keys, nil
+}
+
+func (repo *repository) GetByHash(ctx context.Context, hash string) (*model.APIKey, error) {
+	record := &APIKey{}
+	found, err := repo.gq.From(table).Where(goqu.I("hash").Eq(hash)).ScanStructContext(ctx, record)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get api key: %w", err)
+	}
+	if !found {
+		return nil, model.ErrNotFound{}
+	}
+	return record.toService(), nil
+}
+
+func (repo *repository) Revoke(ctx context.Context, id uuid.UUID, at time.Time) error {
+	res, err := repo.gq.Update(table).
+		Where(goqu.I("id").Eq(id.String())).
+		Set(goqu.Record{"revoked_at": goqu.COALESCE(goqu.I("revoked_at"), at)}).
+		Executor().ExecContext(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to revoke api key: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return model.ErrNotFound{KeyID: id.String()}
+	}
+	return nil
+}
+
+func (repo *repository) Touch(ctx context.Context, id uuid.UUID, at time.Time) error {
+	_, err := repo.gq.Update(table).
+		Where(goqu.I("id").Eq(id.String())).
+		Set(goqu.Record{"last_used_at": at}).
+		Executor().ExecContext(ctx)
+	return err
+}
@@ -0,0 +1,184 @@
+// Package atc imports the Anatomical Therapeutic Chemical classification of
+// the WHO. It reads a CSV file of codes and names, such as an export of the
+// ATC/DDD index, checks that every class sits under a class of the file, and
+// only writes the classes that are new or renamed.
+package atc
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/aborilov/hippo/business/medication/model"
+	"github.com/aborilov/hippo/foundation/logger"
+)
+
+const logName = "medication.atc"
+
+// Column names accepted for the code and the name of a class.
+var (
+	codeColumns = []string{"atc_code", "code"}
+	nameColumns = []string{"atc_name", "name"}
+)
+
+// Parse reads a classification with a header row naming its code and name
+// columns, atc_code and atc_name or code and name. Other columns are
+// ignored, and so are repeated rows of a class, as the ATC/DDD index lists a
+// substance once per defined daily dose. Classes are returned ordered by
+// code.
+func Parse(r io.Reader) ([]model.ATC, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	codeCol, nameCol := -1, -1
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		switch {
+		case slices.Contains(codeColumns, h):
+			codeCol = i
+		case slices.Contains(nameColumns, h):
+			nameCol = i
+		}
+	}
+	if codeCol < 0 || nameCol < 0 {
+		return nil, errors.New("the header names no atc_code and atc_name columns")
+	}
+
+	byCode := map[string]model.ATC{}
+	lines := map[string]int{}
+	for {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		if codeCol >= len(rec) || nameCol >= len(rec) {
+			return nil, fmt.Errorf("line %d: has %d fields", line, len(rec))
+		}
+
+		code, err := model.ParseATC(rec[codeCol])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		name := strings.TrimSpace(rec[nameCol])
+		if name == "" {
+			return nil, fmt.Errorf("line %d: %s has no name", line, code)
+		}
+		if prev, ok := byCode[code]; ok {
+			if prev.Name != name {
+				return nil, fmt.Errorf("line %d: %s is named %q on line %d", line, code, prev.Name, lines[code])
+			}
+			continue
+		}
+		byCode[code] = model.ATC{Code: code, Name: name}
+		lines[code] = line
+	}
+
+	if len(byCode) == 0 {
+		return nil, errors.New("the file holds no classes")
+	}
+	classes := slices.SortedFunc(maps.Values(byCode), func(a, b model.ATC) int {
+		return strings.Compare(a.Code, b.Code)
+	})
+	for _, a := range classes {
+		if parent := model.ATCParent(a.Code); parent != "" {
+			if _, ok := byCode[parent]; !ok {
+				return nil, fmt.Errorf("line %d: %s is under %s, which the file lacks", lines[a.Code], a.Code, parent)
+			}
+		}
+	}
+	return classes, nil
+}
+
+// Options control an import.
+type Options struct {
+	// DryRun compares the classification with the stored one without
+	// writing it.
+	DryRun bool
+}
+
+// Summary is the outcome of an import. Levels counts the classes of the
+// file by level, from anatomical main groups to chemical substances.
+type Summary struct {
+	Levels    [5]int
+	Created   int
+	Renamed   int
+	Unchanged int
+	Applied   bool
+}
+
+// Import reads a classification and stores its new and renamed classes
+// through svc in a single transaction, unless it is a dry run. Classes
+// missing from the file are kept, as medications may still be classified
+// under them.
+func Import(ctx context.Context, svc model.Service, r io.Reader, opts Options) (Summary, error) {
+	var sum Summary
+	classes, err := Parse(r)
+	if err != nil {
+		return sum, err
+	}
+
+	codes := make([]string, 0, len(classes))
+	for _, a := range classes {
+		codes = append(codes, a.Code)
+		sum.Levels[a.Level()-1]++
+	}
+	stored, err := svc.ATCClasses(ctx, codes)
+	if err != nil {
+		return sum, fmt.Errorf("get atc classes: %w", err)
+	}
+	names := make(map[string]string, len(stored))
+	for _, a := range stored {
+		names[a.Code] = a.Name
+	}
+
+	var changed []model.ATC
+	for _, a := range classes {
+		name, ok := names[a.Code]
+		switch {
+		case !ok:
+			sum.Created++
+		case name != a.Name:
+			sum.Renamed++
+		default:
+			sum.Unchanged++
+			continue
+		}
+		changed = append(changed, a)
+	}
+
+	log := logger.FromContext(ctx).WithName(logName)
+	log.V(1).Info("atc classification planned", "classes", len(classes),
+		"create", sum.Created, "rename", sum.Renamed, "dry_run", opts.DryRun)
+	if opts.DryRun {
+		return sum, nil
+	}
+
+	if len(changed) > 0 {
+		if _, err := svc.ImportATC(ctx, changed); err != nil {
+			return sum, fmt.Errorf("import atc classes: %w", err)
+		}
+	}
+	sum.Applied = true
+	log.Info("atc classification applied", "classes", len(classes), "created", sum.Created, "renamed", sum.Renamed)
+	return sum, nil
+}
+
+// Write prints the classes of the file by level and the changes.
+func (s Summary) Write(w io.Writer) error {
+	fmt.Fprintf(w, "%d anatomical groups, %d therapeutic, %d pharmacological and %d chemical subgroups, %d substances\n",
+		s.Levels[0], s.Levels[1], s.Levels[2], s.Levels[3], s.Levels[4])
+	_, err := fmt.Fprintf(w, "%d to create, %d to rename, %d unchanged\n", s.Created, s.Renamed, s.Unchanged)
+	return err
+}
@@ -0,0 +1,129 @@
+package atc_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aborilov/hippo/business/medication/atc"
+	"github.com/aborilov/hippo/business/medication/model"
+)
+
+// metformin is the branch of the classification down to metformin.
+const metformin = "A,ALIMENTARY TRACT AND METABOLISM\n" +
+	"A10,DRUGS USED IN DIABETES\n" +
+	"A10B,\"BLOOD GLUCOSE LOWERING DRUGS, EXCL. INSULINS\"\n" +
+	"A10BA,Biguanides\n" +
+	"A10BA02,metformin\n"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		codes []string
+		err   string
+	}{
+		{
+			name:  "hierarchy",
+			data:  "atc_code,atc_name\n" + metformin,
+			codes: []string{"A", "A10", "A10B", "A10BA", "A10BA02"},
+		},
+		{
+			name: "ddd index",
+			data: "\xef\xbb\xbfATC_CODE,ATC_NAME,DDD,UOM\n" +
+				"a10ba02,metformin,2,g\n" +
+				"A10BA02,metformin,2,g\n" +
+				"A10BA,Biguanides,,\n" +
+				"A10B,BLOOD GLUCOSE LOWERING DRUGS,,\n" +
+				"A10,DRUGS USED IN DIABETES,,\n" +
+				"A,ALIMENTARY TRACT AND METABOLISM,,\n",
+			codes: []string{"A", "A10", "A10B", "A10BA", "A10BA02"},
+		},
+		{
+			name:  "code and name",
+			data:  "name,code\nALIMENTARY TRACT AND METABOLISM,A\n",
+			codes: []string{"A"},
+		},
+		{
+			name: "missing therapeutic subgroup",
+			data: "atc_code,atc_name\n" +
+				"A,ALIMENTARY TRACT AND METABOLISM\n" +
+				"A10B,\"BLOOD GLUCOSE LOWERING DRUGS, EXCL. INSULINS\"\n",
+			err: "line 3: A10B is under A10, which the file lacks",
+		},
+		{
+			name: "missing chemical subgroup",
+			data: "atc_code,atc_name\n" + strings.Replace(metformin, "A10BA,Biguanides\n", "", 1),
+			err:  "line 5: A10BA02 is under A10BA, which the file lacks",
+		},
+		{
+			name: "missing main group",
+			data: "atc_code,atc_name\nA10,DRUGS USED IN DIABETES\n",
+			err:  "line 2: A10 is under A, which the file lacks",
+		},
+		{
+			name: "renamed",
+			data: "atc_code,atc_name\n" + metformin + "A10BA02,metformine\n",
+			err:  `line 7: A10BA02 is named "metformin" on line 6`,
+		},
+		{
+			name: "no name",
+			data: "atc_code,atc_name\nA, \n",
+			err:  "line 2: A has no name",
+		},
+		{
+			name: "invalid code",
+			data: "atc_code,atc_name\nA1,DRUGS USED IN DIABETES\n",
+			err:  `line 2: invalid medication: atc "A1" is not 1, 3, 4, 5 or 7 characters long`,
+		},
+		{
+			name: "short row",
+			data: "atc_code,ddd,atc_name\nA,1\n",
+			err:  "line 2: has 2 fields",
+		},
+		{
+			name: "no name column",
+			data: "atc_code,ddd\nA,1\n",
+			err:  "the header names no atc_code and atc_name columns",
+		},
+		{
+			name: "no classes",
+			data: "atc_code,atc_name\n",
+			err:  "the file holds no classes",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			classes, err := atc.Parse(strings.NewReader(tt.data))
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("got %v, want %s", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse: %s", err)
+			}
+
+			var codes []string
+			for _, a := range classes {
+				codes = append(codes, a.Code)
+			}
+			if !slices.Equal(codes, tt.codes) {
+				t.Errorf("got %v, want %v", codes, tt.codes)
+			}
+		})
+	}
+}
+
+func TestParseKeepsNames(t *testing.T) {
+	classes, err := atc.Parse(strings.NewReader("atc_code,atc_name\n" + metformin))
+	if err != nil {
+		t.Fatalf("parse: %s", err)
+	}
+	want := model.ATC{Code: "A10B", Name: "BLOOD GLUCOSE LOWERING DRUGS, EXCL. INSULINS"}
+	if got := classes[2]; got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
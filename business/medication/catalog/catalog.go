@@ -0,0 +1,168 @@
+// Package catalog imports the medication catalog maintained by the formulary
+// team. A catalog is a CSV or NDJSON file with one medication per row, keyed
+// by external id, and importing it makes the medications of its scope match
+// the file exactly.
+package catalog
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/aborilov/hippo/business/medication/model"
+	"github.com/aborilov/hippo/business/sdk/sqldb"
+	"github.com/aborilov/hippo/foundation/logger"
+)
+
+const logName = "medication.catalog"
+
+// DefaultScope is the external id prefix of catalog medications when an
+// import doesn't name one.
+const DefaultScope = "catalog:"
+
+// Options control an import.
+type Options struct {
+	Format  Format
+	Mapping Mapping
+
+	// Scope is the external id prefix the catalog owns. Every row must be
+	// in scope, and medications in scope that the catalog lacks are deleted.
+	Scope string
+
+	// DryRun computes the plan without writing it.
+	DryRun bool
+}
+
+// Report is the outcome of an import.
+type Report struct {
+	Rows    int
+	Errors  []RowError
+	Plan    Plan
+	Applied bool
+}
+
+// ErrRejected is returned when a catalog has invalid rows, which are listed
+// in the report. Nothing is written in that case.
+type ErrRejected struct {
+	Rows int
+}
+
+func (e ErrRejected) Error() string {
+	return fmt.Sprintf("catalog rejected: %d invalid rows", e.Rows)
+}
+
+// Import reads a catalog and diffs it against the medications of its scope.
+// Unless it is a dry run, the plan is then applied through svc in a single
+// transaction. Either every row is valid and the whole plan is applied or
+// nothing is written.
+func Import(ctx context.Context, svc model.Service, r io.Reader, opts Options) (Report, error) {
+	scope := opts.Scope
+	if scope == "" {
+		scope = DefaultScope
+	}
+	log := logger.FromContext(ctx).WithName(logName)
+
+	var report Report
+	rows, errs, err := Parse(r, opts.Format, opts.Mapping)
+	if err != nil {
+		return report, err
+	}
+	report.Rows = len(rows) + countLines(errs)
+	report.Errors = append(errs, checkKeys(rows, scope)...)
+	slices.SortStableFunc(report.Errors, func(a, b RowError) int {
+		return cmp.Compare(a.Line, b.Line)
+	})
+	if len(report.Errors) > 0 {
+		log.Info("catalog rejected", "rows", report.Rows, "errors", len(report.Errors))
+		return report, ErrRejected{Rows: countLines(report.Errors)}
+	}
+
+	plan := func(current []*model.Medication) Plan { return Diff(current, rows) }
+	report.Plan, err = Sync(ctx, svc, scope, plan, !opts.DryRun)
+	if err != nil {
+		return report, fmt.Errorf("apply catalog: %w", err)
+	}
+
+	log.V(1).Info("catalog planned", "scope", scope, "rows", report.Rows,
+		"create", report.Plan.Count(OpCreate), "update", report.Plan.Count(OpUpdate),
+		"delete", report.Plan.Count(OpDelete), "dry_run", opts.DryRun)
+	if opts.DryRun {
+		return report, nil
+	}
+
+	report.Applied = true
+	log.Info("catalog applied", "scope", scope, "rows", report.Rows,
+		"created", report.Plan.Count(OpCreate), "updated", report.Plan.Count(OpUpdate), "deleted", report.Plan.Count(OpDelete))
+	return report, nil
+}
+
+// syncAttempts is how many times Sync plans a scope that other imports keep
+// changing before it gives up.
+const syncAttempts = 3
+
+// Sync reads the medications of scope from the primary, plans the changes
+// to them with plan and, when apply is set, applies the plan in a single
+// transaction. Apply checks the scope still matches what was read, so when
+// another import changed it in between the plan is made again.
+func Sync(ctx context.Context, svc model.Service, scope string, plan func(current []*model.Medication) Plan, apply bool) (Plan, error) {
+	log := logger.FromContext(ctx).WithName(logName)
+	filter := model.Filter{ExternalIDPrefix: scope}
+
+	for attempt := 1; ; attempt++ {
+		current, err := svc.List(sqldb.WithPrimary(ctx), filter)
+		if err != nil {
+			return Plan{}, fmt.Errorf("list medications: %w", err)
+		}
+		p := plan(current)
+		if !apply {
+			return p, nil
+		}
+
+		changes := p.ModelChanges()
+		if changes.Empty() {
+			return p, nil
+		}
+		changes.Scope = scope
+		changes.Snapshot = current
+
+		err = svc.Apply(ctx, changes)
+		if errors.As(err, &model.ErrScopeChanged{}) && attempt < syncAttempts {
+			log.Info("scope changed while applying, planning again", "scope", scope, "attempt", attempt)
+			continue
+		}
+		return p, err
+	}
+}
+
+// checkKeys reports rows outside of scope and external ids used by more than
+// one row.
+func checkKeys(rows []Row, scope string) []RowError {
+	var errs []RowError
+	seen := make(map[string]int, len(rows))
+	for _, r := range rows {
+		id := r.Medication.ExternalID
+		if !strings.HasPrefix(id, scope) {
+			errs = append(errs, RowError{Line: r.Line, Field: FieldExternalID, Reason: fmt.Sprintf("%q does not start with %q", id, scope)})
+			continue
+		}
+		if first, ok := seen[id]; ok {
+			errs = append(errs, RowError{Line: r.Line, Field: FieldExternalID, Reason: fmt.Sprintf("%q is already used on line %d", id, first)})
+			continue
+		}
+		seen[id] = r.Line
+	}
+	return errs
+}
+
+// countLines returns the number of distinct lines with errors.
+func countLines(errs []RowError) int {
+	lines := map[int]bool{}
+	for _, e := range errs {
+		lines[e.Line] = true
+	}
+	return len(lines)
+}
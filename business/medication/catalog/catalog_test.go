@@ -0,0 +1,228 @@
+package catalog_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aborilov/hippo/business/medication/catalog"
+	"github.com/aborilov/hippo/business/medication/model"
+	"github.com/google/uuid"
+)
+
+// service serves the medications of a scope and records the changes applied
+// to it. The first conflicts calls to Apply fail with ErrScopeChanged.
+type service struct {
+	model.Service
+	current   []*model.Medication
+	conflicts int
+	applied   []model.Changes
+}
+
+func (s *service) List(_ context.Context, f model.Filter) ([]*model.Medication, error) {
+	var meds []*model.Medication
+	for _, m := range s.current {
+		if strings.HasPrefix(m.ExternalID, f.ExternalIDPrefix) {
+			meds = append(meds, m)
+		}
+	}
+	return meds, nil
+}
+
+func (s *service) Apply(_ context.Context, c model.Changes) error {
+	s.applied = append(s.applied, c)
+	if len(s.applied) <= s.conflicts {
+		return model.ErrScopeChanged{Scope: c.Scope}
+	}
+	return nil
+}
+
+func medication(externalID string, name string, dosage int64) *model.Medication {
+	return &model.Medication{ID: uuid.New(), ExternalID: externalID, Name: name, Dosage: dosage, Form: model.FormTablet}
+}
+
+func TestParseCSV(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		rows  []int
+		lines []int
+	}{
+		{
+			name: "plain",
+			data: "external_id,name,dosage,form\ncatalog:1,Aspirin,100,tablet\ncatalog:2,Ibuprofen,200,tablet\n",
+			rows: []int{2, 3},
+		},
+		{
+			name: "byte order mark",
+			data: "\xef\xbb\xbfexternal_id,name,dosage,form\ncatalog:1,Aspirin,100,tablet\n",
+			rows: []int{2},
+		},
+		{
+			name:  "field count",
+			data:  "external_id,name,dosage,form\ncatalog:1,Aspirin,100,tablet\ncatalog:2,Ibuprofen,200\ncatalog:3,Paracetamol,500,tablet,extra\ncatalog:4,Warfarin,5,tablet\n",
+			rows:  []int{2, 5},
+			lines: []int{3, 4},
+		},
+		{
+			name:  "field count after a quoted line break",
+			data:  "external_id,name,dosage,form\ncatalog:1,\"Aspirin\nPlus\",100,tablet\ncatalog:2,Ibuprofen\n",
+			rows:  []int{2},
+			lines: []int{4},
+		},
+		{
+			name:  "invalid values",
+			data:  "external_id,name,dosage,form\ncatalog:1,Aspirin,many,tablet\n,Ibuprofen,200,tablet\n",
+			lines: []int{2, 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, errs, err := catalog.Parse(strings.NewReader(tt.data), catalog.FormatCSV, nil)
+			if err != nil {
+				t.Fatalf("parse: %s", err)
+			}
+
+			var gotRows, gotLines []int
+			for _, r := range rows {
+				gotRows = append(gotRows, r.Line)
+			}
+			for _, e := range errs {
+				gotLines = append(gotLines, e.Line)
+			}
+			if !slices.Equal(gotRows, tt.rows) {
+				t.Errorf("rows on lines %v, want %v", gotRows, tt.rows)
+			}
+			if !slices.Equal(gotLines, tt.lines) {
+				t.Errorf("errors on lines %v, want %v: %v", gotLines, tt.lines, errs)
+			}
+		})
+	}
+}
+
+func TestParseCSVMapsColumnAfterBOM(t *testing.T) {
+	mapping, err := catalog.ParseMapping("SKU=external_id")
+	if err != nil {
+		t.Fatalf("parse mapping: %s", err)
+	}
+	data := "\xef\xbb\xbfSKU,name,dosage,form\ncatalog:1,Aspirin,100,tablet\n"
+
+	rows, errs, err := catalog.Parse(strings.NewReader(data), catalog.FormatCSV, mapping)
+	if err != nil || len(errs) > 0 {
+		t.Fatalf("parse: %v %v", err, errs)
+	}
+	if len(rows) != 1 || rows[0].Medication.ExternalID != "catalog:1" {
+		t.Errorf("got rows %v, want catalog:1", rows)
+	}
+}
+
+func TestImportRejectsKeys(t *testing.T) {
+	data := "external_id,name,dosage,form\n" +
+		"catalog:1,Aspirin,100,tablet\n" +
+		"other:2,Ibuprofen,200,tablet\n" +
+		"catalog:1,Paracetamol,500,tablet\n" +
+		"catalog:3,Warfarin,5,tablet\n"
+
+	svc := &service{}
+	report, err := catalog.Import(context.Background(), svc, strings.NewReader(data), catalog.Options{Format: catalog.FormatCSV})
+
+	var rejected catalog.ErrRejected
+	if !errors.As(err, &rejected) || rejected.Rows != 2 {
+		t.Fatalf("got %v, want 2 rejected rows", err)
+	}
+	if len(svc.applied) > 0 {
+		t.Errorf("applied %d changes to a rejected catalog", len(svc.applied))
+	}
+
+	want := []string{
+		`line 3: external_id "other:2" does not start with "catalog:"`,
+		`line 4: external_id "catalog:1" is already used on line 2`,
+	}
+	var got []string
+	for _, e := range report.Errors {
+		got = append(got, e.Error())
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got errors %q, want %q", got, want)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	same := medication("catalog:1", "Aspirin", 100)
+	renamed := medication("catalog:2", "Ibuprofen", 200)
+	gone := medication("catalog:3", "Warfarin", 5)
+
+	rows := []catalog.Row{
+		{Line: 2, Medication: medication("catalog:1", "Aspirin", 100)},
+		{Line: 3, Medication: medication("catalog:2", "Ibuprofen Forte", 400)},
+		{Line: 4, Medication: medication("catalog:4", "Paracetamol", 500)},
+	}
+	plan := catalog.Diff([]*model.Medication{same, renamed, gone}, rows)
+
+	if plan.Unchanged != 1 {
+		t.Errorf("got %d unchanged, want 1", plan.Unchanged)
+	}
+	type change struct {
+		op         catalog.Op
+		externalID string
+		line       int
+		fields     string
+	}
+	var got []change
+	for _, c := range plan.Changes {
+		got = append(got, change{c.Op, c.ExternalID(), c.Line, strings.Join(c.Fields(), ",")})
+	}
+	want := []change{
+		{catalog.OpUpdate, "catalog:2", 3, "name,dosage"},
+		{catalog.OpCreate, "catalog:4", 4, ""},
+		{catalog.OpDelete, "catalog:3", 0, ""},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got changes %v, want %v", got, want)
+	}
+
+	changes := plan.ModelChanges()
+	if changes.Update[0].ID != renamed.ID {
+		t.Errorf("update keeps id %s, want %s", changes.Update[0].ID, renamed.ID)
+	}
+	if !slices.Equal(changes.Delete, []uuid.UUID{gone.ID}) {
+		t.Errorf("got deletes %v, want %v", changes.Delete, gone.ID)
+	}
+}
+
+func TestSyncPlansAgainWhenTheScopeChanged(t *testing.T) {
+	svc := &service{
+		current:   []*model.Medication{medication("catalog:1", "Aspirin", 100), medication("other:1", "Ibuprofen", 200)},
+		conflicts: 1,
+	}
+	rows := []catalog.Row{{Line: 2, Medication: medication("catalog:2", "Paracetamol", 500)}}
+	plan := func(current []*model.Medication) catalog.Plan { return catalog.Diff(current, rows) }
+
+	if _, err := catalog.Sync(context.Background(), svc, "catalog:", plan, true); err != nil {
+		t.Fatalf("sync: %s", err)
+	}
+	if len(svc.applied) != 2 {
+		t.Fatalf("applied %d times, want 2", len(svc.applied))
+	}
+	c := svc.applied[1]
+	if c.Scope != "catalog:" || len(c.Snapshot) != 1 || c.Snapshot[0].ExternalID != "catalog:1" {
+		t.Errorf("got scope %q and snapshot %v, want the catalog: medications", c.Scope, c.Snapshot)
+	}
+}
+
+func TestSyncGivesUp(t *testing.T) {
+	svc := &service{conflicts: 10}
+	rows := []catalog.Row{{Line: 2, Medication: medication("catalog:1", "Aspirin", 100)}}
+	plan := func(current []*model.Medication) catalog.Plan { return catalog.Diff(current, rows) }
+
+	_, err := catalog.Sync(context.Background(), svc, "catalog:", plan, true)
+	if !errors.As(err, &model.ErrScopeChanged{}) {
+		t.Fatalf("got %v, want ErrScopeChanged", err)
+	}
+	if len(svc.applied) != 3 {
+		t.Errorf("applied %d times, want 3", len(svc.applied))
+	}
+}
@@ -0,0 +1,184 @@
+package catalog
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/aborilov/hippo/business/medication/model"
+)
+
+// Op is the kind of a catalog change.
+type Op string
+
+const (
+	OpCreate Op = "create"
+	OpUpdate Op = "update"
+	OpDelete Op = "delete"
+)
+
+// Change is the effect of a catalog on one medication. Before is nil for
+// creates and After is nil for deletes. Line is the catalog row of creates
+// and updates.
+type Change struct {
+	Op     Op
+	Line   int
+	Before *model.Medication
+	After  *model.Medication
+}
+
+// ExternalID returns the external id of the changed medication.
+func (c Change) ExternalID() string {
+	if c.After != nil {
+		return c.After.ExternalID
+	}
+	return c.Before.ExternalID
+}
+
+// Fields returns the fields an update changes.
+func (c Change) Fields() []string {
+	if c.Op != OpUpdate {
+		return nil
+	}
+	return changed(c.Before, c.After)
+}
+
+// dataFields are the fields compared by Diff, all but the external id that
+// matches rows up.
+var dataFields = []string{FieldName, FieldGenericName, FieldDosage, FieldForm, FieldRoute, FieldStrength}
+
+func changed(before, after *model.Medication) []string {
+	var out []string
+	for _, f := range dataFields {
+		if value(before, f) != value(after, f) {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// Plan is the set of changes that makes the database match a catalog.
+type Plan struct {
+	Changes   []Change
+	Unchanged int
+}
+
+// Diff compares the catalog rows with the current medications of the
+// catalog, matching them by external id. Rows without a match are created,
+// rows that differ are updated and current medications missing from the
+// catalog are deleted.
+func Diff(current []*model.Medication, rows []Row) Plan {
+	byExternalID := make(map[string]*model.Medication, len(current))
+	for _, m := range current {
+		byExternalID[m.ExternalID] = m
+	}
+
+	var p Plan
+	for _, r := range rows {
+		cur, ok := byExternalID[r.Medication.ExternalID]
+		delete(byExternalID, r.Medication.ExternalID)
+		switch {
+		case !ok:
+			p.Changes = append(p.Changes, Change{Op: OpCreate, Line: r.Line, After: r.Medication})
+		case len(changed(cur, r.Medication)) > 0:
+			after := *r.Medication
+			after.ID = cur.ID
+			p.Changes = append(p.Changes, Change{Op: OpUpdate, Line: r.Line, Before: cur, After: &after})
+		default:
+			p.Unchanged++
+		}
+	}
+
+	deletes := make([]Change, 0, len(byExternalID))
+	for _, m := range byExternalID {
+		deletes = append(deletes, Change{Op: OpDelete, Before: m})
+	}
+	slices.SortFunc(deletes, func(a, b Change) int {
+		return cmp.Compare(a.Before.ExternalID, b.Before.ExternalID)
+	})
+	p.Changes = append(p.Changes, deletes...)
+	return p
+}
+
+// Count returns the number of changes of kind op.
+func (p Plan) Count(op Op) int {
+	n := 0
+	for _, c := range p.Changes {
+		if c.Op == op {
+			n++
+		}
+	}
+	return n
+}
+
+// ModelChanges returns the plan as the writes of a medication service.
+func (p Plan) ModelChanges() model.Changes {
+	var c model.Changes
+	for _, ch := range p.Changes {
+		switch ch.Op {
+		case OpCreate:
+			c.Create = append(c.Create, ch.After)
+		case OpUpdate:
+			c.Update = append(c.Update, ch.After)
+		case OpDelete:
+			c.Delete = append(c.Delete, ch.Before.ID)
+		}
+	}
+	return c
+}
+
+// WriteDiff prints one line per change, marking creates with +, updates with
+// ~ and deletes with -, followed by a summary. Rows are followed by their
+// line when they have one.
+func (p Plan) WriteDiff(w io.Writer) error {
+	for _, c := range p.Changes {
+		var line string
+		if c.Line > 0 {
+			line = fmt.Sprintf(" (line %d)", c.Line)
+		}
+
+		var err error
+		switch c.Op {
+		case OpCreate:
+			_, err = fmt.Fprintf(w, "+ %s\t%s%s\n", c.ExternalID(), describe(c.After), line)
+		case OpUpdate:
+			var diffs []string
+			for _, f := range c.Fields() {
+				diffs = append(diffs, fmt.Sprintf("%s %s -> %s", f, value(c.Before, f), value(c.After, f)))
+			}
+			_, err = fmt.Fprintf(w, "~ %s\t%s%s\n", c.ExternalID(), strings.Join(diffs, ", "), line)
+		case OpDelete:
+			_, err = fmt.Fprintf(w, "- %s\t%s\n", c.ExternalID(), describe(c.Before))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "%d to create, %d to update, %d to delete, %d unchanged\n",
+		p.Count(OpCreate), p.Count(OpUpdate), p.Count(OpDelete), p.Unchanged)
+	return err
+}
+
+func describe(m *model.Medication) string {
+	return fmt.Sprintf("%q %d %s", m.Name, m.Dosage, m.Form)
+}
+
+func value(m *model.Medication, field string) string {
+	switch field {
+	case FieldName:
+		return fmt.Sprintf("%q", m.Name)
+	case FieldDosage:
+		return fmt.Sprint(m.Dosage)
+	case FieldForm:
+		return m.Form.String()
+	case FieldGenericName:
+		return fmt.Sprintf("%q", m.GenericName)
+	case FieldRoute:
+		return fmt.Sprintf("%q", m.Route)
+	case FieldStrength:
+		return fmt.Sprintf("%q", m.Strength)
+	}
+	return ""
+}
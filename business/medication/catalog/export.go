@@ -0,0 +1,195 @@
+package catalog
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+
+	"github.com/aborilov/hippo/business/medication/model"
+)
+
+// exportColumns are the columns of exported catalogs. id is ignored on
+// import, so an export can be edited and imported back.
+var exportColumns = []string{"id", FieldExternalID, FieldName, FieldGenericName, FieldDosage, FieldForm, FieldRoute, FieldStrength}
+
+// Writer writes medications one at a time in a catalog format. The file is
+// only complete once Close returns, which doesn't close the underlying
+// writer.
+type Writer interface {
+	Write(*model.Medication) error
+	Close() error
+}
+
+// NewWriter returns a writer of catalogs in format to w.
+func NewWriter(w io.Writer, format Format) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w)
+	case FormatNDJSON:
+		return &ndjsonWriter{enc: json.NewEncoder(w)}, nil
+	case FormatXLSX:
+		return newXLSXWriter(w)
+	}
+	return nil, fmt.Errorf("unknown catalog format %q", format)
+}
+
+func record(m *model.Medication) []string {
+	return []string{m.ID.String(), m.ExternalID, m.Name, m.GenericName, strconv.FormatInt(m.Dosage, 10), m.Form.String(), m.Route, m.Strength}
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer) (*csvWriter, error) {
+	cw := csvWriter{w: csv.NewWriter(w)}
+	if err := cw.w.Write(exportColumns); err != nil {
+		return nil, err
+	}
+	return &cw, nil
+}
+
+func (cw *csvWriter) Write(m *model.Medication) error {
+	return cw.w.Write(record(m))
+}
+
+func (cw *csvWriter) Close() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// ndjsonRecord is the JSON form of an exported medication, which matches the
+// medication of the HTTP API.
+type ndjsonRecord struct {
+	ID         string `json:"id"`
+	ExternalID string `json:"external_id,omitempty"`
+	Name       string `json:"name"`
+	Dosage     int64  `json:"dosage"`
+	Form       string `json:"form"`
+
+	GenericName string `json:"generic_name,omitempty"`
+	Route       string `json:"route,omitempty"`
+	Strength    string `json:"strength,omitempty"`
+}
+
+type ndjsonWriter struct {
+	enc *json.Encoder
+}
+
+func (nw *ndjsonWriter) Write(m *model.Medication) error {
+	return nw.enc.Encode(ndjsonRecord{
+		ID:         m.ID.String(),
+		ExternalID: m.ExternalID,
+		Name:       m.Name,
+		Dosage:     m.Dosage,
+		Form:       m.Form.String(),
+
+		GenericName: m.GenericName,
+		Route:       m.Route,
+		Strength:    m.Strength,
+	})
+}
+
+func (nw *ndjsonWriter) Close() error {
+	return nil
+}
+
+// The parts of a workbook with a single sheet, apart from the sheet itself.
+// Strings are written inline in the sheet, so there is no shared string
+// table, and cells are unstyled.
+var xlsxParts = []struct{ name, body string }{
+	{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="Medications" sheetId="1" r:id="rId1"/></sheets>` +
+		`</workbook>`},
+	{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`</Relationships>`},
+}
+
+// xlsxMaxRows is the number of rows a sheet can hold.
+const xlsxMaxRows = 1 << 20
+
+// xlsxWriter streams the sheet into the last part of the workbook archive,
+// so rows are compressed and written out as they come.
+type xlsxWriter struct {
+	zw    *zip.Writer
+	sheet *bufio.Writer
+	rows  int
+}
+
+func newXLSXWriter(w io.Writer) (*xlsxWriter, error) {
+	zw := zip.NewWriter(w)
+	for _, p := range xlsxParts {
+		f, err := zw.Create(p.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, p.body); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	xw := xlsxWriter{zw: zw, sheet: bufio.NewWriter(f)}
+	xw.sheet.WriteString(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	if err := xw.row(exportColumns, -1); err != nil {
+		return nil, err
+	}
+	return &xw, nil
+}
+
+func (xw *xlsxWriter) Write(m *model.Medication) error {
+	if xw.rows == xlsxMaxRows {
+		return errors.New("an xlsx sheet holds at most 1048575 medications")
+	}
+	// the dosage is the only numeric cell
+	return xw.row(record(m), slices.Index(exportColumns, FieldDosage))
+}
+
+// row writes a row of cells, all strings except for the one at index
+// number.
+func (xw *xlsxWriter) row(cells []string, number int) error {
+	xw.rows++
+	fmt.Fprintf(xw.sheet, `<row r="%d">`, xw.rows)
+	for i, v := range cells {
+		ref := fmt.Sprintf("%c%d", 'A'+i, xw.rows)
+		if i == number {
+			fmt.Fprintf(xw.sheet, `<c r="%s"><v>%s</v></c>`, ref, v)
+			continue
+		}
+		fmt.Fprintf(xw.sheet, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">`, ref)
+		if err := xml.EscapeText(xw.sheet, []byte(v)); err != nil {
+			return err
+		}
+		xw.sheet.WriteString(`</t></is></c>`)
+	}
+	_, err := xw.sheet.WriteString(`</row>`)
+	return err
+}
+
+func (xw *xlsxWriter) Close() error {
+	xw.sheet.WriteString(`</sheetData></worksheet>`)
+	if err := xw.sheet.Flush(); err != nil {
+		return err
+	}
+	return xw.zw.Close()
+}
@@ -0,0 +1,183 @@
+package catalog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aborilov/hippo/business/medication/model"
+	"github.com/aborilov/hippo/business/sdk/auth"
+	"github.com/aborilov/hippo/foundation/logger"
+	"github.com/google/uuid"
+)
+
+const (
+	// jobTimeout bounds how long a background import may run.
+	jobTimeout = 10 * time.Minute
+
+	// jobRetention is how long a finished job can still be looked up.
+	jobRetention = time.Hour
+
+	// maxRunningJobs is how many imports may run at once in a process.
+	maxRunningJobs = 4
+)
+
+// ErrTooManyJobs is returned by Start while maxRunningJobs imports are
+// running.
+var ErrTooManyJobs = errors.New("too many catalog imports running")
+
+// ErrJobNotFound is returned by Get for an unknown or pruned job.
+var ErrJobNotFound = errors.New("import job not found")
+
+// ErrJobLost is the error of a job whose process stopped before it
+// finished.
+var ErrJobLost = errors.New("import job was lost: the instance running it stopped")
+
+// JobStatus is the state of a background import.
+type JobStatus string
+
+const (
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+)
+
+// Job is a catalog import running in the background. Owner is the ID of the
+// principal that started it.
+type Job struct {
+	ID       uuid.UUID
+	Owner    string
+	Status   JobStatus
+	DryRun   bool
+	Started  time.Time
+	Finished time.Time
+	Report   Report
+	Err      error
+}
+
+// JobStore keeps the jobs where every instance of the service finds them.
+type JobStore interface {
+	CreateJob(ctx context.Context, job Job) error
+	FinishJob(ctx context.Context, job Job) error
+
+	// GetJob returns ErrJobNotFound when there is no job with the id.
+	GetJob(ctx context.Context, id uuid.UUID) (Job, error)
+
+	// PruneJobs deletes the jobs started before the given time.
+	PruneJobs(ctx context.Context, startedBefore time.Time) error
+}
+
+// Jobs runs catalog imports in the background and records them in a store,
+// so any instance of the service can report a job. Finished jobs are kept
+// for an hour. A job still running when its process stops is reported as
+// failed with ErrJobLost once it could no longer be running.
+type Jobs struct {
+	authz auth.Authorizer
+	store JobStore
+
+	mu      sync.Mutex
+	running int
+}
+
+// NewJobs returns the jobs recorded in store. Jobs are authorized with authz
+// before they start.
+func NewJobs(authz auth.Authorizer, store JobStore) *Jobs {
+	return &Jobs{authz: authz, store: store}
+}
+
+// Start imports data in the background and returns the running job. The
+// import runs as the caller in ctx but outlives it, so ctx may be the
+// context of the request that uploaded the catalog. The caller needs
+// medication:read for a dry run, and medication:write and medication:delete
+// otherwise since any import may delete, which is checked before the job
+// starts.
+func (j *Jobs) Start(ctx context.Context, svc model.Service, data []byte, opts Options) (Job, error) {
+	perms := []auth.Permission{auth.PermMedicationRead}
+	if !opts.DryRun {
+		perms = []auth.Permission{auth.PermMedicationWrite, auth.PermMedicationDelete}
+	}
+	for _, perm := range perms {
+		if err := j.authz.Authorize(ctx, perm); err != nil {
+			return Job{}, err
+		}
+	}
+
+	j.mu.Lock()
+	if j.running >= maxRunningJobs {
+		j.mu.Unlock()
+		return Job{}, ErrTooManyJobs
+	}
+	j.running++
+	j.mu.Unlock()
+
+	pr, _ := auth.GetPrincipal(ctx)
+	job := Job{
+		ID:      uuid.New(),
+		Owner:   pr.ID(),
+		Status:  JobRunning,
+		DryRun:  opts.DryRun,
+		Started: time.Now(),
+	}
+	if err := j.store.PruneJobs(ctx, job.Started.Add(-jobTimeout-jobRetention)); err != nil {
+		j.done()
+		return Job{}, fmt.Errorf("prune import jobs: %w", err)
+	}
+	if err := j.store.CreateJob(ctx, job); err != nil {
+		j.done()
+		return Job{}, fmt.Errorf("record import job: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), jobTimeout)
+	ctx = logger.With(ctx, "import_job", job.ID)
+	go func() {
+		defer j.done()
+		defer cancel()
+		log := logger.FromContext(ctx).WithName(logName)
+
+		finished := job
+		finished.Report, finished.Err = Import(ctx, svc, bytes.NewReader(data), opts)
+		finished.Finished = time.Now()
+		finished.Status = JobSucceeded
+		if finished.Err != nil {
+			finished.Status = JobFailed
+			if !errors.As(finished.Err, &ErrRejected{}) {
+				log.Error(finished.Err, "catalog import failed")
+			}
+		}
+
+		// the import may have used up the job timeout
+		storeCtx, storeCancel := context.WithTimeout(context.WithoutCancel(ctx), time.Minute)
+		defer storeCancel()
+		if err := j.store.FinishJob(storeCtx, finished); err != nil {
+			log.Error(err, "record finished import job")
+		}
+	}()
+	return job, nil
+}
+
+// Get returns the job with the given id, or ErrJobNotFound.
+func (j *Jobs) Get(ctx context.Context, id uuid.UUID) (Job, error) {
+	job, err := j.store.GetJob(ctx, id)
+	if err != nil {
+		return Job{}, err
+	}
+
+	// the job could still be recording its outcome during the minute after
+	// its timeout, past that its process is gone
+	if job.Status == JobRunning && time.Since(job.Started) > jobTimeout+time.Minute {
+		job.Status = JobFailed
+		job.Finished = job.Started.Add(jobTimeout)
+		job.Err = ErrJobLost
+	}
+	return job, nil
+}
+
+// done counts a job of this process as no longer running.
+func (j *Jobs) done() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.running--
+}
@@ -0,0 +1,186 @@
+package catalog_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aborilov/hippo/business/medication/catalog"
+	"github.com/aborilov/hippo/business/medication/model"
+	"github.com/aborilov/hippo/business/sdk/auth"
+	"github.com/google/uuid"
+)
+
+// store keeps jobs in memory, standing in for the table shared by the
+// instances of the service.
+type store struct {
+	mu   sync.Mutex
+	jobs map[uuid.UUID]catalog.Job
+}
+
+func newStore() *store {
+	return &store{jobs: map[uuid.UUID]catalog.Job{}}
+}
+
+func (s *store) CreateJob(_ context.Context, job catalog.Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[job.ID] = job
+	return nil
+}
+
+func (s *store) FinishJob(ctx context.Context, job catalog.Job) error {
+	return s.CreateJob(ctx, job)
+}
+
+func (s *store) GetJob(_ context.Context, id uuid.UUID) (catalog.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return catalog.Job{}, catalog.ErrJobNotFound
+	}
+	return job, nil
+}
+
+func (s *store) PruneJobs(_ context.Context, startedBefore time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, job := range s.jobs {
+		if job.Started.Before(startedBefore) {
+			delete(s.jobs, id)
+		}
+	}
+	return nil
+}
+
+// allowAll authorizes every permission.
+type allowAll struct{}
+
+func (allowAll) Authorize(context.Context, auth.Permission) error { return nil }
+
+// blocked is a service whose imports wait until release is closed.
+type blocked struct {
+	model.Service
+	release chan struct{}
+}
+
+func (b blocked) List(context.Context, model.Filter) ([]*model.Medication, error) {
+	<-b.release
+	return nil, nil
+}
+
+// wait polls jobs until the job with id has finished.
+func wait(t *testing.T, jobs *catalog.Jobs, id uuid.UUID) catalog.Job {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := jobs.Get(context.Background(), id)
+		if err != nil {
+			t.Fatalf("get: %s", err)
+		}
+		if job.Status != catalog.JobRunning {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s still running", id)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestJobsReportedByEveryInstance(t *testing.T) {
+	s := newStore()
+	one := catalog.NewJobs(allowAll{}, s)
+	other := catalog.NewJobs(allowAll{}, s)
+
+	ctx := auth.SetPrincipal(context.Background(), auth.Principal{Subject: "importer"})
+	data := []byte("external_id,name,dosage,form\ncatalog:1,Aspirin,100,tablet\n")
+	job, err := one.Start(ctx, &service{}, data, catalog.Options{Format: catalog.FormatCSV, DryRun: true})
+	if err != nil {
+		t.Fatalf("start: %s", err)
+	}
+
+	got := wait(t, other, job.ID)
+	if got.Status != catalog.JobSucceeded || got.Err != nil {
+		t.Errorf("got %s with %v, want %s", got.Status, got.Err, catalog.JobSucceeded)
+	}
+	if got.Owner != "subject:importer" {
+		t.Errorf("got owner %q, want %q", got.Owner, "subject:importer")
+	}
+	if got.Report.Rows != 1 || got.Report.Plan.Count(catalog.OpCreate) != 1 {
+		t.Errorf("got report %+v, want one row to create", got.Report)
+	}
+
+	if _, err := other.Get(context.Background(), uuid.New()); !errors.Is(err, catalog.ErrJobNotFound) {
+		t.Errorf("got %v, want %v", err, catalog.ErrJobNotFound)
+	}
+}
+
+func TestJobsLost(t *testing.T) {
+	s := newStore()
+	jobs := catalog.NewJobs(allowAll{}, s)
+
+	tests := []struct {
+		name    string
+		started time.Duration
+		status  catalog.JobStatus
+		err     error
+	}{
+		{name: "running", started: time.Minute, status: catalog.JobRunning},
+		{name: "recording its outcome", started: 10*time.Minute + 30*time.Second, status: catalog.JobRunning},
+		{name: "lost", started: 12 * time.Minute, status: catalog.JobFailed, err: catalog.ErrJobLost},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := catalog.Job{ID: uuid.New(), Status: catalog.JobRunning, Started: time.Now().Add(-tt.started)}
+			if err := s.CreateJob(context.Background(), job); err != nil {
+				t.Fatalf("create: %s", err)
+			}
+
+			got, err := jobs.Get(context.Background(), job.ID)
+			if err != nil {
+				t.Fatalf("get: %s", err)
+			}
+			if got.Status != tt.status || !errors.Is(got.Err, tt.err) {
+				t.Errorf("got %s with %v, want %s with %v", got.Status, got.Err, tt.status, tt.err)
+			}
+		})
+	}
+}
+
+func TestJobsCappedPerInstance(t *testing.T) {
+	s := newStore()
+	one := catalog.NewJobs(allowAll{}, s)
+	other := catalog.NewJobs(allowAll{}, s)
+
+	svc := blocked{release: make(chan struct{})}
+	opts := catalog.Options{Format: catalog.FormatCSV, DryRun: true}
+	data := []byte("external_id,name,dosage,form\n")
+
+	var started []uuid.UUID
+	for range 4 {
+		job, err := one.Start(context.Background(), svc, data, opts)
+		if err != nil {
+			t.Fatalf("start: %s", err)
+		}
+		started = append(started, job.ID)
+	}
+	if _, err := one.Start(context.Background(), svc, data, opts); !errors.Is(err, catalog.ErrTooManyJobs) {
+		t.Errorf("got %v, want %v", err, catalog.ErrTooManyJobs)
+	}
+	job, err := other.Start(context.Background(), svc, data, opts)
+	if err != nil {
+		t.Fatalf("start on another instance: %s", err)
+	}
+	started = append(started, job.ID)
+
+	close(svc.release)
+	for _, id := range started {
+		wait(t, one, id)
+	}
+}
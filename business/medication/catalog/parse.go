@@ -0,0 +1,337 @@
+package catalog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aborilov/hippo/business/medication/model"
+)
+
+// Format is the encoding of a catalog file. Catalogs are imported from CSV
+// and NDJSON, and exported to those and XLSX.
+type Format string
+
+const (
+	FormatCSV    Format = "csv"
+	FormatNDJSON Format = "ndjson"
+	FormatXLSX   Format = "xlsx"
+)
+
+// ParseFormat returns the format named s.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case FormatCSV, FormatNDJSON, FormatXLSX:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown catalog format %q, want csv, ndjson or xlsx", s)
+}
+
+// FormatOf returns the format of a catalog file from its extension.
+func FormatOf(name string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv":
+		return FormatCSV, nil
+	case ".ndjson", ".jsonl":
+		return FormatNDJSON, nil
+	case ".xlsx":
+		return FormatXLSX, nil
+	}
+	return "", fmt.Errorf("unable to tell the format of %q, want a .csv, .ndjson or .xlsx file", name)
+}
+
+// MediaType returns the MIME type of files in the format.
+func (f Format) MediaType() string {
+	switch f {
+	case FormatCSV:
+		return "text/csv"
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "application/octet-stream"
+}
+
+// The medication fields a catalog column can map to.
+const (
+	FieldExternalID  = "external_id"
+	FieldName        = "name"
+	FieldDosage      = "dosage"
+	FieldForm        = "form"
+	FieldGenericName = "generic_name"
+	FieldRoute       = "route"
+	FieldStrength    = "strength"
+)
+
+// fields must be present in every catalog, while optionalFields may be left
+// out and are then empty.
+var (
+	fields         = []string{FieldExternalID, FieldName, FieldDosage, FieldForm}
+	optionalFields = []string{FieldGenericName, FieldRoute, FieldStrength}
+)
+
+func knownField(f string) bool {
+	return slices.Contains(fields, f) || slices.Contains(optionalFields, f)
+}
+
+// Mapping maps catalog column names to medication fields. Columns named
+// after a field map to it without an entry, and columns that map to nothing
+// are ignored. Column names are matched case insensitively, with spaces and
+// dashes read as underscores.
+type Mapping map[string]string
+
+// ParseMapping parses a mapping written as comma separated column=field
+// pairs, such as "Drug Name=name,Strength=dosage".
+func ParseMapping(s string) (Mapping, error) {
+	m := Mapping{}
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		col, field, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("mapping %q is not column=field", pair)
+		}
+		field = strings.TrimSpace(field)
+		if !knownField(field) {
+			return nil, fmt.Errorf("mapping %q: unknown field %q, want one of %s", pair, field,
+				strings.Join(append(slices.Clone(fields), optionalFields...), ", "))
+		}
+		m[normalize(col)] = field
+	}
+	return m, nil
+}
+
+// field returns the medication field of a column, or "" when it has none.
+func (m Mapping) field(column string) string {
+	col := normalize(column)
+	for c, f := range m {
+		if normalize(c) == col {
+			return f
+		}
+	}
+	if knownField(col) {
+		return col
+	}
+	return ""
+}
+
+func normalize(column string) string {
+	column = strings.ToLower(strings.TrimSpace(column))
+	return strings.NewReplacer(" ", "_", "-", "_").Replace(column)
+}
+
+// Row is a medication read from a catalog and the line it starts on.
+type Row struct {
+	Line       int
+	Medication *model.Medication
+}
+
+// RowError reports why a catalog row was rejected.
+type RowError struct {
+	Line   int
+	Field  string
+	Reason string
+}
+
+func (e RowError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Reason)
+	}
+	return fmt.Sprintf("line %d: %s %s", e.Line, e.Field, e.Reason)
+}
+
+// maxLine is the longest NDJSON line Parse accepts.
+const maxLine = 1 << 20
+
+// Parse reads every row of a catalog and validates it. Rows that can't be
+// turned into a valid medication are reported as row errors and left out, so
+// a single pass reports every problem. The returned error is only set when
+// the file itself is unreadable.
+func Parse(r io.Reader, format Format, mapping Mapping) ([]Row, []RowError, error) {
+	switch format {
+	case FormatCSV:
+		return parseCSV(r, mapping)
+	case FormatNDJSON:
+		return parseNDJSON(r, mapping)
+	}
+	return nil, nil, fmt.Errorf("unable to import %s catalogs, want csv or ndjson", format)
+}
+
+func parseCSV(r io.Reader, mapping Mapping) ([]Row, []RowError, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil, errors.New("catalog is empty")
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("read header: %w", err)
+	}
+	// spreadsheets often save a byte order mark ahead of the header
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+
+	columns := make([]string, len(header))
+	for i, h := range header {
+		columns[i] = mapping.field(h)
+	}
+	for _, f := range fields {
+		if !slices.Contains(columns, f) {
+			return nil, nil, fmt.Errorf("no column maps to the %s field", f)
+		}
+	}
+
+	var (
+		rows []Row
+		errs []RowError
+	)
+	for {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		line, _ := cr.FieldPos(0)
+		if errors.Is(err, csv.ErrFieldCount) {
+			errs = append(errs, RowError{Line: line, Reason: fmt.Sprintf("has %d columns, the header has %d", len(rec), len(header))})
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		values := map[string]string{}
+		for i, v := range rec {
+			if columns[i] != "" {
+				values[columns[i]] = v
+			}
+		}
+		m, rowErrs := toMedication(line, values)
+		if len(rowErrs) > 0 {
+			errs = append(errs, rowErrs...)
+			continue
+		}
+		rows = append(rows, Row{Line: line, Medication: m})
+	}
+	return rows, errs, nil
+}
+
+func parseNDJSON(r io.Reader, mapping Mapping) ([]Row, []RowError, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, maxLine)
+
+	var (
+		rows []Row
+		errs []RowError
+		line int
+	)
+	for sc.Scan() {
+		line++
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(sc.Bytes()))
+		dec.UseNumber()
+		var obj map[string]any
+		if err := dec.Decode(&obj); err != nil {
+			errs = append(errs, RowError{Line: line, Reason: fmt.Sprintf("is not a JSON object: %s", err)})
+			continue
+		}
+
+		values := map[string]string{}
+		var rowErrs []RowError
+		for k, v := range obj {
+			f := mapping.field(k)
+			if f == "" {
+				continue
+			}
+			switch v := v.(type) {
+			case string:
+				values[f] = v
+			case json.Number:
+				values[f] = v.String()
+			default:
+				rowErrs = append(rowErrs, RowError{Line: line, Field: f, Reason: "must be a string or a number"})
+			}
+		}
+		if len(rowErrs) > 0 {
+			errs = append(errs, rowErrs...)
+			continue
+		}
+		for _, f := range fields {
+			if _, ok := values[f]; !ok {
+				rowErrs = append(rowErrs, RowError{Line: line, Field: f, Reason: "is missing"})
+			}
+		}
+		if len(rowErrs) > 0 {
+			errs = append(errs, rowErrs...)
+			continue
+		}
+
+		m, rowErrs := toMedication(line, values)
+		if len(rowErrs) > 0 {
+			errs = append(errs, rowErrs...)
+			continue
+		}
+		rows = append(rows, Row{Line: line, Medication: m})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, nil, fmt.Errorf("line %d: %w", line+1, err)
+	}
+	return rows, errs, nil
+}
+
+// toMedication converts the field values of the row on line and validates
+// the result.
+func toMedication(line int, values map[string]string) (*model.Medication, []RowError) {
+	var errs []RowError
+
+	m := model.Medication{
+		ExternalID: strings.TrimSpace(values[FieldExternalID]),
+		Name:       strings.TrimSpace(values[FieldName]),
+
+		GenericName: strings.TrimSpace(values[FieldGenericName]),
+		Route:       strings.TrimSpace(values[FieldRoute]),
+		Strength:    strings.TrimSpace(values[FieldStrength]),
+	}
+	if m.ExternalID == "" {
+		errs = append(errs, RowError{Line: line, Field: FieldExternalID, Reason: "is required"})
+	}
+	if m.Name == "" {
+		errs = append(errs, RowError{Line: line, Field: FieldName, Reason: "is required"})
+	}
+
+	dosage := strings.TrimSpace(values[FieldDosage])
+	d, err := strconv.ParseInt(dosage, 10, 64)
+	if err != nil {
+		errs = append(errs, RowError{Line: line, Field: FieldDosage, Reason: fmt.Sprintf("%q is not a whole number", dosage)})
+	}
+	m.Dosage = d
+
+	form := strings.ToLower(strings.TrimSpace(values[FieldForm]))
+	f, err := model.FormString(form)
+	if err != nil {
+		errs = append(errs, RowError{Line: line, Field: FieldForm, Reason: fmt.Sprintf("%q is not a known form", form)})
+	}
+	m.Form = f
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	var invalid model.ErrInvalid
+	if err := m.Validate(); errors.As(err, &invalid) {
+		return nil, []RowError{{Line: line, Field: invalid.Field, Reason: invalid.Reason}}
+	}
+	return &m, nil
+}
@@ -0,0 +1,47 @@
+package pg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aborilov/hippo/business/medication/catalog"
+	"github.com/google/uuid"
+)
+
+// Job is a row of import_job. The report is stored as JSON.
+type Job struct {
+	ID         uuid.UUID  `db:"id"`
+	Owner      string     `db:"owner"`
+	Status     string     `db:"status"`
+	DryRun     bool       `db:"dry_run"`
+	StartedAt  time.Time  `db:"started_at"`
+	FinishedAt *time.Time `db:"finished_at"`
+	Report     []byte     `db:"report"`
+	Error      string     `db:"error"`
+}
+
+// toService restores the job. The error only keeps its message, which is all
+// the job is reported with.
+func (j *Job) toService() (catalog.Job, error) {
+	job := catalog.Job{
+		ID:      j.ID,
+		Owner:   j.Owner,
+		Status:  catalog.JobStatus(j.Status),
+		DryRun:  j.DryRun,
+		Started: j.StartedAt,
+	}
+	if j.FinishedAt != nil {
+		job.Finished = *j.FinishedAt
+	}
+	if j.Report != nil {
+		if err := json.Unmarshal(j.Report, &job.Report); err != nil {
+			return catalog.Job{}, fmt.Errorf("decode report of import job %s: %w", j.ID, err)
+		}
+	}
+	if j.Error != "" {
+		job.Err = errors.New(j.Error)
+	}
+	return job, nil
+}
@@ -0,0 +1,92 @@
+package pg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aborilov/hippo/business/medication/catalog"
+	"github.com/doug-martin/goqu/v9"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	table = "import_job"
+)
+
+func NewJobStore(db *sqlx.DB) (catalog.JobStore, error) {
+	if db == nil {
+		return nil, errors.New(`"db" cannot be nil`)
+	}
+
+	s := &store{
+		gq: goqu.New("postgres", db),
+	}
+	return s, nil
+}
+
+type store struct {
+	gq *goqu.Database
+}
+
+func (s *store) CreateJob(ctx context.Context, job catalog.Job) error {
+	_, err := s.gq.Insert(table).Rows(goqu.Record{
+		"id":         job.ID.String(),
+		"owner":      job.Owner,
+		"status":     string(job.Status),
+		"dry_run":    job.DryRun,
+		"started_at": job.Started.UTC(),
+	}).Executor().ExecContext(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to create import job: %w", err)
+	}
+	return nil
+}
+
+func (s *store) FinishJob(ctx context.Context, job catalog.Job) error {
+	report, err := json.Marshal(job.Report)
+	if err != nil {
+		return fmt.Errorf("encode report of import job %s: %w", job.ID, err)
+	}
+	var msg string
+	if job.Err != nil {
+		msg = job.Err.Error()
+	}
+
+	_, err = s.gq.Update(table).
+		Where(goqu.I("id").Eq(job.ID.String())).
+		Set(goqu.Record{
+			"status":      string(job.Status),
+			"finished_at": job.Finished.UTC(),
+			"report":      string(report),
+			"error":       msg,
+		}).
+		Executor().ExecContext(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to finish import job: %w", err)
+	}
+	return nil
+}
+
+func (s *store) GetJob(ctx context.Context, id uuid.UUID) (catalog.Job, error) {
+	record := &Job{}
+	found, err := s.gq.From(table).Where(goqu.I("id").Eq(id.String())).ScanStructContext(ctx, record)
+	if err != nil {
+		return catalog.Job{}, fmt.Errorf("unable to get import job: %w", err)
+	}
+	if !found {
+		return catalog.Job{}, catalog.ErrJobNotFound
+	}
+	return record.toService()
+}
+
+func (s *store) PruneJobs(ctx context.Context, startedBefore time.Time) error {
+	_, err := s.gq.Delete(table).Where(goqu.I("started_at").Lt(startedBefore.UTC())).Executor().ExecContext(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to prune import jobs: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package medication
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aborilov/hippo/business/medication/model"
+	"github.com/aborilov/hippo/business/sdk/fixture"
+)
+
+// medicationFixture is the JSON form of a medication fixture. ExternalID is
+// the stable key fixtures are upserted by.
+type medicationFixture struct {
+	ExternalID string     `json:"external_id"`
+	Name       string     `json:"name"`
+	Dosage     int64      `json:"dosage"`
+	Form       model.Form `json:"form"`
+}
+
+type fixtureLoader struct {
+	svc model.Service
+}
+
+// NewFixtureLoader returns the loader of medication fixtures. They are
+// upserted through svc, so they are validated and authorized like any other
+// write.
+func NewFixtureLoader(svc model.Service) fixture.Loader {
+	return fixtureLoader{svc: svc}
+}
+
+func (l fixtureLoader) Name() string {
+	return "medication"
+}
+
+func (l fixtureLoader) Load(ctx context.Context, data []byte) (int, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	var fixtures []medicationFixture
+	if err := dec.Decode(&fixtures); err != nil {
+		return 0, fmt.Errorf("decode fixtures: %w", err)
+	}
+
+	for i, f := range fixtures {
+		_, err := l.svc.Upsert(ctx, &model.Medication{
+			Name:       f.Name,
+			Dosage:     f.Dosage,
+			Form:       f.Form,
+			ExternalID: f.ExternalID,
+		})
+		if err != nil {
+			return i, fmt.Errorf("fixture %d: %w", i+1, err)
+		}
+	}
+	return len(fixtures), nil
+}
@@ -0,0 +1,134 @@
+package medication
+
+import (
+	"fmt"
+	"iter"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+
+	"github.com/aborilov/hippo/business/medication/model"
+	"github.com/google/uuid"
+)
+
+// GeneratedPrefix starts the external id of every generated medication, so
+// generated rows can be purged without touching real data.
+const GeneratedPrefix = "generated:"
+
+// product is a medication as it is commonly dispensed: the forms it comes in
+// and their usual strengths.
+type product struct {
+	name      string
+	forms     []model.Form
+	strengths []int64
+}
+
+// products is ordered by how often the medication is dispensed, which the
+// generator follows with a Zipf distribution.
+var products = []product{
+	{"Atorvastatin", []model.Form{model.FormTablet}, []int64{10, 20, 40, 80}},
+	{"Levothyroxine", []model.Form{model.FormTablet}, []int64{25, 50, 75, 100, 125}},
+	{"Lisinopril", []model.Form{model.FormTablet}, []int64{5, 10, 20, 40}},
+	{"Metformin", []model.Form{model.FormTablet, model.FormLiquid}, []int64{500, 850, 1000}},
+	{"Amlodipine", []model.Form{model.FormTablet}, []int64{5, 10}},
+	{"Omeprazole", []model.Form{model.FormCapsule}, []int64{10, 20, 40}},
+	{"Simvastatin", []model.Form{model.FormTablet}, []int64{10, 20, 40}},
+	{"Amoxicillin", []model.Form{model.FormCapsule, model.FormLiquid}, []int64{125, 250, 500}},
+	{"Losartan", []model.Form{model.FormTablet}, []int64{25, 50, 100}},
+	{"Albuterol", []model.Form{model.FormLiquid}, []int64{2, 4}},
+	{"Gabapentin", []model.Form{model.FormCapsule, model.FormTablet}, []int64{100, 300, 400, 600}},
+	{"Hydrochlorothiazide", []model.Form{model.FormTablet, model.FormCapsule}, []int64{12, 25, 50}},
+	{"Sertraline", []model.Form{model.FormTablet, model.FormLiquid}, []int64{25, 50, 100}},
+	{"Ibuprofen", []model.Form{model.FormTablet, model.FormCapsule, model.FormLiquid}, []int64{100, 200, 400, 600}},
+	{"Paracetamol", []model.Form{model.FormTablet, model.FormLiquid, model.FormSuppository}, []int64{120, 250, 500, 1000}},
+	{"Montelukast", []model.Form{model.FormTablet}, []int64{4, 5, 10}},
+	{"Fluoxetine", []model.Form{model.FormCapsule, model.FormLiquid}, []int64{10, 20, 40}},
+	{"Pantoprazole", []model.Form{model.FormTablet}, []int64{20, 40}},
+	{"Escitalopram", []model.Form{model.FormTablet, model.FormLiquid}, []int64{5, 10, 20}},
+	{"Prednisone", []model.Form{model.FormTablet, model.FormLiquid}, []int64{1, 5, 10, 20}},
+	{"Tramadol", []model.Form{model.FormTablet, model.FormCapsule}, []int64{50, 100}},
+	{"Cetirizine", []model.Form{model.FormTablet, model.FormLiquid}, []int64{5, 10}},
+	{"Clopidogrel", []model.Form{model.FormTablet}, []int64{75}},
+	{"Azithromycin", []model.Form{model.FormTablet, model.FormLiquid}, []int64{200, 250, 500}},
+	{"Doxycycline", []model.Form{model.FormCapsule, model.FormTablet}, []int64{50, 100}},
+	{"Cephalexin", []model.Form{model.FormCapsule, model.FormLiquid}, []int64{250, 500}},
+	{"Furosemide", []model.Form{model.FormTablet, model.FormLiquid}, []int64{20, 40, 80}},
+	{"Warfarin", []model.Form{model.FormTablet}, []int64{1, 2, 5}},
+	{"Diazepam", []model.Form{model.FormTablet, model.FormLiquid}, []int64{2, 5, 10}},
+	{"Nitrofurantoin", []model.Form{model.FormCapsule}, []int64{50, 100}},
+	{"Hydrocortisone", []model.Form{model.FormCream, model.FormOintment}, []int64{10, 25}},
+	{"Enoxaparin", []model.Form{model.FormInjection}, []int64{40, 60, 80, 100}},
+	{"Diclofenac", []model.Form{model.FormGel}, []int64{10, 30}},
+	{"Sumatriptan", []model.Form{model.FormSpray, model.FormInjection}, []int64{6, 20}},
+	{"Nicotine", []model.Form{model.FormPatch}, []int64{7, 14, 21}},
+	{"Ceftriaxone", []model.Form{model.FormInjection}, []int64{250, 500, 1000}},
+	{"Macrogol", []model.Form{model.FormPowder}, []int64{13125, 17000}},
+	{"Mupirocin", []model.Form{model.FormOintment, model.FormCream}, []int64{20}},
+	{"Bisacodyl", []model.Form{model.FormSuppository, model.FormTablet}, []int64{5, 10}},
+	{"Lidocaine", []model.Form{model.FormPatch, model.FormGel}, []int64{700}},
+}
+
+// Generate yields count plausible medications in batches of up to size,
+// producing each batch only when it is asked for. The same seed always yields
+// the same medications, identifiers included, and the external id of the
+// i-th one is GeneratedExternalID(seed, i).
+func Generate(seed uint64, count int, size int) iter.Seq[[]*model.Medication] {
+	return func(yield func([]*model.Medication) bool) {
+		rng := rand.New(rand.NewPCG(seed, seed))
+		zipf := rand.NewZipf(rng, 1.2, 2, uint64(len(products)-1))
+
+		for start := 0; start < count; start += size {
+			batch := make([]*model.Medication, min(size, count-start))
+			for i := range batch {
+				p := products[zipf.Uint64()]
+
+				var id uuid.UUID
+				for j := 0; j < len(id); j += 8 {
+					v := rng.Uint64()
+					for k := range 8 {
+						id[j+k] = byte(v >> (8 * k))
+					}
+				}
+				id[6] = id[6]&0x0f | 0x40 // version 4
+				id[8] = id[8]&0x3f | 0x80 // RFC 4122 variant
+
+				batch[i] = &model.Medication{
+					ID:         id,
+					Name:       p.name,
+					Dosage:     p.strengths[rng.IntN(len(p.strengths))],
+					Form:       p.forms[rng.IntN(len(p.forms))],
+					ExternalID: GeneratedExternalID(seed, start+i),
+				}
+			}
+			if !yield(batch) {
+				return
+			}
+		}
+	}
+}
+
+// GeneratedSeedPrefix starts the external id of every medication generated
+// with seed.
+func GeneratedSeedPrefix(seed uint64) string {
+	return fmt.Sprintf("%s%d:", GeneratedPrefix, seed)
+}
+
+// GeneratedExternalID returns the external id of the i-th medication
+// generated with seed.
+func GeneratedExternalID(seed uint64, i int) string {
+	return GeneratedSeedPrefix(seed) + strconv.Itoa(i)
+}
+
+// GeneratedIndex returns the position of a medication generated with seed
+// from its external id, and false when it wasn't generated with seed.
+func GeneratedIndex(seed uint64, externalID string) (int, bool) {
+	s, ok := strings.CutPrefix(externalID, GeneratedSeedPrefix(seed))
+	if !ok {
+		return 0, false
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil || i < 0 {
+		return 0, false
+	}
+	return i, true
+}
@@ -0,0 +1,154 @@
+package medication
+
+import (
+	"context"
+	"time"
+
+	"github.com/aborilov/hippo/business/medication/model"
+	"github.com/aborilov/hippo/foundation/metrics"
+	"github.com/google/uuid"
+)
+
+// instrumented records call counts and latencies of a model.Service.
+type instrumented struct {
+	next     model.Service
+	calls    *metrics.CounterVec
+	duration *metrics.HistogramVec
+}
+
+// NewInstrumentedService wraps next so every call is counted and timed in
+// reg, labelled by method.
+func NewInstrumentedService(next model.Service, reg *metrics.Registry) model.Service {
+	s := instrumented{
+		next: next,
+		calls: metrics.NewCounterVec("hippo_medication_service_calls_total",
+			"Number of medication service calls.", "method", "result"),
+		duration: metrics.NewHistogramVec("hippo_medication_service_call_duration_seconds",
+			"Latency of medication service calls.", metrics.DefBuckets, "method"),
+	}
+	reg.Register(s.calls, s.duration)
+	return &s
+}
+
+func (s *instrumented) observe(method string, start time.Time, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	s.calls.Inc(method, result)
+	s.duration.Observe(time.Since(start).Seconds(), method)
+}
+
+func (s *instrumented) Create(ctx context.Context, m *model.Medication) (_ *model.Medication, err error) {
+	start := time.Now()
+	defer func() { s.observe("Create", start, err) }()
+	return s.next.Create(ctx, m)
+}
+
+func (s *instrumented) BulkCreate(ctx context.Context, meds []*model.Medication) (_ int64, err error) {
+	start := time.Now()
+	defer func() { s.observe("BulkCreate", start, err) }()
+	return s.next.BulkCreate(ctx, meds)
+}
+
+func (s *instrumented) List(ctx context.Context, f model.Filter) (_ []*model.Medication, err error) {
+	start := time.Now()
+	defer func() { s.observe("List", start, err) }()
+	return s.next.List(ctx, f)
+}
+
+func (s *instrumented) Export(ctx context.Context, f model.Filter, fn func(*model.Medication) error) (err error) {
+	start := time.Now()
+	defer func() { s.observe("Export", start, err) }()
+	return s.next.Export(ctx, f, fn)
+}
+
+func (s *instrumented) Get(ctx context.Context, id uuid.UUID) (_ *model.Medication, err error) {
+	start := time.Now()
+	defer func() { s.observe("Get", start, err) }()
+	return s.next.Get(ctx, id)
+}
+
+func (s *instrumented) Update(ctx context.Context, m *model.Medication) (_ *model.Medication, err error) {
+	start := time.Now()
+	defer func() { s.observe("Update", start, err) }()
+	return s.next.Update(ctx, m)
+}
+
+func (s *instrumented) Upsert(ctx context.Context, m *model.Medication) (_ *model.Medication, err error) {
+	start := time.Now()
+	defer func() { s.observe("Upsert", start, err) }()
+	return s.next.Upsert(ctx, m)
+}
+
+func (s *instrumented) Delete(ctx context.Context, id uuid.UUID) (err error) {
+	start := time.Now()
+	defer func() { s.observe("Delete", start, err) }()
+	return s.next.Delete(ctx, id)
+}
+
+func (s *instrumented) Purge(ctx context.Context, externalIDPrefix string) (_ int64, err error) {
+	start := time.Now()
+	defer func() { s.observe("Purge", start, err) }()
+	return s.next.Purge(ctx, externalIDPrefix)
+}
+
+func (s *instrumented) Apply(ctx context.Context, c model.Changes) (err error) {
+	start := time.Now()
+	defer func() { s.observe("Apply", start, err) }()
+	return s.next.Apply(ctx, c)
+}
+
+func (s *instrumented) Codes(ctx context.Context, id uuid.UUID) (_ []model.Code, err error) {
+	start := time.Now()
+	defer func() { s.observe("Codes", start, err) }()
+	return s.next.Codes(ctx, id)
+}
+
+func (s *instrumented) SetCodes(ctx context.Context, id uuid.UUID, codes []model.Code) (_ []model.Code, err error) {
+	start := time.Now()
+	defer func() { s.observe("SetCodes", start, err) }()
+	return s.next.SetCodes(ctx, id, codes)
+}
+
+func (s *instrumented) Lookup(ctx context.Context, scan string) (_ *model.Medication, _ model.Code, err error) {
+	start := time.Now()
+	defer func() { s.observe("Lookup", start, err) }()
+	return s.next.Lookup(ctx, scan)
+}
+
+func (s *instrumented) Scan(ctx context.Context, data string) (_ *model.Medication, _ model.Package, err error) {
+	start := time.Now()
+	defer func() { s.observe("Scan", start, err) }()
+	return s.next.Scan(ctx, data)
+}
+
+func (s *instrumented) ImportATC(ctx context.Context, classes []model.ATC) (_ int64, err error) {
+	start := time.Now()
+	defer func() { s.observe("ImportATC", start, err) }()
+	return s.next.ImportATC(ctx, classes)
+}
+
+func (s *instrumented) ATCClasses(ctx context.Context, codes []string) (_ []model.ATC, err error) {
+	start := time.Now()
+	defer func() { s.observe("ATCClasses", start, err) }()
+	return s.next.ATCClasses(ctx, codes)
+}
+
+func (s *instrumented) ATCNode(ctx context.Context, code string) (_ model.ATCNode, err error) {
+	start := time.Now()
+	defer func() { s.observe("ATCNode", start, err) }()
+	return s.next.ATCNode(ctx, code)
+}
+
+func (s *instrumented) Classification(ctx context.Context, id uuid.UUID) (_ []model.ATC, err error) {
+	start := time.Now()
+	defer func() { s.observe("Classification", start, err) }()
+	return s.next.Classification(ctx, id)
+}
+
+func (s *instrumented) SetClassification(ctx context.Context, id uuid.UUID, codes []string) (_ []model.ATC, err error) {
+	start := time.Now()
+	defer func() { s.observe("SetClassification", start, err) }()
+	return s.next.SetClassification(ctx, id, codes)
+}
@@ -0,0 +1,81 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ATC is a class of the Anatomical Therapeutic Chemical classification,
+// such as "N02BE" (anilides) or "N02BE01" (paracetamol).
+type ATC struct {
+	Code string
+	Name string
+}
+
+// Level returns the level of the class, from 1 for anatomical main groups
+// to 5 for chemical substances.
+func (a ATC) Level() int {
+	return ATCLevel(a.Code)
+}
+
+// atcLengths are the code lengths of the five levels.
+var atcLengths = [...]int{1, 3, 4, 5, 7}
+
+// ATCLevel returns the level of a valid code, or 0.
+func ATCLevel(code string) int {
+	for i, n := range atcLengths {
+		if len(code) == n {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// ATCParent returns the code of the class above code, empty for the
+// anatomical main groups.
+func ATCParent(code string) string {
+	level := ATCLevel(code)
+	if level <= 1 {
+		return ""
+	}
+	return code[:atcLengths[level-2]]
+}
+
+// ATCPath returns the codes of the classes above code, top level first,
+// followed by code itself.
+func ATCPath(code string) []string {
+	var path []string
+	for _, n := range atcLengths {
+		if n > len(code) {
+			break
+		}
+		path = append(path, code[:n])
+	}
+	return path
+}
+
+// ParseATC validates a code of any level and returns it in upper case. A
+// code is a letter, two digits, two letters and two digits, cut short at
+// the level it stands for.
+func ParseATC(s string) (string, error) {
+	code := strings.ToUpper(strings.TrimSpace(s))
+	if ATCLevel(code) == 0 {
+		return "", ErrInvalid{Field: "atc", Reason: fmt.Sprintf("%q is not 1, 3, 4, 5 or 7 characters long", s)}
+	}
+	for i := range len(code) {
+		c := code[i]
+		digit := i == 1 || i == 2 || i == 5 || i == 6
+		if digit && (c < '0' || c > '9') || !digit && (c < 'A' || c > 'Z') {
+			return "", ErrInvalid{Field: "atc", Reason: fmt.Sprintf("%q is not an atc code", s)}
+		}
+	}
+	return code, nil
+}
+
+// ATCNode is a class of the classification with the classes above and below
+// it. The root node, whose class is zero, holds the anatomical main groups.
+type ATCNode struct {
+	Class    ATC
+	Path     []ATC
+	Children []ATC
+}
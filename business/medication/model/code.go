@@ -0,0 +1,113 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aborilov/hippo/foundation/gs1"
+	"github.com/aborilov/hippo/foundation/ndc"
+)
+
+// CodeType is the kind of a product code.
+type CodeType string
+
+const (
+	// CodeNDC is a National Drug Code, stored in the 11 digit 5-4-2 form
+	// such as "00071-0155-23".
+	CodeNDC CodeType = "ndc"
+
+	// CodeGTIN is a GS1 trade item number, stored as 14 digits.
+	CodeGTIN CodeType = "gtin"
+
+	// CodeSKU is a stock keeping unit assigned by the pharmacy.
+	CodeSKU CodeType = "sku"
+)
+
+// maxSKULength is the longest SKU accepted.
+const maxSKULength = 64
+
+// Code identifies the packages of a medication, as printed on them or
+// encoded in their barcode. A code belongs to a single medication.
+type Code struct {
+	Type  CodeType
+	Value string
+}
+
+func (c Code) String() string {
+	return string(c.Type) + ":" + c.Value
+}
+
+// Normalize validates the code and returns it in the form it is stored and
+// looked up in, so the same package is found however its code is written.
+func (c Code) Normalize() (Code, error) {
+	var err error
+	switch c.Type {
+	case CodeNDC:
+		var n ndc.NDC
+		if n, err = ndc.Parse(c.Value); err == nil {
+			return Code{Type: CodeNDC, Value: n.String()}, nil
+		}
+	case CodeGTIN:
+		var gtin string
+		if gtin, err = gs1.NormalizeGTIN(c.Value); err == nil {
+			return Code{Type: CodeGTIN, Value: gtin}, nil
+		}
+	case CodeSKU:
+		sku := strings.TrimSpace(c.Value)
+		switch {
+		case sku == "":
+			err = fmt.Errorf("sku is empty")
+		case len(sku) > maxSKULength:
+			err = fmt.Errorf("sku %q is longer than %d characters", sku, maxSKULength)
+		default:
+			return Code{Type: CodeSKU, Value: sku}, nil
+		}
+	default:
+		return Code{}, ErrInvalid{Field: "code", Reason: fmt.Sprintf("type %q is not ndc, gtin or sku", c.Type)}
+	}
+	return Code{}, ErrInvalid{Field: "code", Reason: err.Error()}
+}
+
+// ScanCodes returns the codes a scanned or typed value may stand for, most
+// specific first: a GTIN, the NDC it encodes, an NDC, and a SKU.
+//
+// Drug packages in the US carry a UPC-A or GTIN made of the number system 3
+// and the unhyphenated NDC-10, which can be read in three configurations, so
+// a single scan may yield several NDCs.
+func ScanCodes(scan string) []Code {
+	scan = strings.TrimSpace(scan)
+	var out []Code
+	add := func(c Code) {
+		for _, o := range out {
+			if o == c {
+				return
+			}
+		}
+		out = append(out, c)
+	}
+	addNDC10 := func(digits string) {
+		ndcs, err := ndc.Candidates(digits)
+		if err != nil {
+			return
+		}
+		for _, n := range ndcs {
+			add(Code{Type: CodeNDC, Value: n.String()})
+		}
+	}
+
+	if gtin, err := gs1.NormalizeGTIN(scan); err == nil {
+		add(Code{Type: CodeGTIN, Value: gtin})
+		// indicator digit, 03, NDC-10, check digit
+		if gtin[1:3] == "03" {
+			addNDC10(gtin[3:13])
+		}
+	}
+	if n, err := ndc.Parse(scan); err == nil {
+		add(Code{Type: CodeNDC, Value: n.String()})
+	}
+	addNDC10(scan)
+	if sku, err := (Code{Type: CodeSKU, Value: scan}).Normalize(); err == nil {
+		add(sku)
+	}
+	return out
+}
@@ -8,9 +8,9 @@ import (
 	"fmt"
 )
 
-const _FormName = "tabletcapsuleliquid"
+const _FormName = "tabletcapsuleliquidinjectioncreamointmentgelpatchpowderspraysuppository"
 
-var _FormIndex = [...]uint8{0, 6, 13, 19}
+var _FormIndex = [...]uint8{0, 6, 13, 19, 28, 33, 41, 44, 49, 55, 60, 71}
 
 func (i Form) String() string {
 	i -= 1
@@ -20,12 +20,20 @@ func (i Form) String() string {
 	return _FormName[_FormIndex[i]:_FormIndex[i+1]]
 }
 
-var _FormValues = []Form{1, 2, 3}
+var _FormValues = []Form{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}
 
 var _FormNameToValueMap = map[string]Form{
 	_FormName[0:6]:   1,
 	_FormName[6:13]:  2,
 	_FormName[13:19]: 3,
+	_FormName[19:28]: 4,
+	_FormName[28:33]: 5,
+	_FormName[33:41]: 6,
+	_FormName[41:44]: 7,
+	_FormName[44:49]: 8,
+	_FormName[49:55]: 9,
+	_FormName[55:60]: 10,
+	_FormName[60:71]: 11,
 }
 
 // FormString retrieves an enum value from the enum constants string name.
@@ -1,6 +1,14 @@
 package model
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrExternalIDRequired is returned by Upsert for a medication without an
+// external id.
+var ErrExternalIDRequired = errors.New("external id is required")
 
 type ErrNotFound struct {
 	MedicationID string
@@ -9,3 +17,73 @@ type ErrNotFound struct {
 func (e ErrNotFound) Error() string {
 	return fmt.Sprintf("medication not found (ID: %s)", e.MedicationID)
 }
+
+type ErrInvalid struct {
+	Field  string
+	Reason string
+}
+
+func (e ErrInvalid) Error() string {
+	return fmt.Sprintf("invalid medication: %s %s", e.Field, e.Reason)
+}
+
+type ErrExternalIDConflict struct {
+	ExternalID string
+}
+
+func (e ErrExternalIDConflict) Error() string {
+	return fmt.Sprintf("medication already exists (external ID: %s)", e.ExternalID)
+}
+
+// ErrScopeChanged is returned by Apply when the medications of the scope the
+// changes were planned for changed in the meantime.
+type ErrScopeChanged struct {
+	Scope string
+}
+
+func (e ErrScopeChanged) Error() string {
+	return fmt.Sprintf("medications changed while applying changes (scope: %s)", e.Scope)
+}
+
+// ErrCodeConflict is returned when a code is already given to another
+// medication.
+type ErrCodeConflict struct {
+	Code Code
+}
+
+func (e ErrCodeConflict) Error() string {
+	return fmt.Sprintf("code already belongs to another medication (code: %s)", e.Code)
+}
+
+// ErrCodeAmbiguous is returned by Lookup when a scanned value reads as codes
+// of different medications.
+type ErrCodeAmbiguous struct {
+	Code  string
+	Codes []Code
+}
+
+func (e ErrCodeAmbiguous) Error() string {
+	codes := make([]string, len(e.Codes))
+	for i, c := range e.Codes {
+		codes[i] = c.String()
+	}
+	return fmt.Sprintf("%q matches more than one medication (codes: %s)", e.Code, strings.Join(codes, ", "))
+}
+
+// ErrCodeNotFound is returned by Lookup when no medication has the code.
+type ErrCodeNotFound struct {
+	Code string
+}
+
+func (e ErrCodeNotFound) Error() string {
+	return fmt.Sprintf("no medication has the code %q", e.Code)
+}
+
+// ErrATCNotFound is returned for a code missing from the classification.
+type ErrATCNotFound struct {
+	Code string
+}
+
+func (e ErrATCNotFound) Error() string {
+	return fmt.Sprintf("atc class not found (code: %s)", e.Code)
+}
@@ -8,16 +8,43 @@ import (
 
 type Service interface {
 	Create(context.Context, *Medication) (*Medication, error)
-	List(context.Context) ([]*Medication, error)
+	BulkCreate(context.Context, []*Medication) (int64, error)
+	List(context.Context, Filter) ([]*Medication, error)
+	Export(ctx context.Context, f Filter, fn func(*Medication) error) error
 	Get(context.Context, uuid.UUID) (*Medication, error)
 	Update(context.Context, *Medication) (*Medication, error)
+	Upsert(context.Context, *Medication) (*Medication, error)
 	Delete(context.Context, uuid.UUID) error
+	Purge(ctx context.Context, externalIDPrefix string) (int64, error)
+	Apply(context.Context, Changes) error
+	Codes(context.Context, uuid.UUID) ([]Code, error)
+	SetCodes(context.Context, uuid.UUID, []Code) ([]Code, error)
+	Lookup(ctx context.Context, scan string) (*Medication, Code, error)
+	Scan(ctx context.Context, data string) (*Medication, Package, error)
+	ImportATC(context.Context, []ATC) (int64, error)
+	ATCClasses(ctx context.Context, codes []string) ([]ATC, error)
+	ATCNode(ctx context.Context, code string) (ATCNode, error)
+	Classification(context.Context, uuid.UUID) ([]ATC, error)
+	SetClassification(ctx context.Context, id uuid.UUID, codes []string) ([]ATC, error)
 }
 
 type Repository interface {
 	Create(context.Context, *Medication) (*Medication, error)
-	List(context.Context) ([]*Medication, error)
+	BulkCreate(context.Context, []*Medication) (int64, error)
+	List(context.Context, Filter) ([]*Medication, error)
+	Export(ctx context.Context, f Filter, fn func(*Medication) error) error
 	Get(context.Context, uuid.UUID) (*Medication, error)
 	Update(context.Context, *Medication) (*Medication, error)
+	Upsert(context.Context, *Medication) (*Medication, error)
 	Delete(context.Context, uuid.UUID) error
+	Purge(ctx context.Context, externalIDPrefix string) (int64, error)
+	Apply(context.Context, Changes) error
+	Codes(context.Context, uuid.UUID) ([]Code, error)
+	SetCodes(context.Context, uuid.UUID, []Code) error
+	Lookup(context.Context, Code) (*Medication, error)
+	ImportATC(context.Context, []ATC) (int64, error)
+	ATCClasses(ctx context.Context, codes []string) ([]ATC, error)
+	ATCChildren(ctx context.Context, code string) ([]ATC, error)
+	Classification(context.Context, uuid.UUID) ([]ATC, error)
+	SetClassification(ctx context.Context, id uuid.UUID, codes []string) error
 }
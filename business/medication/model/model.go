@@ -1,6 +1,10 @@
 package model
 
-import "github.com/google/uuid"
+import (
+	"strings"
+
+	"github.com/google/uuid"
+)
 
 type Form uint8
 
@@ -8,6 +12,14 @@ const (
 	FormTablet Form = 1 + iota
 	FormCapsule
 	FormLiquid
+	FormInjection
+	FormCream
+	FormOintment
+	FormGel
+	FormPatch
+	FormPowder
+	FormSpray
+	FormSuppository
 )
 
 //go:generate enumer -type=Form -trimprefix=Form -text -json -sql -transform=snake -output=enum_form_gen.go
@@ -17,4 +29,79 @@ type Medication struct {
 	Name   string
 	Dosage int64
 	Form   Form
+
+	// GenericName, Route and Strength describe the product as labelled,
+	// such as "Amoxicillin", "ORAL" and "AMOXICILLIN 500 mg/1". They are
+	// informational and may be empty.
+	GenericName string
+	Route       string
+	Strength    string
+
+	// ExternalID identifies the medication in the system it is synced from.
+	// It is unique when set.
+	ExternalID string
+}
+
+// Validate checks the fields a medication needs before it can be stored.
+func (m *Medication) Validate() error {
+	switch {
+	case strings.TrimSpace(m.Name) == "":
+		return ErrInvalid{Field: "name", Reason: "is required"}
+	case m.Dosage <= 0:
+		return ErrInvalid{Field: "dosage", Reason: "must be positive"}
+	case !m.Form.IsAForm():
+		return ErrInvalid{Field: "form", Reason: "is not a known form"}
+	}
+	return nil
+}
+
+// Filter narrows the medications returned by List and Export. Zero fields
+// match every medication.
+type Filter struct {
+	// Name matches medications whose name contains it, ignoring case.
+	Name string
+	Form Form
+
+	ExternalIDPrefix string
+
+	// ATC matches medications classified under the ATC code it prefixes.
+	ATC string
+}
+
+// Changes is a set of writes that are applied together or not at all.
+type Changes struct {
+	Create []*Medication
+	Update []*Medication
+	Delete []uuid.UUID
+
+	// Scope, when set, is the external id prefix the changes were planned
+	// for and Snapshot the medications of that scope they were planned
+	// against. Changes to the same scope are then applied one at a time,
+	// and fail with ErrScopeChanged once the scope no longer matches the
+	// snapshot.
+	Scope    string
+	Snapshot []*Medication
+}
+
+// Matches reports whether current, the medications of the scope as they are
+// now, are the ones of the snapshot.
+func (c Changes) Matches(current []*Medication) bool {
+	if len(current) != len(c.Snapshot) {
+		return false
+	}
+	byID := make(map[uuid.UUID]Medication, len(c.Snapshot))
+	for _, m := range c.Snapshot {
+		byID[m.ID] = *m
+	}
+	for _, m := range current {
+		if s, ok := byID[m.ID]; !ok || s != *m {
+			return false
+		}
+	}
+	return true
+}
+
+// Empty reports whether there is nothing to apply.
+func (c Changes) Empty() bool {
+	return len(c.Create) == 0 && len(c.Update) == 0 && len(c.Delete) == 0
 }
@@ -0,0 +1,45 @@
+package model
+
+import (
+	"time"
+
+	"github.com/aborilov/hippo/foundation/gs1"
+)
+
+// Package is a drug package identified by the GS1 barcode printed on it.
+type Package struct {
+	GTIN   string
+	Lot    string
+	Serial string
+
+	// Expiry is the last day the package may be used, zero when the barcode
+	// doesn't carry one.
+	Expiry time.Time
+}
+
+// ParsePackage parses the GS1 element string of a package barcode, which
+// must hold a GTIN. Check digits and dates are validated.
+func ParsePackage(data string, now time.Time) (Package, error) {
+	es, err := gs1.ParseElementString(data, now)
+	if err != nil {
+		return Package{}, ErrInvalid{Field: "barcode", Reason: err.Error()}
+	}
+	gtin, ok := es.Get(gs1.AIGTIN)
+	if !ok {
+		return Package{}, ErrInvalid{Field: "barcode", Reason: "holds no gtin"}
+	}
+
+	p := Package{GTIN: gtin}
+	p.Lot, _ = es.Get(gs1.AILot)
+	p.Serial, _ = es.Get(gs1.AISerial)
+	if v, ok := es.Get(gs1.AIExpiry); ok {
+		// already validated by the parser
+		p.Expiry, _ = gs1.ParseDate(v, now)
+	}
+	return p, nil
+}
+
+// Expired reports whether the package is past its expiry date at now.
+func (p Package) Expired(now time.Time) bool {
+	return !p.Expiry.IsZero() && !now.Before(p.Expiry.AddDate(0, 0, 1))
+}
@@ -0,0 +1,7 @@
+package openfda
+
+// Exported for the tests of package openfda_test.
+var (
+	ToMedication = toMedication
+	Milligrams   = milligrams
+)
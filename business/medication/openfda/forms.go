@@ -0,0 +1,126 @@
+package openfda
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/aborilov/hippo/business/medication/model"
+)
+
+// FormMap maps FDA dosage form names, in upper case, to medication forms.
+type FormMap map[string]model.Form
+
+// DefaultForms maps the FDA dosage forms with an obvious medication form.
+// Variants such as "TABLET, FILM COATED" fall back to the name before the
+// first comma, so only base names and exceptions are listed. Products made up
+// before use, such as "FOR SUSPENSION" or "TABLET, FOR SUSPENSION", are
+// powders and are listed by their full names, while injections made up before
+// use stay injections. Forms like LOTION or KIT are left for the importer to
+// map.
+var DefaultForms = FormMap{
+	"TABLET":          model.FormTablet,
+	"LOZENGE":         model.FormTablet,
+	"TROCHE":          model.FormTablet,
+	"CAPSULE":         model.FormCapsule,
+	"SOLUTION":        model.FormLiquid,
+	"SUSPENSION":      model.FormLiquid,
+	"SYRUP":           model.FormLiquid,
+	"ELIXIR":          model.FormLiquid,
+	"LIQUID":          model.FormLiquid,
+	"CONCENTRATE":     model.FormLiquid,
+	"TINCTURE":        model.FormLiquid,
+	"SOLUTION/ DROPS": model.FormLiquid,
+	"INJECTION":       model.FormInjection,
+	"INJECTABLE":      model.FormInjection,
+	"CREAM":           model.FormCream,
+	"OINTMENT":        model.FormOintment,
+	"GEL":             model.FormGel,
+	"JELLY":           model.FormGel,
+	"PATCH":           model.FormPatch,
+	"POWDER":          model.FormPowder,
+	"GRANULE":         model.FormPowder,
+	"FOR SOLUTION":    model.FormPowder,
+	"FOR SUSPENSION":  model.FormPowder,
+	"SPRAY":           model.FormSpray,
+	"AEROSOL":         model.FormSpray,
+	"SUPPOSITORY":     model.FormSuppository,
+
+	"TABLET, FOR SOLUTION":             model.FormPowder,
+	"TABLET, FOR SUSPENSION":           model.FormPowder,
+	"CAPSULE, FOR SOLUTION":            model.FormPowder,
+	"GRANULE, FOR SOLUTION":            model.FormPowder,
+	"GRANULE, FOR SUSPENSION":          model.FormPowder,
+	"POWDER, FOR SOLUTION":             model.FormPowder,
+	"POWDER, FOR SUSPENSION":           model.FormPowder,
+	"FOR SUSPENSION, EXTENDED RELEASE": model.FormPowder,
+}
+
+// ParseFormMap parses form mappings written as comma separated
+// fdaform=form pairs, such as "LOTION=cream,KIT=tablet". Pairs are
+// separated by semicolons instead when FDA names hold commas, as in
+// "TABLET, FOR SUSPENSION=liquid;LOTION=cream".
+func ParseFormMap(s string) (FormMap, error) {
+	sep := ","
+	if strings.Contains(s, ";") {
+		sep = ";"
+	}
+
+	m := FormMap{}
+	for _, pair := range strings.Split(s, sep) {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		fda, name, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("form mapping %q is not fdaform=form", pair)
+		}
+		form, err := model.FormString(strings.ToLower(strings.TrimSpace(name)))
+		if err != nil {
+			return nil, fmt.Errorf("form mapping %q: %w", pair, err)
+		}
+		m[strings.ToUpper(strings.TrimSpace(fda))] = form
+	}
+	return m, nil
+}
+
+// Lookup returns the medication form of an FDA dosage form, trying the full
+// name first and then the name before the first comma.
+func (m FormMap) Lookup(dosageForm string) (model.Form, bool) {
+	name := strings.ToUpper(strings.TrimSpace(dosageForm))
+	if f, ok := m[name]; ok {
+		return f, true
+	}
+	base, _, _ := strings.Cut(name, ",")
+	f, ok := m[strings.TrimSpace(base)]
+	return f, ok
+}
+
+// milligrams returns the amount of an ingredient strength, such as
+// "500 mg/1" or "0.5 g/10mL", in whole milligrams. Strengths in other units,
+// or that aren't a whole number of milligrams, are not converted.
+func milligrams(strength string) (int64, bool) {
+	amount, _, _ := strings.Cut(strength, "/")
+	fields := strings.Fields(amount)
+	if len(fields) != 2 {
+		return 0, false
+	}
+
+	v, ok := new(big.Rat).SetString(fields[0])
+	if !ok {
+		return 0, false
+	}
+	switch strings.ToLower(fields[1]) {
+	case "mg":
+	case "g":
+		v.Mul(v, big.NewRat(1000, 1))
+	case "mcg", "ug":
+		v.Quo(v, big.NewRat(1000, 1))
+	default:
+		return 0, false
+	}
+	if !v.IsInt() || !v.Num().IsInt64() {
+		return 0, false
+	}
+	return v.Num().Int64(), true
+}
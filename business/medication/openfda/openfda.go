@@ -0,0 +1,308 @@
+// Package openfda imports the FDA NDC directory into the medication catalog.
+// It reads the drug-ndc JSON download of openFDA, maps each finished product
+// onto a medication and keys it by product NDC, so the same or a newer
+// download can be imported again and only writes what changed.
+package openfda
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/aborilov/hippo/business/medication/catalog"
+	"github.com/aborilov/hippo/business/medication/model"
+	"github.com/aborilov/hippo/foundation/logger"
+)
+
+const logName = "medication.openfda"
+
+// Prefix starts the external id of every imported product, followed by its
+// product NDC.
+const Prefix = "ndc:"
+
+// Product is a product of the NDC directory, with the fields the import
+// uses.
+type Product struct {
+	ProductNDC        string       `json:"product_ndc"`
+	BrandName         string       `json:"brand_name"`
+	GenericName       string       `json:"generic_name"`
+	DosageForm        string       `json:"dosage_form"`
+	Route             []string     `json:"route"`
+	ActiveIngredients []Ingredient `json:"active_ingredients"`
+	Finished          bool         `json:"finished"`
+}
+
+// Ingredient is an active ingredient of a product and its strength, such as
+// "500 mg/1".
+type Ingredient struct {
+	Name     string `json:"name"`
+	Strength string `json:"strength"`
+}
+
+// Open opens a drug-ndc download, either the JSON file or the zip archive
+// openFDA serves it in.
+func Open(path string) (io.ReadCloser, error) {
+	if !strings.EqualFold(filepath.Ext(path), ".zip") {
+		return os.Open(path)
+	}
+
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range zr.File {
+		if strings.EqualFold(filepath.Ext(f.Name), ".json") {
+			rc, err := f.Open()
+			if err != nil {
+				zr.Close()
+				return nil, err
+			}
+			return zipEntry{ReadCloser: rc, zr: zr}, nil
+		}
+	}
+	zr.Close()
+	return nil, fmt.Errorf("%s holds no json file", path)
+}
+
+type zipEntry struct {
+	io.ReadCloser
+	zr *zip.ReadCloser
+}
+
+func (e zipEntry) Close() error {
+	return errors.Join(e.ReadCloser.Close(), e.zr.Close())
+}
+
+// Decode calls fn with the products of a drug-ndc download one at a time,
+// so the whole directory is never decoded at once.
+func Decode(r io.Reader, fn func(Product) error) error {
+	dec := json.NewDecoder(r)
+	if err := expect(dec, json.Delim('{')); err != nil {
+		return err
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if tok != "results" {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := expect(dec, json.Delim('[')); err != nil {
+			return err
+		}
+		for i := 1; dec.More(); i++ {
+			var p Product
+			if err := dec.Decode(&p); err != nil {
+				return fmt.Errorf("product %d: %w", i, err)
+			}
+			if err := fn(p); err != nil {
+				return err
+			}
+		}
+		if err := expect(dec, json.Delim(']')); err != nil {
+			return err
+		}
+	}
+	return expect(dec, json.Delim('}'))
+}
+
+func expect(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != want {
+		return fmt.Errorf("not a drug-ndc download: want %q, got %v", want, tok)
+	}
+	return nil
+}
+
+// Reasons a product is skipped.
+const (
+	SkipUnfinished = "unfinished product"
+	SkipNoNDC      = "no product ndc"
+	SkipDuplicate  = "duplicate product ndc"
+	SkipNoName     = "no name"
+	SkipUnmapped   = "unmapped dosage form"
+	SkipNoStrength = "no strength in whole milligrams"
+)
+
+// Options control an import.
+type Options struct {
+	// Forms add to or override DefaultForms.
+	Forms FormMap
+
+	// Prune deletes imported medications whose product is no longer in the
+	// directory. Without it only creates and updates are written, so a
+	// partial download can be imported safely.
+	Prune bool
+
+	// DryRun computes the plan without writing it.
+	DryRun bool
+}
+
+// Summary is the outcome of an import.
+type Summary struct {
+	Products int
+	Imported int
+
+	// Skipped counts the skipped products by reason, and UnmappedForms the
+	// dosage forms that skipped them for lack of a mapping.
+	Skipped       map[string]int
+	UnmappedForms map[string]int
+
+	Plan    catalog.Plan
+	Applied bool
+}
+
+// Import reads a drug-ndc download and diffs the products it maps against
+// the medications imported before. Unless it is a dry run, the plan is then
+// applied through svc in a single transaction.
+func Import(ctx context.Context, svc model.Service, r io.Reader, opts Options) (Summary, error) {
+	forms := maps.Clone(DefaultForms)
+	maps.Copy(forms, opts.Forms)
+
+	sum := Summary{
+		Skipped:       map[string]int{},
+		UnmappedForms: map[string]int{},
+	}
+	var rows []catalog.Row
+	seen := map[string]bool{}
+	err := Decode(r, func(p Product) error {
+		sum.Products++
+		m, reason := toMedication(p, forms)
+		switch {
+		case reason == "" && seen[m.ExternalID]:
+			reason = SkipDuplicate
+		case reason == SkipUnmapped:
+			sum.UnmappedForms[strings.ToUpper(strings.TrimSpace(p.DosageForm))]++
+		}
+		if reason != "" {
+			sum.Skipped[reason]++
+			return nil
+		}
+		seen[m.ExternalID] = true
+		rows = append(rows, catalog.Row{Medication: m})
+		return nil
+	})
+	if err != nil {
+		return sum, fmt.Errorf("read ndc directory: %w", err)
+	}
+	sum.Imported = len(rows)
+	if sum.Products == 0 {
+		return sum, errors.New("the download holds no products")
+	}
+
+	plan := func(current []*model.Medication) catalog.Plan {
+		p := catalog.Diff(current, rows)
+		if !opts.Prune {
+			p.Changes = slices.DeleteFunc(p.Changes, func(c catalog.Change) bool {
+				return c.Op == catalog.OpDelete
+			})
+		}
+		return p
+	}
+	sum.Plan, err = catalog.Sync(ctx, svc, Prefix, plan, !opts.DryRun)
+	if err != nil {
+		return sum, fmt.Errorf("apply ndc directory: %w", err)
+	}
+
+	log := logger.FromContext(ctx).WithName(logName)
+	log.V(1).Info("ndc directory planned", "products", sum.Products, "imported", sum.Imported,
+		"create", sum.Plan.Count(catalog.OpCreate), "update", sum.Plan.Count(catalog.OpUpdate),
+		"delete", sum.Plan.Count(catalog.OpDelete), "dry_run", opts.DryRun)
+	if opts.DryRun {
+		return sum, nil
+	}
+
+	sum.Applied = true
+	log.Info("ndc directory applied", "products", sum.Products,
+		"created", sum.Plan.Count(catalog.OpCreate), "updated", sum.Plan.Count(catalog.OpUpdate), "deleted", sum.Plan.Count(catalog.OpDelete))
+	return sum, nil
+}
+
+// toMedication maps a product, or returns the reason it is skipped.
+func toMedication(p Product, forms FormMap) (*model.Medication, string) {
+	ndc := strings.TrimSpace(p.ProductNDC)
+	name := strings.TrimSpace(p.BrandName)
+	if name == "" {
+		name = strings.TrimSpace(p.GenericName)
+	}
+
+	switch {
+	case !p.Finished:
+		return nil, SkipUnfinished
+	case ndc == "":
+		return nil, SkipNoNDC
+	case name == "":
+		return nil, SkipNoName
+	}
+
+	form, ok := forms.Lookup(p.DosageForm)
+	if !ok {
+		return nil, SkipUnmapped
+	}
+
+	var dosage int64
+	strengths := make([]string, 0, len(p.ActiveIngredients))
+	for i, in := range p.ActiveIngredients {
+		if i == 0 {
+			dosage, ok = milligrams(in.Strength)
+		}
+		strengths = append(strengths, strings.TrimSpace(in.Name+" "+in.Strength))
+	}
+	if !ok || dosage <= 0 {
+		return nil, SkipNoStrength
+	}
+
+	return &model.Medication{
+		Name:        name,
+		Dosage:      dosage,
+		Form:        form,
+		GenericName: strings.TrimSpace(p.GenericName),
+		Route:       strings.Join(p.Route, ", "),
+		Strength:    strings.Join(strengths, "; "),
+		ExternalID:  Prefix + ndc,
+	}, ""
+}
+
+// Write prints the counts of the import, then the skipped products by reason
+// and the unmapped dosage forms, most frequent first.
+func (s Summary) Write(w io.Writer) error {
+	fmt.Fprintf(w, "%d products read, %d imported, %d skipped\n", s.Products, s.Imported, s.Products-s.Imported)
+	for _, reason := range byCount(s.Skipped) {
+		fmt.Fprintf(w, "  %6d %s\n", s.Skipped[reason], reason)
+	}
+	if len(s.UnmappedForms) > 0 {
+		fmt.Fprintln(w, "unmapped dosage forms, map them with --form-map:")
+		for _, form := range byCount(s.UnmappedForms) {
+			fmt.Fprintf(w, "  %6d %s\n", s.UnmappedForms[form], form)
+		}
+	}
+	_, err := fmt.Fprintf(w, "%d to create, %d to update, %d to delete, %d unchanged\n",
+		s.Plan.Count(catalog.OpCreate), s.Plan.Count(catalog.OpUpdate), s.Plan.Count(catalog.OpDelete), s.Plan.Unchanged)
+	return err
+}
+
+// byCount returns the keys of counts, highest count first.
+func byCount(counts map[string]int) []string {
+	keys := slices.Sorted(maps.Keys(counts))
+	slices.SortStableFunc(keys, func(a, b string) int {
+		return counts[b] - counts[a]
+	})
+	return keys
+}
@@ -0,0 +1,287 @@
+package openfda_test
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aborilov/hippo/business/medication/model"
+	"github.com/aborilov/hippo/business/medication/openfda"
+)
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		dosageForm string
+		form       model.Form
+		ok         bool
+	}{
+		{dosageForm: "TABLET", form: model.FormTablet, ok: true},
+		{dosageForm: "tablet, film coated", form: model.FormTablet, ok: true},
+		{dosageForm: "TABLET, FOR SUSPENSION", form: model.FormPowder, ok: true},
+		{dosageForm: "POWDER, FOR SOLUTION", form: model.FormPowder, ok: true},
+		{dosageForm: "GRANULE, FOR SUSPENSION", form: model.FormPowder, ok: true},
+		{dosageForm: "FOR SUSPENSION", form: model.FormPowder, ok: true},
+		{dosageForm: "INJECTION, POWDER, FOR SOLUTION", form: model.FormInjection, ok: true},
+		{dosageForm: " SUPPOSITORY ", form: model.FormSuppository, ok: true},
+		{dosageForm: "LOTION"},
+		{dosageForm: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dosageForm, func(t *testing.T) {
+			form, ok := openfda.DefaultForms.Lookup(tt.dosageForm)
+			if form != tt.form || ok != tt.ok {
+				t.Errorf("got %v, %t, want %v, %t", form, ok, tt.form, tt.ok)
+			}
+		})
+	}
+}
+
+func TestParseFormMap(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want openfda.FormMap
+		err  bool
+	}{
+		{
+			name: "commas",
+			s:    "lotion=cream, KIT = Tablet",
+			want: openfda.FormMap{"LOTION": model.FormCream, "KIT": model.FormTablet},
+		},
+		{
+			name: "semicolons",
+			s:    "TABLET, FOR SUSPENSION=liquid;LOTION=cream;",
+			want: openfda.FormMap{"TABLET, FOR SUSPENSION": model.FormLiquid, "LOTION": model.FormCream},
+		},
+		{
+			name: "empty",
+			s:    "",
+			want: openfda.FormMap{},
+		},
+		{
+			name: "no form",
+			s:    "LOTION",
+			err:  true,
+		},
+		{
+			name: "unknown form",
+			s:    "LOTION=balm",
+			err:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := openfda.ParseFormMap(tt.s)
+			if tt.err != (err != nil) {
+				t.Fatalf("got error %v, want one: %t", err, tt.err)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMilligrams(t *testing.T) {
+	tests := []struct {
+		strength string
+		mg       int64
+		ok       bool
+	}{
+		{strength: "500 mg/1", mg: 500, ok: true},
+		{strength: "0.5 g/10mL", mg: 500, ok: true},
+		{strength: "2500 mcg/1", ok: false},
+		{strength: "5000 ug/1", mg: 5, ok: true},
+		{strength: "12.5 mg/1", ok: false},
+		{strength: "10 mL/100mL", ok: false},
+		{strength: "500mg/1", ok: false},
+		{strength: "", ok: false},
+		{strength: "many mg/1", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.strength, func(t *testing.T) {
+			mg, ok := openfda.Milligrams(tt.strength)
+			if ok != tt.ok || (ok && mg != tt.mg) {
+				t.Errorf("got %d, %t, want %d, %t", mg, ok, tt.mg, tt.ok)
+			}
+		})
+	}
+}
+
+func TestToMedication(t *testing.T) {
+	amoxicillin := openfda.Product{
+		ProductNDC:  " 0093-3109 ",
+		BrandName:   "Amoxil",
+		GenericName: "Amoxicillin",
+		DosageForm:  "CAPSULE",
+		Route:       []string{"ORAL"},
+		ActiveIngredients: []openfda.Ingredient{
+			{Name: "AMOXICILLIN", Strength: "500 mg/1"},
+			{Name: "CLAVULANATE POTASSIUM", Strength: "125 mg/1"},
+		},
+		Finished: true,
+	}
+	with := func(fn func(p *openfda.Product)) openfda.Product {
+		p := amoxicillin
+		fn(&p)
+		return p
+	}
+
+	tests := []struct {
+		name    string
+		product openfda.Product
+		want    *model.Medication
+		reason  string
+	}{
+		{
+			name:    "finished product",
+			product: amoxicillin,
+			want: &model.Medication{
+				Name:        "Amoxil",
+				Dosage:      500,
+				Form:        model.FormCapsule,
+				GenericName: "Amoxicillin",
+				Route:       "ORAL",
+				Strength:    "AMOXICILLIN 500 mg/1; CLAVULANATE POTASSIUM 125 mg/1",
+				ExternalID:  "ndc:0093-3109",
+			},
+		},
+		{
+			name:    "named after the generic",
+			product: with(func(p *openfda.Product) { p.BrandName = " " }),
+			want: &model.Medication{
+				Name:        "Amoxicillin",
+				Dosage:      500,
+				Form:        model.FormCapsule,
+				GenericName: "Amoxicillin",
+				Route:       "ORAL",
+				Strength:    "AMOXICILLIN 500 mg/1; CLAVULANATE POTASSIUM 125 mg/1",
+				ExternalID:  "ndc:0093-3109",
+			},
+		},
+		{
+			name:    "unfinished",
+			product: with(func(p *openfda.Product) { p.Finished = false }),
+			reason:  openfda.SkipUnfinished,
+		},
+		{
+			name:    "no ndc",
+			product: with(func(p *openfda.Product) { p.ProductNDC = "" }),
+			reason:  openfda.SkipNoNDC,
+		},
+		{
+			name:    "no name",
+			product: with(func(p *openfda.Product) { p.BrandName, p.GenericName = "", "" }),
+			reason:  openfda.SkipNoName,
+		},
+		{
+			name:    "unmapped form",
+			product: with(func(p *openfda.Product) { p.DosageForm = "KIT" }),
+			reason:  openfda.SkipUnmapped,
+		},
+		{
+			name:    "no ingredients",
+			product: with(func(p *openfda.Product) { p.ActiveIngredients = nil }),
+			reason:  openfda.SkipNoStrength,
+		},
+		{
+			name: "strength in another unit",
+			product: with(func(p *openfda.Product) {
+				p.ActiveIngredients = []openfda.Ingredient{{Name: "AMOXICILLIN", Strength: "5 mL/100mL"}}
+			}),
+			reason: openfda.SkipNoStrength,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason := openfda.ToMedication(tt.product, openfda.DefaultForms)
+			if reason != tt.reason {
+				t.Fatalf("got reason %q, want %q", reason, tt.reason)
+			}
+			if tt.want == nil {
+				if got != nil {
+					t.Errorf("got %+v, want nothing", got)
+				}
+				return
+			}
+			if *got != *tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		ndcs []string
+		err  bool
+	}{
+		{
+			name: "download",
+			data: `{"meta": {"results": {"total": 2}}, "results": [
+				{"product_ndc": "0001-0001", "dosage_form": "TABLET", "finished": true, "unused": [1, 2]},
+				{"product_ndc": "0001-0002", "active_ingredients": [{"name": "A", "strength": "5 mg/1"}]}
+			]}`,
+			ndcs: []string{"0001-0001", "0001-0002"},
+		},
+		{
+			name: "no results",
+			data: `{"meta": {}}`,
+		},
+		{
+			name: "not an object",
+			data: `[{"product_ndc": "0001-0001"}]`,
+			err:  true,
+		},
+		{
+			name: "bad product",
+			data: `{"results": [{"product_ndc": "0001-0001"}, {"finished": "yes"}]}`,
+			ndcs: []string{"0001-0001"},
+			err:  true,
+		},
+		{
+			name: "truncated",
+			data: `{"results": [{"product_ndc": "0001-0001"}`,
+			ndcs: []string{"0001-0001"},
+			err:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ndcs []string
+			err := openfda.Decode(strings.NewReader(tt.data), func(p openfda.Product) error {
+				ndcs = append(ndcs, p.ProductNDC)
+				return nil
+			})
+			if tt.err != (err != nil) {
+				t.Fatalf("got error %v, want one: %t", err, tt.err)
+			}
+			if !slices.Equal(ndcs, tt.ndcs) {
+				t.Errorf("got products %q, want %q", ndcs, tt.ndcs)
+			}
+		})
+	}
+}
+
+func TestDecodeStops(t *testing.T) {
+	stop := errors.New("stop")
+	data := `{"results": [{"product_ndc": "0001-0001"}, {"product_ndc": "0001-0002"}]}`
+
+	var n int
+	err := openfda.Decode(strings.NewReader(data), func(openfda.Product) error {
+		n++
+		return stop
+	})
+	if !errors.Is(err, stop) || n != 1 {
+		t.Errorf("got %v after %d products, want %v after 1", err, n, stop)
+	}
+}
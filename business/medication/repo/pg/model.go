@@ -1,6 +1,9 @@
 package pg
 
 import (
+	"database/sql"
+	"fmt"
+
 	"github.com/aborilov/hippo/business/medication/model"
 	"github.com/google/uuid"
 )
@@ -10,6 +13,12 @@ type Medication struct {
 	Name   string    `db:"name"`
 	Dosage int64     `db:"dosage"`
 	Form   string    `db:"form"`
+
+	GenericName string `db:"generic_name"`
+	Route       string `db:"route"`
+	Strength    string `db:"strength"`
+
+	ExternalID sql.NullString `db:"external_id"`
 }
 
 func (m *Medication) toService() (*model.Medication, error) {
@@ -22,14 +31,68 @@ func (m *Medication) toService() (*model.Medication, error) {
 		Name:   m.Name,
 		Dosage: m.Dosage,
 		Form:   f,
+
+		GenericName: m.GenericName,
+		Route:       m.Route,
+		Strength:    m.Strength,
+		ExternalID:  m.ExternalID.String,
 	}, nil
 }
 
+// toService converts a record read back from the database.
+func toService(m *Medication) (*model.Medication, error) {
+	s, err := m.toService()
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse medication from db: %w", err)
+	}
+	return s, nil
+}
+
 func fromServiceMedication(m *model.Medication) *Medication {
 	return &Medication{
 		ID:     m.ID,
 		Name:   m.Name,
 		Dosage: m.Dosage,
 		Form:   m.Form.String(),
+
+		GenericName: m.GenericName,
+		Route:       m.Route,
+		Strength:    m.Strength,
+		ExternalID:  sql.NullString{String: m.ExternalID, Valid: m.ExternalID != ""},
+	}
+}
+
+// Code is a row of medication_code.
+type Code struct {
+	MedicationID uuid.UUID `db:"medication_id"`
+	Type         string    `db:"type"`
+	Value        string    `db:"value"`
+}
+
+func (c *Code) toService() model.Code {
+	return model.Code{Type: model.CodeType(c.Type), Value: c.Value}
+}
+
+func fromServiceCode(id uuid.UUID, c model.Code) *Code {
+	return &Code{MedicationID: id, Type: string(c.Type), Value: c.Value}
+}
+
+// ATC is a row of atc. The level is stored so the classes of a level can be
+// selected by index.
+type ATC struct {
+	Code  string `db:"code"`
+	Name  string `db:"name"`
+	Level int    `db:"level"`
+}
+
+func toServiceATCs(recs []ATC) []model.ATC {
+	classes := make([]model.ATC, 0, len(recs))
+	for _, r := range recs {
+		classes = append(classes, model.ATC{Code: r.Code, Name: r.Name})
 	}
+	return classes
+}
+
+func fromServiceATC(a model.ATC) *ATC {
+	return &ATC{Code: a.Code, Name: a.Name, Level: a.Level()}
 }
@@ -2,49 +2,131 @@ package pg
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
 
 	"github.com/aborilov/hippo/business/medication/model"
+	"github.com/aborilov/hippo/business/sdk/sqldb"
+	"github.com/aborilov/hippo/foundation/logger"
 	"github.com/doug-martin/goqu/v9"
+	"github.com/doug-martin/goqu/v9/exp"
 	"github.com/google/uuid"
-	"github.com/jmoiron/sqlx"
 )
 
 const (
-	table = "medication"
+	table     = "medication"
+	codeTable = "medication_code"
+	atcTable  = "atc"
+	linkTable = "medication_atc"
+	logName   = "medication.repo"
+
+	// externalIDKey is the unique constraint on medication.external_id.
+	externalIDKey = "medication_external_id_key"
+
+	// codeKey is the primary key of medication_code, which gives each code
+	// to a single medication.
+	codeKey = "medication_code_key"
+
+	// bulkBatchSize is the number of rows inserted per statement by
+	// BulkCreate.
+	bulkBatchSize = 1000
+
+	// scopeLockQuery takes the transaction lock serializing changes to the
+	// external id scope given as its argument.
+	scopeLockQuery = `SELECT pg_advisory_xact_lock(hashtext('medication.scope'), hashtext($1))`
 )
 
-func NewRepository(db *sqlx.DB) (model.Repository, error) {
+// NewRepository returns a repository that writes to the primary of db and
+// reads List and Get from its replicas. Statements are recorded by queries
+// when it is not nil.
+func NewRepository(db *sqldb.Cluster, queries *sqldb.Queries) (model.Repository, error) {
 	if db == nil {
 		return nil, errors.New(`"db" cannot be nil`)
 	}
 
 	r := &repository{
-		db: db,
-		gq: goqu.New("postgres", db),
+		db:      db,
+		queries: queries,
 	}
 	return r, nil
 }
 
 type repository struct {
-	db *sqlx.DB
-	gq *goqu.Database
+	db      *sqldb.Cluster
+	queries *sqldb.Queries
+}
+
+// writer and reader return goqu handles on the primary and on a replica.
+// Statements are built with Prepared(true) so values are bound as arguments
+// rather than inlined, which keeps them out of the recorded query text.
+func (repo *repository) writer(ctx context.Context) *goqu.Database {
+	return goqu.New(sqldb.Dialect, repo.queries.Wrap(repo.db.Writer(ctx)))
+}
+
+func (repo *repository) reader(ctx context.Context) *goqu.Database {
+	return goqu.New(sqldb.Dialect, repo.queries.Wrap(repo.db.Reader(ctx)))
 }
 
 func (repo *repository) Create(ctx context.Context, m *model.Medication) (*model.Medication, error) {
 	rec := fromServiceMedication(m)
-	if _, err := repo.gq.Insert(table).Rows(rec).Executor().ExecContext(ctx); err != nil {
+	out := &Medication{}
+	_, err := repo.writer(ctx).Insert(table).Prepared(true).Rows(rec).
+		Returning(goqu.Star()).Executor().ScanStructContext(ctx, out)
+	if sqldb.IsUniqueViolation(err, externalIDKey) {
+		return nil, model.ErrExternalIDConflict{ExternalID: m.ExternalID}
+	}
+	if err != nil {
 		return nil, err
 	}
-	return repo.Get(ctx, m.ID)
+	logger.FromContext(ctx).WithName(logName).V(2).Info("medication inserted", "table", table, "id", m.ID)
+	return toService(out)
 }
-func (repo *repository) List(ctx context.Context) ([]*model.Medication, error) {
+
+// BulkCreate inserts the medications in multi-row batches within a single
+// transaction.
+func (repo *repository) BulkCreate(ctx context.Context, meds []*model.Medication) (int64, error) {
+	sqlTx, err := repo.queries.Wrap(repo.db.Writer(ctx)).Tx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	tx := goqu.NewTx(sqldb.Dialect, sqlTx)
+
+	var n int64
+	err = tx.Wrap(func() error {
+		for batch := range slices.Chunk(meds, bulkBatchSize) {
+			recs := make([]any, 0, len(batch))
+			for _, m := range batch {
+				recs = append(recs, fromServiceMedication(m))
+			}
+			res, err := tx.Insert(table).Prepared(true).Rows(recs...).Executor().ExecContext(ctx)
+			if err != nil {
+				return err
+			}
+			rows, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			n += rows
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("unable to bulk create medications: %w", err)
+	}
+	logger.FromContext(ctx).WithName(logName).V(2).Info("medications bulk inserted", "table", table, "rows", n)
+	return n, nil
+}
+
+func (repo *repository) List(ctx context.Context, f model.Filter) ([]*model.Medication, error) {
 	recs := []Medication{}
-	err := repo.gq.From(table).ScanStructsContext(ctx, &recs)
+	err := repo.reader(ctx).From(table).Prepared(true).Where(where(f)...).ScanStructsContext(ctx, &recs)
 	if err != nil {
 		return nil, err
 	}
+	logger.FromContext(ctx).WithName(logName).V(2).Info("medications listed", "table", table, "rows", len(recs))
 	var meds []*model.Medication
 	for _, r := range recs {
 		s, err := r.toService()
@@ -56,30 +138,441 @@ func (repo *repository) List(ctx context.Context) ([]*model.Medication, error) {
 
 	return meds, nil
 }
+
+// Export reads the medications ordered by name one row at a time, so only
+// the row being handed to fn is held in memory. The export is a single
+// statement that lasts as long as the client takes to read it, so it runs in
+// a read-only transaction without the statement timeout and is bounded by
+// ctx instead.
+func (repo *repository) Export(ctx context.Context, f model.Filter, fn func(*model.Medication) error) error {
+	sqlTx, err := repo.queries.Wrap(repo.db.Reader(ctx)).Tx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("unable to export medications: %w", err)
+	}
+	tx := goqu.NewTx(sqldb.Dialect, sqlTx)
+
+	var n int
+	err = tx.Wrap(func() error {
+		if _, err := tx.ExecContext(ctx, "SET LOCAL statement_timeout = 0"); err != nil {
+			return err
+		}
+		scanner, err := tx.From(table).Prepared(true).Where(where(f)...).
+			Order(goqu.I("name").Asc(), goqu.I("id").Asc()).Executor().ScannerContext(ctx)
+		if err != nil {
+			return err
+		}
+		defer scanner.Close()
+
+		for scanner.Next() {
+			rec := Medication{}
+			if err := scanner.ScanStruct(&rec); err != nil {
+				return err
+			}
+			m, err := toService(&rec)
+			if err != nil {
+				return err
+			}
+			if err := fn(m); err != nil {
+				return err
+			}
+			n++
+		}
+		return scanner.Err()
+	})
+	if err != nil {
+		return fmt.Errorf("unable to export medications: %w", err)
+	}
+	logger.FromContext(ctx).WithName(logName).V(2).Info("medications exported", "table", table, "rows", n)
+	return nil
+}
+
 func (repo *repository) Get(ctx context.Context, id uuid.UUID) (*model.Medication, error) {
 	record := &Medication{}
-	found, err := repo.gq.From(table).Where(goqu.I("id").Eq(id.String())).ScanStructContext(ctx, record)
+	found, err := repo.reader(ctx).From(table).Prepared(true).Where(goqu.I("id").Eq(id.String())).ScanStructContext(ctx, record)
 	if err != nil {
 		return nil, fmt.Errorf("unable to get medication: %w", err)
 	}
 	if !found {
 		return nil, model.ErrNotFound{MedicationID: id.String()}
 	}
-	t, err := record.toService()
-	if err != nil {
-		return nil, fmt.Errorf("unable to parse medication from db: %w", err)
-	}
-	return t, nil
+	return toService(record)
 }
 func (repo *repository) Update(ctx context.Context, m *model.Medication) (*model.Medication, error) {
 	record := fromServiceMedication(m)
-	_, err := repo.gq.Update(table).Where(goqu.I("id").Eq(record.ID)).Set(record).Executor().ExecContext(ctx)
+	out := &Medication{}
+	found, err := repo.writer(ctx).Update(table).Prepared(true).Where(goqu.I("id").Eq(record.ID)).
+		Set(goqu.Record{
+			"name":   record.Name,
+			"dosage": record.Dosage,
+			"form":   record.Form,
+
+			"generic_name": record.GenericName,
+			"route":        record.Route,
+			"strength":     record.Strength,
+			// an empty external id keeps the stored one
+			"external_id": goqu.COALESCE(record.ExternalID, goqu.I("external_id")),
+		}).
+		Returning(goqu.Star()).Executor().ScanStructContext(ctx, out)
+	if sqldb.IsUniqueViolation(err, externalIDKey) {
+		return nil, model.ErrExternalIDConflict{ExternalID: m.ExternalID}
+	}
 	if err != nil {
 		return nil, err
 	}
-	return repo.Get(ctx, m.ID)
+	if !found {
+		return nil, model.ErrNotFound{MedicationID: m.ID.String()}
+	}
+	logger.FromContext(ctx).WithName(logName).V(2).Info("medication updated", "table", table, "id", m.ID)
+	return toService(out)
 }
+
+// Upsert inserts the medication or, when its external id already exists,
+// updates that row in place and keeps its id.
+func (repo *repository) Upsert(ctx context.Context, m *model.Medication) (*model.Medication, error) {
+	rec := fromServiceMedication(m)
+	out := &Medication{}
+	_, err := repo.writer(ctx).Insert(table).Prepared(true).Rows(rec).
+		OnConflict(goqu.DoUpdate("external_id", goqu.Record{
+			"name":   goqu.L("EXCLUDED.name"),
+			"dosage": goqu.L("EXCLUDED.dosage"),
+			"form":   goqu.L("EXCLUDED.form"),
+
+			"generic_name": goqu.L("EXCLUDED.generic_name"),
+			"route":        goqu.L("EXCLUDED.route"),
+			"strength":     goqu.L("EXCLUDED.strength"),
+		})).
+		Returning(goqu.Star()).Executor().ScanStructContext(ctx, out)
+	if err != nil {
+		return nil, err
+	}
+	logger.FromContext(ctx).WithName(logName).V(2).Info("medication upserted", "table", table, "id", out.ID, "external_id", m.ExternalID)
+	return toService(out)
+}
+
 func (repo *repository) Delete(ctx context.Context, id uuid.UUID) error {
-	_, err := repo.gq.Delete(table).Where(goqu.I("id").Eq(id.String())).Executor().ExecContext(ctx)
-	return err
+	res, err := repo.writer(ctx).Delete(table).Prepared(true).Where(goqu.I("id").Eq(id.String())).Executor().ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return model.ErrNotFound{MedicationID: id.String()}
+	}
+	logger.FromContext(ctx).WithName(logName).V(2).Info("medication deleted", "table", table, "id", id)
+	return nil
+}
+
+func (repo *repository) Purge(ctx context.Context, externalIDPrefix string) (int64, error) {
+	res, err := repo.writer(ctx).Delete(table).Prepared(true).
+		Where(goqu.Func("starts_with", goqu.I("external_id"), externalIDPrefix).IsTrue()).Executor().ExecContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	logger.FromContext(ctx).WithName(logName).V(2).Info("medications purged", "table", table, "external_id_prefix", externalIDPrefix, "rows", n)
+	return n, nil
+}
+
+// Apply runs all the changes in one transaction. An update of a missing
+// medication rolls everything back, while deleting one that is already gone
+// is not an error.
+func (repo *repository) Apply(ctx context.Context, c model.Changes) error {
+	sqlTx, err := repo.queries.Wrap(repo.db.Writer(ctx)).Tx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	tx := goqu.NewTx(sqldb.Dialect, sqlTx)
+
+	var deleted int64
+	err = tx.Wrap(func() error {
+		if c.Scope != "" {
+			if err := checkScope(ctx, tx, c); err != nil {
+				return err
+			}
+		}
+		for batch := range slices.Chunk(c.Create, bulkBatchSize) {
+			recs := make([]any, 0, len(batch))
+			for _, m := range batch {
+				recs = append(recs, fromServiceMedication(m))
+			}
+			_, err := tx.Insert(table).Prepared(true).Rows(recs...).Executor().ExecContext(ctx)
+			if err != nil {
+				return err
+			}
+		}
+		for _, m := range c.Update {
+			rec := fromServiceMedication(m)
+			res, err := tx.Update(table).Prepared(true).Where(goqu.I("id").Eq(rec.ID)).Set(rec).Executor().ExecContext(ctx)
+			if sqldb.IsUniqueViolation(err, externalIDKey) {
+				return model.ErrExternalIDConflict{ExternalID: m.ExternalID}
+			}
+			if err != nil {
+				return err
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				return model.ErrNotFound{MedicationID: m.ID.String()}
+			}
+		}
+		for batch := range slices.Chunk(c.Delete, bulkBatchSize) {
+			ids := make([]string, 0, len(batch))
+			for _, id := range batch {
+				ids = append(ids, id.String())
+			}
+			res, err := tx.Delete(table).Prepared(true).Where(goqu.I("id").In(ids)).Executor().ExecContext(ctx)
+			if err != nil {
+				return err
+			}
+			n, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			deleted += n
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("unable to apply medication changes: %w", err)
+	}
+	logger.FromContext(ctx).WithName(logName).V(2).Info("medication changes applied", "table", table,
+		"created", len(c.Create), "updated", len(c.Update), "deleted", deleted)
+	return nil
+}
+
+func (repo *repository) Codes(ctx context.Context, id uuid.UUID) ([]model.Code, error) {
+	recs := []Code{}
+	err := repo.reader(ctx).From(codeTable).Prepared(true).Select("type", "value").
+		Where(goqu.I("medication_id").Eq(id.String())).Order(goqu.I("type").Asc(), goqu.I("value").Asc()).
+		ScanStructsContext(ctx, &recs)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get medication codes: %w", err)
+	}
+	codes := make([]model.Code, 0, len(recs))
+	for _, r := range recs {
+		codes = append(codes, r.toService())
+	}
+	return codes, nil
+}
+
+// SetCodes replaces the codes of a medication in one transaction. Codes are
+// inserted one at a time so a conflict names the code that caused it.
+func (repo *repository) SetCodes(ctx context.Context, id uuid.UUID, codes []model.Code) error {
+	sqlTx, err := repo.queries.Wrap(repo.db.Writer(ctx)).Tx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	tx := goqu.NewTx(sqldb.Dialect, sqlTx)
+
+	err = tx.Wrap(func() error {
+		if err := lockMedication(ctx, tx, id); err != nil {
+			return err
+		}
+		_, err := tx.Delete(codeTable).Prepared(true).Where(goqu.I("medication_id").Eq(id.String())).Executor().ExecContext(ctx)
+		if err != nil {
+			return err
+		}
+		for _, c := range codes {
+			_, err := tx.Insert(codeTable).Prepared(true).Rows(fromServiceCode(id, c)).Executor().ExecContext(ctx)
+			if sqldb.IsUniqueViolation(err, codeKey) {
+				return model.ErrCodeConflict{Code: c}
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("unable to set medication codes: %w", err)
+	}
+	logger.FromContext(ctx).WithName(logName).V(2).Info("medication codes set", "table", codeTable, "id", id, "codes", len(codes))
+	return nil
+}
+
+func (repo *repository) Lookup(ctx context.Context, c model.Code) (*model.Medication, error) {
+	record := &Medication{}
+	found, err := repo.reader(ctx).From(goqu.T(table).As("m")).Prepared(true).Select(goqu.T("m").All()).
+		Join(goqu.T(codeTable).As("c"), goqu.On(goqu.I("c.medication_id").Eq(goqu.I("m.id")))).
+		Where(goqu.I("c.type").Eq(string(c.Type)), goqu.I("c.value").Eq(c.Value)).
+		ScanStructContext(ctx, record)
+	if err != nil {
+		return nil, fmt.Errorf("unable to look up medication: %w", err)
+	}
+	if !found {
+		return nil, model.ErrCodeNotFound{Code: c.Value}
+	}
+	return toService(record)
+}
+
+// ImportATC inserts the classes in batches within a single transaction,
+// renaming those that already exist.
+func (repo *repository) ImportATC(ctx context.Context, classes []model.ATC) (int64, error) {
+	sqlTx, err := repo.queries.Wrap(repo.db.Writer(ctx)).Tx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	tx := goqu.NewTx(sqldb.Dialect, sqlTx)
+
+	var n int64
+	err = tx.Wrap(func() error {
+		for batch := range slices.Chunk(classes, bulkBatchSize) {
+			recs := make([]any, 0, len(batch))
+			for _, a := range batch {
+				recs = append(recs, fromServiceATC(a))
+			}
+			res, err := tx.Insert(atcTable).Prepared(true).Rows(recs...).
+				OnConflict(goqu.DoUpdate("code", goqu.Record{"name": goqu.L("EXCLUDED.name")})).
+				Executor().ExecContext(ctx)
+			if err != nil {
+				return err
+			}
+			rows, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			n += rows
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("unable to import atc classes: %w", err)
+	}
+	logger.FromContext(ctx).WithName(logName).V(2).Info("atc classes imported", "table", atcTable, "rows", n)
+	return n, nil
+}
+
+func (repo *repository) ATCClasses(ctx context.Context, codes []string) ([]model.ATC, error) {
+	if len(codes) == 0 {
+		return nil, nil
+	}
+	recs := []ATC{}
+	err := repo.reader(ctx).From(atcTable).Prepared(true).Where(goqu.I("code").In(codes)).
+		Order(goqu.I("code").Asc()).ScanStructsContext(ctx, &recs)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get atc classes: %w", err)
+	}
+	return toServiceATCs(recs), nil
+}
+
+// ATCChildren returns the classes one level below code, ordered by code.
+func (repo *repository) ATCChildren(ctx context.Context, code string) ([]model.ATC, error) {
+	recs := []ATC{}
+	err := repo.reader(ctx).From(atcTable).Prepared(true).
+		Where(goqu.I("level").Eq(model.ATCLevel(code)+1), goqu.Func("starts_with", goqu.I("code"), code).IsTrue()).
+		Order(goqu.I("code").Asc()).ScanStructsContext(ctx, &recs)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get atc classes: %w", err)
+	}
+	return toServiceATCs(recs), nil
+}
+
+func (repo *repository) Classification(ctx context.Context, id uuid.UUID) ([]model.ATC, error) {
+	recs := []ATC{}
+	err := repo.reader(ctx).From(goqu.T(atcTable).As("a")).Prepared(true).Select(goqu.T("a").All()).
+		Join(goqu.T(linkTable).As("l"), goqu.On(goqu.I("l.atc_code").Eq(goqu.I("a.code")))).
+		Where(goqu.I("l.medication_id").Eq(id.String())).
+		Order(goqu.I("a.code").Asc()).ScanStructsContext(ctx, &recs)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get medication classification: %w", err)
+	}
+	return toServiceATCs(recs), nil
+}
+
+// SetClassification replaces the ATC classes of a medication in one
+// transaction.
+func (repo *repository) SetClassification(ctx context.Context, id uuid.UUID, codes []string) error {
+	sqlTx, err := repo.queries.Wrap(repo.db.Writer(ctx)).Tx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	tx := goqu.NewTx(sqldb.Dialect, sqlTx)
+
+	err = tx.Wrap(func() error {
+		if err := lockMedication(ctx, tx, id); err != nil {
+			return err
+		}
+		_, err := tx.Delete(linkTable).Prepared(true).Where(goqu.I("medication_id").Eq(id.String())).Executor().ExecContext(ctx)
+		if err != nil || len(codes) == 0 {
+			return err
+		}
+		recs := make([]any, 0, len(codes))
+		for _, code := range codes {
+			recs = append(recs, goqu.Record{"medication_id": id.String(), "atc_code": code})
+		}
+		_, err = tx.Insert(linkTable).Prepared(true).Rows(recs...).Executor().ExecContext(ctx)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("unable to set medication classification: %w", err)
+	}
+	logger.FromContext(ctx).WithName(logName).V(2).Info("medication classification set", "table", linkTable, "id", id, "classes", len(codes))
+	return nil
+}
+
+// checkScope serializes the changes to the scope of c and fails with
+// ErrScopeChanged unless its medications still match the snapshot of c.
+func checkScope(ctx context.Context, tx *goqu.TxDatabase, c model.Changes) error {
+	if _, err := tx.ExecContext(ctx, scopeLockQuery, c.Scope); err != nil {
+		return err
+	}
+	recs := []Medication{}
+	err := tx.From(table).Prepared(true).Where(where(model.Filter{ExternalIDPrefix: c.Scope})...).ScanStructsContext(ctx, &recs)
+	if err != nil {
+		return err
+	}
+	current := make([]*model.Medication, 0, len(recs))
+	for _, r := range recs {
+		m, err := toService(&r)
+		if err != nil {
+			return err
+		}
+		current = append(current, m)
+	}
+	if !c.Matches(current) {
+		return model.ErrScopeChanged{Scope: c.Scope}
+	}
+	return nil
+}
+
+// lockMedication fails with ErrNotFound unless the medication exists, and
+// keeps it from being deleted until tx ends.
+func lockMedication(ctx context.Context, tx *goqu.TxDatabase, id uuid.UUID) error {
+	var locked bool
+	found, err := tx.From(table).Prepared(true).Select(goqu.L("true")).Where(goqu.I("id").Eq(id.String())).
+		ForShare(exp.Wait).ScanValContext(ctx, &locked)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return model.ErrNotFound{MedicationID: id.String()}
+	}
+	return nil
+}
+
+// where returns the conditions selecting the medications of a filter.
+func where(f model.Filter) []goqu.Expression {
+	var exps []goqu.Expression
+	if f.Name != "" {
+		exps = append(exps, goqu.Func("strpos", goqu.Func("lower", goqu.I("name")), strings.ToLower(f.Name)).Gt(0))
+	}
+	if f.Form != 0 {
+		exps = append(exps, goqu.I("form").Eq(f.Form.String()))
+	}
+	if f.ExternalIDPrefix != "" {
+		exps = append(exps, goqu.Func("starts_with", goqu.I("external_id"), f.ExternalIDPrefix).IsTrue())
+	}
+	if f.ATC != "" {
+		exps = append(exps, goqu.I("id").In(goqu.Dialect(sqldb.Dialect).From(linkTable).Select("medication_id").
+			Where(goqu.Func("starts_with", goqu.I("atc_code"), f.ATC).IsTrue())))
+	}
+	return exps
 }
@@ -0,0 +1,505 @@
+// Package pgpool implements the medication repository directly on a native
+// pgx connection pool, bypassing database/sql.
+package pgpool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aborilov/hippo/business/medication/model"
+	"github.com/aborilov/hippo/business/sdk/sqldb"
+	"github.com/aborilov/hippo/foundation/logger"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	table     = "medication"
+	codeTable = "medication_code"
+	atcTable  = "atc"
+	linkTable = "medication_atc"
+	logName   = "medication.repo"
+
+	// externalIDKey is the unique constraint on medication.external_id.
+	externalIDKey = "medication_external_id_key"
+
+	// codeKey is the primary key of medication_code, which gives each code
+	// to a single medication.
+	codeKey = "medication_code_key"
+)
+
+// columns lists the medication columns in the order every query selects
+// them.
+var columns = []string{"id", "name", "dosage", "form", "generic_name", "route", "strength", "external_id"}
+
+const (
+	insertQuery = `INSERT INTO medication (id, name, dosage, form, generic_name, route, strength, external_id)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	RETURNING id, name, dosage, form, generic_name, route, strength, external_id`
+	listQuery   = `SELECT id, name, dosage, form, generic_name, route, strength, external_id FROM medication`
+	exportOrder = ` ORDER BY name, id`
+	getQuery    = `SELECT id, name, dosage, form, generic_name, route, strength, external_id FROM medication WHERE id = $1`
+	updateQuery = `UPDATE medication SET name = $2, dosage = $3, form = $4, generic_name = $5, route = $6, strength = $7,
+	external_id = COALESCE($8, external_id)
+	WHERE id = $1
+	RETURNING id, name, dosage, form, generic_name, route, strength, external_id`
+	upsertQuery = `INSERT INTO medication (id, name, dosage, form, generic_name, route, strength, external_id)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	ON CONFLICT (external_id) DO UPDATE SET name = EXCLUDED.name, dosage = EXCLUDED.dosage, form = EXCLUDED.form,
+	generic_name = EXCLUDED.generic_name, route = EXCLUDED.route, strength = EXCLUDED.strength
+	RETURNING id, name, dosage, form, generic_name, route, strength, external_id`
+	deleteQuery = `DELETE FROM medication WHERE id = $1`
+	lockQuery   = `SELECT true FROM medication WHERE id = $1 FOR SHARE`
+	purgeQuery  = `DELETE FROM medication WHERE starts_with(external_id, $1)`
+
+	scopeLockQuery = `SELECT pg_advisory_xact_lock(hashtext('medication.scope'), hashtext($1))`
+
+	applyUpdateQuery = `UPDATE medication SET name = $2, dosage = $3, form = $4, generic_name = $5, route = $6, strength = $7, external_id = $8
+	WHERE id = $1`
+	applyDeleteQuery = `DELETE FROM medication WHERE id = ANY($1)`
+
+	codesQuery       = `SELECT type, value FROM medication_code WHERE medication_id = $1 ORDER BY type, value`
+	deleteCodesQuery = `DELETE FROM medication_code WHERE medication_id = $1`
+	insertCodeQuery  = `INSERT INTO medication_code (medication_id, type, value) VALUES ($1, $2, $3)`
+	lookupQuery      = `SELECT m.id, m.name, m.dosage, m.form, m.generic_name, m.route, m.strength, m.external_id
+	FROM medication m JOIN medication_code c ON c.medication_id = m.id
+	WHERE c.type = $1 AND c.value = $2`
+
+	importATCQuery = `INSERT INTO atc (code, name, level) VALUES ($1, $2, $3)
+	ON CONFLICT (code) DO UPDATE SET name = EXCLUDED.name`
+	atcClassesQuery     = `SELECT code, name FROM atc WHERE code = ANY($1) ORDER BY code`
+	atcChildrenQuery    = `SELECT code, name FROM atc WHERE level = $1 AND starts_with(code, $2) ORDER BY code`
+	classificationQuery = `SELECT a.code, a.name FROM atc a JOIN medication_atc l ON l.atc_code = a.code WHERE l.medication_id = $1 ORDER BY a.code`
+	deleteClassesQuery  = `DELETE FROM medication_atc WHERE medication_id = $1`
+	insertClassesQuery  = `INSERT INTO medication_atc (medication_id, atc_code) SELECT $1, unnest($2::text[])`
+)
+
+// NewRepository returns a repository backed by pool. The pool should use a
+// statement caching exec mode so each query is only prepared once per
+// connection.
+func NewRepository(pool *pgxpool.Pool) (model.Repository, error) {
+	if pool == nil {
+		return nil, errors.New(`"pool" cannot be nil`)
+	}
+
+	r := &repository{
+		pool: pool,
+	}
+	return r, nil
+}
+
+type repository struct {
+	pool *pgxpool.Pool
+}
+
+func (repo *repository) Create(ctx context.Context, m *model.Medication) (*model.Medication, error) {
+	rows, _ := repo.pool.Query(ctx, insertQuery, args(m)...)
+	med, err := pgx.CollectExactlyOneRow(rows, scanMedication)
+	if sqldb.IsUniqueViolation(err, externalIDKey) {
+		return nil, model.ErrExternalIDConflict{ExternalID: m.ExternalID}
+	}
+	if err != nil {
+		return nil, err
+	}
+	logger.FromContext(ctx).WithName(logName).V(2).Info("medication inserted", "table", table, "id", m.ID)
+	return med, nil
+}
+
+// BulkCreate loads the medications with the COPY protocol.
+func (repo *repository) BulkCreate(ctx context.Context, meds []*model.Medication) (int64, error) {
+	src := pgx.CopyFromSlice(len(meds), func(i int) ([]any, error) {
+		return args(meds[i]), nil
+	})
+
+	n, err := repo.pool.CopyFrom(ctx, pgx.Identifier{table}, columns, src)
+	if err != nil {
+		return 0, fmt.Errorf("unable to bulk create medications: %w", err)
+	}
+	logger.FromContext(ctx).WithName(logName).V(2).Info("medications copied", "table", table, "rows", n)
+	return n, nil
+}
+
+func (repo *repository) List(ctx context.Context, f model.Filter) ([]*model.Medication, error) {
+	cond, condArgs := where(f)
+	rows, _ := repo.pool.Query(ctx, listQuery+cond, condArgs...)
+	meds, err := pgx.CollectRows(rows, scanMedication)
+	if err != nil {
+		return nil, err
+	}
+	logger.FromContext(ctx).WithName(logName).V(2).Info("medications listed", "table", table, "rows", len(meds))
+	return meds, nil
+}
+
+// Export reads the medications ordered by name one row at a time, so only
+// the row being handed to fn is held in memory. The export is a single
+// statement that lasts as long as the client takes to read it, so it runs in
+// a read-only transaction without the statement timeout and is bounded by
+// ctx instead.
+func (repo *repository) Export(ctx context.Context, f model.Filter, fn func(*model.Medication) error) error {
+	var n int
+	err := pgx.BeginTxFunc(ctx, repo.pool, pgx.TxOptions{AccessMode: pgx.ReadOnly}, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, "SET LOCAL statement_timeout = 0"); err != nil {
+			return err
+		}
+		cond, condArgs := where(f)
+		rows, _ := tx.Query(ctx, listQuery+cond+exportOrder, condArgs...)
+		_, err := pgx.ForEachRow(rows, nil, func() error {
+			m, err := scanMedication(rows)
+			if err != nil {
+				return err
+			}
+			n++
+			return fn(m)
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("unable to export medications: %w", err)
+	}
+	logger.FromContext(ctx).WithName(logName).V(2).Info("medications exported", "table", table, "rows", n)
+	return nil
+}
+
+func (repo *repository) Get(ctx context.Context, id uuid.UUID) (*model.Medication, error) {
+	rows, _ := repo.pool.Query(ctx, getQuery, id)
+	med, err := pgx.CollectExactlyOneRow(rows, scanMedication)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, model.ErrNotFound{MedicationID: id.String()}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to get medication: %w", err)
+	}
+	return med, nil
+}
+
+func (repo *repository) Update(ctx context.Context, m *model.Medication) (*model.Medication, error) {
+	rows, _ := repo.pool.Query(ctx, updateQuery, args(m)...)
+	med, err := pgx.CollectExactlyOneRow(rows, scanMedication)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, model.ErrNotFound{MedicationID: m.ID.String()}
+	}
+	if sqldb.IsUniqueViolation(err, externalIDKey) {
+		return nil, model.ErrExternalIDConflict{ExternalID: m.ExternalID}
+	}
+	if err != nil {
+		return nil, err
+	}
+	logger.FromContext(ctx).WithName(logName).V(2).Info("medication updated", "table", table, "id", m.ID)
+	return med, nil
+}
+
+// Upsert inserts the medication or, when its external id already exists,
+// updates that row in place and keeps its id.
+func (repo *repository) Upsert(ctx context.Context, m *model.Medication) (*model.Medication, error) {
+	rows, _ := repo.pool.Query(ctx, upsertQuery, args(m)...)
+	med, err := pgx.CollectExactlyOneRow(rows, scanMedication)
+	if err != nil {
+		return nil, err
+	}
+	logger.FromContext(ctx).WithName(logName).V(2).Info("medication upserted", "table", table, "id", med.ID, "external_id", m.ExternalID)
+	return med, nil
+}
+
+func (repo *repository) Delete(ctx context.Context, id uuid.UUID) error {
+	tag, err := repo.pool.Exec(ctx, deleteQuery, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return model.ErrNotFound{MedicationID: id.String()}
+	}
+	logger.FromContext(ctx).WithName(logName).V(2).Info("medication deleted", "table", table, "id", id)
+	return nil
+}
+
+func (repo *repository) Purge(ctx context.Context, externalIDPrefix string) (int64, error) {
+	tag, err := repo.pool.Exec(ctx, purgeQuery, externalIDPrefix)
+	if err != nil {
+		return 0, err
+	}
+	logger.FromContext(ctx).WithName(logName).V(2).Info("medications purged", "table", table, "external_id_prefix", externalIDPrefix, "rows", tag.RowsAffected())
+	return tag.RowsAffected(), nil
+}
+
+// Apply runs all the changes in one transaction: creates are copied, updates
+// are sent as a single batch and deletes as one statement. An update of a
+// missing medication rolls everything back, while deleting one that is
+// already gone is not an error.
+func (repo *repository) Apply(ctx context.Context, c model.Changes) error {
+	var deleted int64
+	err := pgx.BeginFunc(ctx, repo.pool, func(tx pgx.Tx) error {
+		if c.Scope != "" {
+			if err := checkScope(ctx, tx, c); err != nil {
+				return err
+			}
+		}
+		if len(c.Create) > 0 {
+			src := pgx.CopyFromSlice(len(c.Create), func(i int) ([]any, error) {
+				return args(c.Create[i]), nil
+			})
+			if _, err := tx.CopyFrom(ctx, pgx.Identifier{table}, columns, src); err != nil {
+				return err
+			}
+		}
+
+		if len(c.Update) > 0 {
+			var batch pgx.Batch
+			for _, m := range c.Update {
+				batch.Queue(applyUpdateQuery, args(m)...).Exec(func(tag pgconn.CommandTag) error {
+					if tag.RowsAffected() == 0 {
+						return model.ErrNotFound{MedicationID: m.ID.String()}
+					}
+					return nil
+				})
+			}
+			if err := tx.SendBatch(ctx, &batch).Close(); err != nil {
+				return err
+			}
+		}
+
+		if len(c.Delete) > 0 {
+			tag, err := tx.Exec(ctx, applyDeleteQuery, c.Delete)
+			if err != nil {
+				return err
+			}
+			deleted = tag.RowsAffected()
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("unable to apply medication changes: %w", err)
+	}
+	logger.FromContext(ctx).WithName(logName).V(2).Info("medication changes applied", "table", table,
+		"created", len(c.Create), "updated", len(c.Update), "deleted", deleted)
+	return nil
+}
+
+func (repo *repository) Codes(ctx context.Context, id uuid.UUID) ([]model.Code, error) {
+	rows, _ := repo.pool.Query(ctx, codesQuery, id)
+	codes, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.Code, error) {
+		var c model.Code
+		err := row.Scan(&c.Type, &c.Value)
+		return c, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get medication codes: %w", err)
+	}
+	return codes, nil
+}
+
+// SetCodes replaces the codes of a medication in one transaction. The
+// inserts are sent as a batch, and a conflict names the code that caused it.
+func (repo *repository) SetCodes(ctx context.Context, id uuid.UUID, codes []model.Code) error {
+	err := pgx.BeginFunc(ctx, repo.pool, func(tx pgx.Tx) error {
+		if err := lockMedication(ctx, tx, id); err != nil {
+			return err
+		}
+		var batch pgx.Batch
+		batch.Queue(deleteCodesQuery, id)
+		for _, c := range codes {
+			batch.Queue(insertCodeQuery, id, string(c.Type), c.Value)
+		}
+		br := tx.SendBatch(ctx, &batch)
+		defer br.Close()
+		if _, err := br.Exec(); err != nil {
+			return err
+		}
+		for _, c := range codes {
+			_, err := br.Exec()
+			if sqldb.IsUniqueViolation(err, codeKey) {
+				return model.ErrCodeConflict{Code: c}
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return br.Close()
+	})
+	if err != nil {
+		return fmt.Errorf("unable to set medication codes: %w", err)
+	}
+	logger.FromContext(ctx).WithName(logName).V(2).Info("medication codes set", "table", codeTable, "id", id, "codes", len(codes))
+	return nil
+}
+
+func (repo *repository) Lookup(ctx context.Context, c model.Code) (*model.Medication, error) {
+	rows, _ := repo.pool.Query(ctx, lookupQuery, string(c.Type), c.Value)
+	med, err := pgx.CollectExactlyOneRow(rows, scanMedication)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, model.ErrCodeNotFound{Code: c.Value}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to look up medication: %w", err)
+	}
+	return med, nil
+}
+
+// ImportATC sends the classes as a single batch within a transaction,
+// renaming those that already exist.
+func (repo *repository) ImportATC(ctx context.Context, classes []model.ATC) (int64, error) {
+	var n int64
+	err := pgx.BeginFunc(ctx, repo.pool, func(tx pgx.Tx) error {
+		var batch pgx.Batch
+		for _, a := range classes {
+			batch.Queue(importATCQuery, a.Code, a.Name, a.Level()).Exec(func(tag pgconn.CommandTag) error {
+				n += tag.RowsAffected()
+				return nil
+			})
+		}
+		return tx.SendBatch(ctx, &batch).Close()
+	})
+	if err != nil {
+		return 0, fmt.Errorf("unable to import atc classes: %w", err)
+	}
+	logger.FromContext(ctx).WithName(logName).V(2).Info("atc classes imported", "table", atcTable, "rows", n)
+	return n, nil
+}
+
+func (repo *repository) ATCClasses(ctx context.Context, codes []string) ([]model.ATC, error) {
+	if len(codes) == 0 {
+		return nil, nil
+	}
+	rows, _ := repo.pool.Query(ctx, atcClassesQuery, codes)
+	classes, err := pgx.CollectRows(rows, scanATC)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get atc classes: %w", err)
+	}
+	return classes, nil
+}
+
+// ATCChildren returns the classes one level below code, ordered by code.
+func (repo *repository) ATCChildren(ctx context.Context, code string) ([]model.ATC, error) {
+	rows, _ := repo.pool.Query(ctx, atcChildrenQuery, model.ATCLevel(code)+1, code)
+	classes, err := pgx.CollectRows(rows, scanATC)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get atc classes: %w", err)
+	}
+	return classes, nil
+}
+
+func (repo *repository) Classification(ctx context.Context, id uuid.UUID) ([]model.ATC, error) {
+	rows, _ := repo.pool.Query(ctx, classificationQuery, id)
+	classes, err := pgx.CollectRows(rows, scanATC)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get medication classification: %w", err)
+	}
+	return classes, nil
+}
+
+// SetClassification replaces the ATC classes of a medication in one
+// transaction.
+func (repo *repository) SetClassification(ctx context.Context, id uuid.UUID, codes []string) error {
+	err := pgx.BeginFunc(ctx, repo.pool, func(tx pgx.Tx) error {
+		if err := lockMedication(ctx, tx, id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, deleteClassesQuery, id); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, insertClassesQuery, id, codes)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("unable to set medication classification: %w", err)
+	}
+	logger.FromContext(ctx).WithName(logName).V(2).Info("medication classification set", "table", linkTable, "id", id, "classes", len(codes))
+	return nil
+}
+
+// checkScope serializes the changes to the scope of c and fails with
+// ErrScopeChanged unless its medications still match the snapshot of c.
+func checkScope(ctx context.Context, tx pgx.Tx, c model.Changes) error {
+	if _, err := tx.Exec(ctx, scopeLockQuery, c.Scope); err != nil {
+		return err
+	}
+	cond, condArgs := where(model.Filter{ExternalIDPrefix: c.Scope})
+	rows, _ := tx.Query(ctx, listQuery+cond, condArgs...)
+	current, err := pgx.CollectRows(rows, scanMedication)
+	if err != nil {
+		return err
+	}
+	if !c.Matches(current) {
+		return model.ErrScopeChanged{Scope: c.Scope}
+	}
+	return nil
+}
+
+// lockMedication fails with ErrNotFound unless the medication exists, and
+// keeps it from being deleted until tx ends.
+func lockMedication(ctx context.Context, tx pgx.Tx, id uuid.UUID) error {
+	var found bool
+	err := tx.QueryRow(ctx, lockQuery, id).Scan(&found)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.ErrNotFound{MedicationID: id.String()}
+	}
+	return err
+}
+
+// where returns the WHERE clause selecting the medications of a filter,
+// empty when it selects all of them, and its arguments.
+func where(f model.Filter) (string, []any) {
+	var (
+		conds []string
+		args  []any
+	)
+	if f.Name != "" {
+		args = append(args, strings.ToLower(f.Name))
+		conds = append(conds, fmt.Sprintf("strpos(lower(name), $%d) > 0", len(args)))
+	}
+	if f.Form != 0 {
+		args = append(args, f.Form.String())
+		conds = append(conds, fmt.Sprintf("form = $%d", len(args)))
+	}
+	if f.ExternalIDPrefix != "" {
+		args = append(args, f.ExternalIDPrefix)
+		conds = append(conds, fmt.Sprintf("starts_with(external_id, $%d)", len(args)))
+	}
+	if f.ATC != "" {
+		args = append(args, f.ATC)
+		conds = append(conds, fmt.Sprintf("id IN (SELECT medication_id FROM medication_atc WHERE starts_with(atc_code, $%d))", len(args)))
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// args returns the column values of m in the order of columns.
+func args(m *model.Medication) []any {
+	var externalID *string
+	if m.ExternalID != "" {
+		externalID = &m.ExternalID
+	}
+	return []any{m.ID, m.Name, m.Dosage, m.Form.String(), m.GenericName, m.Route, m.Strength, externalID}
+}
+
+func scanMedication(row pgx.CollectableRow) (*model.Medication, error) {
+	var (
+		m          model.Medication
+		form       string
+		externalID *string
+	)
+	if err := row.Scan(&m.ID, &m.Name, &m.Dosage, &form, &m.GenericName, &m.Route, &m.Strength, &externalID); err != nil {
+		return nil, err
+	}
+	if externalID != nil {
+		m.ExternalID = *externalID
+	}
+
+	f, err := model.FormString(form)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse medication from db: %w", err)
+	}
+	m.Form = f
+	return &m, nil
+}
+
+func scanATC(row pgx.CollectableRow) (model.ATC, error) {
+	var a model.ATC
+	err := row.Scan(&a.Code, &a.Name)
+	return a, err
+}
@@ -2,39 +2,368 @@ package medication
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/aborilov/hippo/business/medication/model"
+	"github.com/aborilov/hippo/business/sdk/auth"
+	"github.com/aborilov/hippo/foundation/logger"
 	"github.com/google/uuid"
 )
 
+const logName = "medication.service"
+
 type service struct {
-	repo model.Repository
+	repo  model.Repository
+	authz auth.Authorizer
 }
 
-func NewService(repo model.Repository) (model.Service, error) {
+func NewService(repo model.Repository, authz auth.Authorizer) (model.Service, error) {
+	if authz == nil {
+		return nil, errors.New(`"authz" cannot be nil`)
+	}
+
 	svc := &service{
-		repo: repo,
+		repo:  repo,
+		authz: authz,
 	}
 	return svc, nil
 }
 
 func (s *service) Create(ctx context.Context, m *model.Medication) (*model.Medication, error) {
+	if err := s.authz.Authorize(ctx, auth.PermMedicationWrite); err != nil {
+		return nil, err
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
 	m.ID = uuid.New()
+	logger.FromContext(ctx).WithName(logName).V(1).Info("creating medication", "id", m.ID, "name", m.Name, "form", m.Form)
 	return s.repo.Create(ctx, m)
 }
 
-func (s *service) List(ctx context.Context) ([]*model.Medication, error) {
-	return s.repo.List(ctx)
+// BulkCreate stores all medications at once, assigning identifiers to those
+// that have none, and returns the number of rows created.
+func (s *service) BulkCreate(ctx context.Context, meds []*model.Medication) (int64, error) {
+	if err := s.authz.Authorize(ctx, auth.PermMedicationWrite); err != nil {
+		return 0, err
+	}
+	for i, m := range meds {
+		if err := m.Validate(); err != nil {
+			return 0, fmt.Errorf("medication %d: %w", i+1, err)
+		}
+		if m.ID == uuid.Nil {
+			m.ID = uuid.New()
+		}
+	}
+	logger.FromContext(ctx).WithName(logName).V(1).Info("bulk creating medications", "count", len(meds))
+	return s.repo.BulkCreate(ctx, meds)
+}
+
+func (s *service) List(ctx context.Context, f model.Filter) ([]*model.Medication, error) {
+	if err := s.authz.Authorize(ctx, auth.PermMedicationRead); err != nil {
+		return nil, err
+	}
+	return s.repo.List(ctx, f)
+}
+
+// Export calls fn with every medication matching the filter as it is read
+// from the database, so any number of medications can be exported without
+// holding them in memory. It stops at the first error returned by fn.
+func (s *service) Export(ctx context.Context, f model.Filter, fn func(*model.Medication) error) error {
+	if err := s.authz.Authorize(ctx, auth.PermMedicationRead); err != nil {
+		return err
+	}
+	logger.FromContext(ctx).WithName(logName).V(1).Info("exporting medications", "name", f.Name, "form", f.Form, "external_id_prefix", f.ExternalIDPrefix, "atc", f.ATC)
+	return s.repo.Export(ctx, f, fn)
 }
 
 func (s *service) Get(ctx context.Context, id uuid.UUID) (*model.Medication, error) {
+	if err := s.authz.Authorize(ctx, auth.PermMedicationRead); err != nil {
+		return nil, err
+	}
 	return s.repo.Get(ctx, id)
 }
 
 func (s *service) Update(ctx context.Context, m *model.Medication) (*model.Medication, error) {
+	if err := s.authz.Authorize(ctx, auth.PermMedicationWrite); err != nil {
+		return nil, err
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	logger.FromContext(ctx).WithName(logName).V(1).Info("updating medication", "id", m.ID, "name", m.Name, "form", m.Form)
 	return s.repo.Update(ctx, m)
 }
 
+// Upsert creates the medication or updates the one with the same external
+// id, so a sync job can push the same record any number of times.
+func (s *service) Upsert(ctx context.Context, m *model.Medication) (*model.Medication, error) {
+	if err := s.authz.Authorize(ctx, auth.PermMedicationWrite); err != nil {
+		return nil, err
+	}
+	if m.ExternalID == "" {
+		return nil, model.ErrExternalIDRequired
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	m.ID = uuid.New()
+	logger.FromContext(ctx).WithName(logName).V(1).Info("upserting medication", "external_id", m.ExternalID, "name", m.Name, "form", m.Form)
+	return s.repo.Upsert(ctx, m)
+}
+
 func (s *service) Delete(ctx context.Context, id uuid.UUID) error {
+	if err := s.authz.Authorize(ctx, auth.PermMedicationDelete); err != nil {
+		return err
+	}
+	logger.FromContext(ctx).WithName(logName).V(1).Info("deleting medication", "id", id)
 	return s.repo.Delete(ctx, id)
 }
+
+// Purge deletes every medication whose external id starts with
+// externalIDPrefix, such as the rows of a data generator, and returns how
+// many were deleted.
+func (s *service) Purge(ctx context.Context, externalIDPrefix string) (int64, error) {
+	if err := s.authz.Authorize(ctx, auth.PermMedicationPurge); err != nil {
+		return 0, err
+	}
+	if externalIDPrefix == "" {
+		return 0, model.ErrExternalIDRequired
+	}
+	logger.FromContext(ctx).WithName(logName).Info("purging medications", "external_id_prefix", externalIDPrefix)
+	return s.repo.Purge(ctx, externalIDPrefix)
+}
+
+// Apply creates, updates and deletes medications in a single transaction.
+// Every medication is validated before anything is written, and created ones
+// without an identifier are assigned one.
+func (s *service) Apply(ctx context.Context, c model.Changes) error {
+	if err := s.authz.Authorize(ctx, auth.PermMedicationWrite); err != nil {
+		return err
+	}
+	if len(c.Delete) > 0 {
+		if err := s.authz.Authorize(ctx, auth.PermMedicationDelete); err != nil {
+			return err
+		}
+	}
+	for i, m := range c.Create {
+		if err := m.Validate(); err != nil {
+			return fmt.Errorf("create %d: %w", i+1, err)
+		}
+		if m.ID == uuid.Nil {
+			m.ID = uuid.New()
+		}
+	}
+	for i, m := range c.Update {
+		if err := m.Validate(); err != nil {
+			return fmt.Errorf("update %d: %w", i+1, err)
+		}
+	}
+	logger.FromContext(ctx).WithName(logName).V(1).Info("applying medication changes",
+		"create", len(c.Create), "update", len(c.Update), "delete", len(c.Delete))
+	return s.repo.Apply(ctx, c)
+}
+
+func (s *service) Codes(ctx context.Context, id uuid.UUID) ([]model.Code, error) {
+	if err := s.authz.Authorize(ctx, auth.PermMedicationRead); err != nil {
+		return nil, err
+	}
+	if _, err := s.repo.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.repo.Codes(ctx, id)
+}
+
+// SetCodes replaces the codes of a medication and returns them normalized.
+// Codes written in different forms but standing for the same package are
+// stored once.
+func (s *service) SetCodes(ctx context.Context, id uuid.UUID, codes []model.Code) ([]model.Code, error) {
+	if err := s.authz.Authorize(ctx, auth.PermMedicationWrite); err != nil {
+		return nil, err
+	}
+	norm := make([]model.Code, 0, len(codes))
+	for _, c := range codes {
+		n, err := c.Normalize()
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(norm, n) {
+			norm = append(norm, n)
+		}
+	}
+	logger.FromContext(ctx).WithName(logName).V(1).Info("setting medication codes", "id", id, "codes", len(norm))
+	if err := s.repo.SetCodes(ctx, id, norm); err != nil {
+		return nil, err
+	}
+	return norm, nil
+}
+
+// Lookup returns the medication with a code matching a scanned or typed
+// value, along with the code that matched. The codes the value may stand for
+// are tried most specific first. A value read as NDCs of different
+// medications fails with ErrCodeAmbiguous.
+func (s *service) Lookup(ctx context.Context, scan string) (*model.Medication, model.Code, error) {
+	if err := s.authz.Authorize(ctx, auth.PermMedicationRead); err != nil {
+		return nil, model.Code{}, err
+	}
+	codes := model.ScanCodes(scan)
+	logger.FromContext(ctx).WithName(logName).V(1).Info("looking up medication", "scan", scan, "candidates", len(codes))
+	return s.lookup(ctx, scan, codes)
+}
+
+// Scan decodes the GS1 barcode of a package and returns it along with the
+// medication its GTIN, or the NDC the GTIN encodes, belongs to.
+func (s *service) Scan(ctx context.Context, data string) (*model.Medication, model.Package, error) {
+	if err := s.authz.Authorize(ctx, auth.PermMedicationRead); err != nil {
+		return nil, model.Package{}, err
+	}
+	p, err := model.ParsePackage(data, time.Now())
+	if err != nil {
+		return nil, model.Package{}, err
+	}
+	logger.FromContext(ctx).WithName(logName).V(1).Info("scanning package", "gtin", p.GTIN, "lot", p.Lot)
+	// a GTIN is never a SKU, however the shelf labels are numbered
+	codes := slices.DeleteFunc(model.ScanCodes(p.GTIN), func(c model.Code) bool { return c.Type == model.CodeSKU })
+	m, _, err := s.lookup(ctx, p.GTIN, codes)
+	return m, p, err
+}
+
+// lookup returns the medication of the first of codes that belongs to one.
+// Every NDC among codes is looked up, since the readings of one scan must
+// not lead to different medications.
+func (s *service) lookup(ctx context.Context, scan string, codes []model.Code) (*model.Medication, model.Code, error) {
+	var (
+		found     *model.Medication
+		foundCode model.Code
+	)
+	for _, c := range codes {
+		if found != nil && c.Type != model.CodeNDC {
+			break
+		}
+		m, err := s.repo.Lookup(ctx, c)
+		if errors.As(err, &model.ErrCodeNotFound{}) {
+			continue
+		}
+		if err != nil {
+			return nil, model.Code{}, err
+		}
+		switch {
+		case c.Type != model.CodeNDC:
+			return m, c, nil
+		case found == nil:
+			found, foundCode = m, c
+		case found.ID != m.ID:
+			return nil, model.Code{}, model.ErrCodeAmbiguous{Code: scan, Codes: []model.Code{foundCode, c}}
+		}
+	}
+	if found != nil {
+		return found, foundCode, nil
+	}
+	return nil, model.Code{}, model.ErrCodeNotFound{Code: scan}
+}
+
+// ImportATC stores the classes of the ATC classification, renaming those
+// already stored, and returns how many were written. The classification is
+// shared by every medication, so importing it takes its own permission.
+func (s *service) ImportATC(ctx context.Context, classes []model.ATC) (int64, error) {
+	if err := s.authz.Authorize(ctx, auth.PermATCImport); err != nil {
+		return 0, err
+	}
+	for i, a := range classes {
+		code, err := model.ParseATC(a.Code)
+		if err != nil {
+			return 0, fmt.Errorf("class %d: %w", i+1, err)
+		}
+		if strings.TrimSpace(a.Name) == "" {
+			return 0, fmt.Errorf("class %d: %w", i+1, model.ErrInvalid{Field: "atc", Reason: fmt.Sprintf("%s has no name", code)})
+		}
+		classes[i].Code = code
+	}
+	logger.FromContext(ctx).WithName(logName).V(1).Info("importing atc classes", "count", len(classes))
+	return s.repo.ImportATC(ctx, classes)
+}
+
+// ATCClasses returns the stored classes among codes, ordered by code.
+func (s *service) ATCClasses(ctx context.Context, codes []string) ([]model.ATC, error) {
+	if err := s.authz.Authorize(ctx, auth.PermMedicationRead); err != nil {
+		return nil, err
+	}
+	return s.repo.ATCClasses(ctx, codes)
+}
+
+// ATCNode returns a class with the classes above and directly below it, or
+// the root of the classification when code is empty.
+func (s *service) ATCNode(ctx context.Context, code string) (model.ATCNode, error) {
+	if err := s.authz.Authorize(ctx, auth.PermMedicationRead); err != nil {
+		return model.ATCNode{}, err
+	}
+
+	var node model.ATCNode
+	if code != "" {
+		var err error
+		if code, err = model.ParseATC(code); err != nil {
+			return node, err
+		}
+		path, err := s.repo.ATCClasses(ctx, model.ATCPath(code))
+		if err != nil {
+			return node, err
+		}
+		if len(path) == 0 || path[len(path)-1].Code != code {
+			return node, model.ErrATCNotFound{Code: code}
+		}
+		node.Class, node.Path = path[len(path)-1], path[:len(path)-1]
+	}
+
+	children, err := s.repo.ATCChildren(ctx, code)
+	if err != nil {
+		return node, err
+	}
+	node.Children = children
+	return node, nil
+}
+
+func (s *service) Classification(ctx context.Context, id uuid.UUID) ([]model.ATC, error) {
+	if err := s.authz.Authorize(ctx, auth.PermMedicationRead); err != nil {
+		return nil, err
+	}
+	if _, err := s.repo.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.repo.Classification(ctx, id)
+}
+
+// SetClassification replaces the ATC classes of a medication, which must all
+// be in the classification, and returns them.
+func (s *service) SetClassification(ctx context.Context, id uuid.UUID, codes []string) ([]model.ATC, error) {
+	if err := s.authz.Authorize(ctx, auth.PermMedicationWrite); err != nil {
+		return nil, err
+	}
+	norm := make([]string, 0, len(codes))
+	for _, c := range codes {
+		code, err := model.ParseATC(c)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(norm, code) {
+			norm = append(norm, code)
+		}
+	}
+	classes, err := s.repo.ATCClasses(ctx, norm)
+	if err != nil {
+		return nil, err
+	}
+	for _, code := range norm {
+		if !slices.ContainsFunc(classes, func(a model.ATC) bool { return a.Code == code }) {
+			return nil, model.ErrInvalid{Field: "atc", Reason: fmt.Sprintf("%s is not in the classification", code)}
+		}
+	}
+	logger.FromContext(ctx).WithName(logName).V(1).Info("setting medication classification", "id", id, "classes", len(norm))
+	if err := s.repo.SetClassification(ctx, id, norm); err != nil {
+		return nil, err
+	}
+	return classes, nil
+}
@@ -0,0 +1,117 @@
+// Package auth provides the caller identity and the role based policy used
+// to authorize operations in the business layer.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Role is a named set of permissions granted to a principal.
+type Role string
+
+// Set of known roles.
+const (
+	RoleViewer     Role = "viewer"
+	RolePharmacist Role = "pharmacist"
+	RoleAdmin      Role = "admin"
+)
+
+// Permission names a single operation that can be authorized.
+type Permission string
+
+// Set of known permissions.
+const (
+	PermAll              Permission = "*"
+	PermMedicationRead   Permission = "medication:read"
+	PermMedicationWrite  Permission = "medication:write"
+	PermMedicationDelete Permission = "medication:delete"
+	PermMedicationPurge  Permission = "medication:purge"
+	PermATCImport        Permission = "atc:import"
+	PermAPIKeyManage     Permission = "apikey:manage"
+	PermLogLevel         Permission = "debug:loglevel"
+)
+
+// Permissions lists the known permissions, PermAll first.
+var Permissions = []Permission{
+	PermAll,
+	PermMedicationRead,
+	PermMedicationWrite,
+	PermMedicationDelete,
+	PermMedicationPurge,
+	PermATCImport,
+	PermAPIKeyManage,
+	PermLogLevel,
+}
+
+// ParsePermission returns the known permission named s.
+func ParsePermission(s string) (Permission, error) {
+	perm := Permission(strings.TrimSpace(s))
+	if !slices.Contains(Permissions, perm) {
+		return "", fmt.Errorf("unknown permission %q", s)
+	}
+	return perm, nil
+}
+
+// ErrUnauthenticated is returned when there is no principal in the context.
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+// ErrForbidden is returned when the principal lacks the required permission.
+type ErrForbidden struct {
+	Subject    string
+	Permission Permission
+}
+
+func (e ErrForbidden) Error() string {
+	return fmt.Sprintf("%q is not allowed to %s", e.Subject, e.Permission)
+}
+
+// DetailCode returns the machine readable reason of the denial.
+func (e ErrForbidden) DetailCode() string {
+	code := strings.NewReplacer(":", "_", "*", "ALL").Replace(string(e.Permission))
+	return "MISSING_PERMISSION_" + strings.ToUpper(code)
+}
+
+// Principal is the authenticated caller of an operation. KeyID is the API
+// key the caller authenticated with, if any.
+type Principal struct {
+	Subject     string
+	KeyID       uuid.UUID
+	Roles       []Role
+	Permissions []Permission
+}
+
+// ID identifies the principal as the owner of what it creates. Key names
+// aren't unique, so callers with an API key are told apart by its id.
+func (p Principal) ID() string {
+	if p.KeyID != uuid.Nil {
+		return "apikey:" + p.KeyID.String()
+	}
+	return "subject:" + p.Subject
+}
+
+type ctxKey int
+
+const principalKey ctxKey = 1
+
+// SetPrincipal stores the principal in the context.
+func SetPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey, p)
+}
+
+// GetPrincipal returns the principal stored in the context.
+func GetPrincipal(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey).(Principal)
+	return p, ok
+}
+
+// Authorizer checks whether the caller stored in the context holds a
+// permission.
+type Authorizer interface {
+	Authorize(ctx context.Context, perm Permission) error
+}
@@ -0,0 +1,24 @@
+package auth_test
+
+import (
+	"testing"
+
+	"github.com/aborilov/hippo/business/sdk/auth"
+	"github.com/google/uuid"
+)
+
+func TestPrincipalID(t *testing.T) {
+	a := auth.Principal{Subject: "apikey:nightly-sync", KeyID: uuid.New()}
+	b := auth.Principal{Subject: "apikey:nightly-sync", KeyID: uuid.New()}
+	proxied := auth.Principal{Subject: "apikey:" + a.KeyID.String()}
+
+	if a.ID() == b.ID() {
+		t.Errorf("keys sharing a name share the id %s", a.ID())
+	}
+	if proxied.ID() == a.ID() {
+		t.Errorf("subject %q takes the id of key %s", proxied.Subject, a.KeyID)
+	}
+	if got := (auth.Principal{Subject: "alice"}).ID(); got != "subject:alice" {
+		t.Errorf("got %s, want subject:alice", got)
+	}
+}
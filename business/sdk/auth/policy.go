@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/aborilov/hippo/foundation/logger"
+)
+
+// logName is the name of the logger denials are reported on.
+const logName = "auth"
+
+// Policy maps roles to the permissions they grant. It is loaded from
+// configuration in the form:
+//
+//	viewer=medication:read;pharmacist=medication:read|medication:write;admin=*
+type Policy map[Role][]Permission
+
+// ParsePolicy parses the textual form of a policy. Every permission must be
+// one of Permissions, so a misspelled grant fails instead of silently
+// denying access.
+func ParsePolicy(s string) (Policy, error) {
+	p := Policy{}
+	for _, entry := range strings.Split(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		role, perms, ok := strings.Cut(entry, "=")
+		role = strings.TrimSpace(role)
+		if !ok || role == "" {
+			return nil, fmt.Errorf("invalid policy entry %q", entry)
+		}
+		for _, perm := range strings.Split(perms, "|") {
+			perm = strings.TrimSpace(perm)
+			if perm == "" {
+				continue
+			}
+			parsed, err := ParsePermission(perm)
+			if err != nil {
+				return nil, fmt.Errorf("policy entry %q: %w", entry, err)
+			}
+			p[Role(role)] = append(p[Role(role)], parsed)
+		}
+	}
+	return p, nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler so a Policy can be used
+// directly in configuration structs.
+func (p *Policy) UnmarshalText(text []byte) error {
+	v, err := ParsePolicy(string(text))
+	if err != nil {
+		return err
+	}
+	*p = v
+	return nil
+}
+
+// String returns the textual form of the policy.
+func (p Policy) String() string {
+	roles := make([]string, 0, len(p))
+	for r := range p {
+		roles = append(roles, string(r))
+	}
+	sort.Strings(roles)
+
+	entries := make([]string, 0, len(roles))
+	for _, r := range roles {
+		perms := make([]string, 0, len(p[Role(r)]))
+		for _, perm := range p[Role(r)] {
+			perms = append(perms, string(perm))
+		}
+		entries = append(entries, r+"="+strings.Join(perms, "|"))
+	}
+	return strings.Join(entries, ";")
+}
+
+// Allowed reports whether the principal holds the permission, either
+// directly or through one of its roles.
+func (p Policy) Allowed(pr Principal, perm Permission) bool {
+	if grants(pr.Permissions, perm) {
+		return true
+	}
+	for _, role := range pr.Roles {
+		if grants(p[role], perm) {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorize implements Authorizer for the principal stored in the context.
+func (p Policy) Authorize(ctx context.Context, perm Permission) error {
+	pr, ok := GetPrincipal(ctx)
+	if !ok {
+		return ErrUnauthenticated
+	}
+	if !p.Allowed(pr, perm) {
+		logger.FromContext(ctx).WithName(logName).V(1).Info("authorization denied", "subject", pr.Subject, "permission", perm)
+		return ErrForbidden{Subject: pr.Subject, Permission: perm}
+	}
+	return nil
+}
+
+func grants(perms []Permission, perm Permission) bool {
+	return slices.Contains(perms, PermAll) || slices.Contains(perms, perm)
+}
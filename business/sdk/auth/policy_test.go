@@ -0,0 +1,128 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aborilov/hippo/business/sdk/auth"
+)
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+		err  bool
+	}{
+		{
+			name: "default",
+			in:   "viewer=medication:read;pharmacist=medication:read|medication:write;admin=*",
+			want: "admin=*;pharmacist=medication:read|medication:write;viewer=medication:read",
+		},
+		{
+			name: "spaces and empty entries",
+			in:   " viewer = medication:read | ;; ops=debug:loglevel ",
+			want: "ops=debug:loglevel;viewer=medication:read",
+		},
+		{name: "empty", in: "", want: ""},
+		{name: "unknown permission", in: "viewer=medication:reed", err: true},
+		{name: "missing role", in: "=medication:read", err: true},
+		{name: "missing permissions", in: "viewer", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := auth.ParsePolicy(tt.in)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("got %s, want an error", p)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse: %s", err)
+			}
+			if p.String() != tt.want {
+				t.Errorf("got %s, want %s", p, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	p, err := auth.ParsePolicy("viewer=medication:read;pharmacist=medication:read|medication:write;admin=*")
+	if err != nil {
+		t.Fatalf("parse: %s", err)
+	}
+
+	tests := []struct {
+		name      string
+		principal *auth.Principal
+		perm      auth.Permission
+		detail    string
+		err       error
+	}{
+		{
+			name:      "role",
+			principal: &auth.Principal{Subject: "alice", Roles: []auth.Role{auth.RoleViewer}},
+			perm:      auth.PermMedicationRead,
+		},
+		{
+			name:      "one of several roles",
+			principal: &auth.Principal{Subject: "alice", Roles: []auth.Role{auth.RoleViewer, auth.RolePharmacist}},
+			perm:      auth.PermMedicationWrite,
+		},
+		{
+			name:      "all",
+			principal: &auth.Principal{Subject: "alice", Roles: []auth.Role{auth.RoleAdmin}},
+			perm:      auth.PermMedicationPurge,
+		},
+		{
+			name:      "direct permission",
+			principal: &auth.Principal{Subject: "nightly-sync", Permissions: []auth.Permission{auth.PermMedicationDelete}},
+			perm:      auth.PermMedicationDelete,
+		},
+		{
+			name:      "unknown role",
+			principal: &auth.Principal{Subject: "alice", Roles: []auth.Role{"auditor"}},
+			perm:      auth.PermMedicationRead,
+			detail:    "MISSING_PERMISSION_MEDICATION_READ",
+		},
+		{
+			name:      "missing permission",
+			principal: &auth.Principal{Subject: "alice", Roles: []auth.Role{auth.RolePharmacist}},
+			perm:      auth.PermMedicationDelete,
+			detail:    "MISSING_PERMISSION_MEDICATION_DELETE",
+		},
+		{
+			name: "anonymous",
+			perm: auth.PermMedicationRead,
+			err:  auth.ErrUnauthenticated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.principal != nil {
+				ctx = auth.SetPrincipal(ctx, *tt.principal)
+			}
+			err := p.Authorize(ctx, tt.perm)
+
+			var forbidden auth.ErrForbidden
+			switch {
+			case tt.err != nil:
+				if !errors.Is(err, tt.err) {
+					t.Errorf("got %v, want %v", err, tt.err)
+				}
+			case tt.detail != "":
+				if !errors.As(err, &forbidden) || forbidden.DetailCode() != tt.detail {
+					t.Errorf("got %v, want a denial with %s", err, tt.detail)
+				}
+			case err != nil:
+				t.Errorf("authorize: %s", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+// Package fixture loads environment specific data sets from JSON files.
+//
+// Fixtures live in one directory per environment, with one file per entity
+// named after its loader:
+//
+//	fixtures/dev/medication.json
+//	fixtures/demo/medication.json
+package fixture
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Loader stores the fixtures of one entity. Loaders are expected to upsert
+// by a stable key so fixtures can be loaded any number of times.
+type Loader interface {
+	// Name is the base name of the JSON file holding the fixtures.
+	Name() string
+
+	// Load stores the fixtures of the JSON document and returns how many
+	// were loaded.
+	Load(ctx context.Context, data []byte) (int, error)
+}
+
+// Result reports the fixtures loaded from one file.
+type Result struct {
+	File  string
+	Count int
+}
+
+// Load runs the loaders, in order, against the fixture files of env in dir.
+// Entities without a file are skipped, while files no loader handles are
+// rejected before anything is loaded.
+func Load(ctx context.Context, dir string, env string, loaders ...Loader) ([]Result, error) {
+	envDir := filepath.Join(dir, env)
+	entries, err := os.ReadDir(envDir)
+	if err != nil {
+		return nil, fmt.Errorf("read fixtures for %s: %w", env, err)
+	}
+
+	known := make(map[string]bool, len(loaders))
+	for _, l := range loaders {
+		known[l.Name()+".json"] = true
+	}
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".json") && !known[e.Name()] {
+			return nil, fmt.Errorf("no loader for fixture file %s", filepath.Join(envDir, e.Name()))
+		}
+	}
+
+	var results []Result
+	for _, l := range loaders {
+		file := filepath.Join(envDir, l.Name()+".json")
+		data, err := os.ReadFile(file)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return results, err
+		}
+
+		n, err := l.Load(ctx, data)
+		if err != nil {
+			return results, fmt.Errorf("%s: %w", file, err)
+		}
+		results = append(results, Result{File: file, Count: n})
+	}
+	return results, nil
+}
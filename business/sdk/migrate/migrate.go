@@ -1,65 +1,334 @@
-// Package migrate contains the database schema, migrations and seeding data.
+// Package migrate contains the database schema and its migrations.
 package migrate
 
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	_ "embed"
-	"errors"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/aborilov/hippo/foundation/logger"
 	"github.com/ardanlabs/darwin/v3"
 	"github.com/ardanlabs/darwin/v3/dialects/postgres"
-	"github.com/ardanlabs/darwin/v3/drivers/generic"
 	"github.com/jmoiron/sqlx"
 )
 
-var (
-	//go:embed sql/migrate.sql
-	migrateDoc string
+const (
+	// logName is the name of the logger migrations are reported on.
+	logName = "migrate"
 
-	//go:embed sql/seed.sql
-	seedDoc string
+	// lockID is the advisory lock key serializing migrations.
+	lockID int64 = 0x686970706f // "hippo"
 )
 
+//go:embed sql/migrate.sql
+var migrateDoc string
+
+// Querier reads the state of the migrations. The pool, *sqlx.DB or *sql.DB,
+// and a single connection or transaction all satisfy it, so the reads can
+// run on the connection holding the migration lock.
+type Querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Migration is a migration defined in this package and its state in the
+// database.
+type Migration struct {
+	Version     float64
+	Description string
+	Script      string
+	Checksum    string
+
+	// Down is the script reverting the migration, empty when it can't be
+	// rolled back.
+	Down string
+
+	// Applied is set once the migration has run, AppliedAt and
+	// AppliedChecksum then describe that run.
+	Applied         bool
+	AppliedAt       time.Time
+	AppliedChecksum string
+}
+
+// Drifted reports whether the migration was edited after it was applied.
+func (m Migration) Drifted() bool {
+	return m.Applied && m.AppliedChecksum != m.Checksum
+}
+
+// ErrDrift is returned when applied migrations no longer match the scripts
+// in this package, either because they were edited or removed.
+type ErrDrift struct {
+	Versions []float64
+}
+
+func (e ErrDrift) Error() string {
+	versions := make([]string, len(e.Versions))
+	for i, v := range e.Versions {
+		versions[i] = strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprintf("applied migrations changed since they ran: %s", strings.Join(versions, ", "))
+}
+
 // Migrate attempts to bring the database up to date with the migrations
-// defined in this package.
+// defined in this package. It holds a Postgres advisory lock while it runs,
+// so concurrent callers wait for each other and only the first applies the
+// pending migrations. It refuses to run when applied migrations have
+// drifted. Waiting for the lock and running the migrations are bounded by
+// ctx only, the statement timeout of the connection does not apply.
 func Migrate(ctx context.Context, db *sqlx.DB) error {
-	driver, err := generic.New(db.DB, postgres.Dialect{})
+	log := logger.FromContext(ctx).WithName(logName)
+
+	conn, unlock, err := lock(ctx, db)
 	if err != nil {
-		return fmt.Errorf("construct darwin driver: %w", err)
+		return err
 	}
+	defer unlock()
 
-	d := darwin.New(driver, darwin.ParseMigrations(migrateDoc))
-	return d.Migrate()
-}
+	if err := Verify(ctx, conn); err != nil {
+		return err
+	}
 
-// Seed runs the seed document defined in this package against db. The queries
-// are run in a transaction and rolled back if any fail.
-func Seed(ctx context.Context, db *sqlx.DB) (err error) {
-	tx, err := db.Begin()
+	planned, err := Plan(ctx, conn)
 	if err != nil {
 		return err
 	}
+	if len(planned) == 0 {
+		log.Info("database is up to date", "version", ExpectedVersion())
+		return nil
+	}
+
+	if _, err := conn.ExecContext(ctx, postgres.Dialect{}.CreateTableSQL()); err != nil {
+		return fmt.Errorf("create migrations table: %w", err)
+	}
+
+	for _, m := range planned {
+		if err := apply(ctx, conn, m); err != nil {
+			return err
+		}
+		log.Info("migration applied", "version", m.Version, "description", m.Description)
+	}
+	return nil
+}
+
+// lock takes the migration advisory lock and returns the connection holding
+// it along with the function releasing it. Advisory locks belong to the
+// session, so the lock is taken and released on one dedicated connection,
+// whose statement timeout is lifted until the lock is released.
+func lock(ctx context.Context, db *sqlx.DB) (*sql.Conn, func(), error) {
+	log := logger.FromContext(ctx).WithName(logName)
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("acquire connection: %w", err)
+	}
+
+	if _, err := conn.ExecContext(ctx, "SET statement_timeout = 0"); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("lift statement timeout: %w", err)
+	}
+
+	start := time.Now()
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockID); err != nil {
+		// The session may still be waiting for the lock and get it later,
+		// discard it rather than handing it back to the pool.
+		conn.Raw(func(any) error { return driver.ErrBadConn })
+		conn.Close()
+		return nil, nil, fmt.Errorf("acquire migration lock: %w", err)
+	}
+	log.Info("migration lock acquired", "wait", time.Since(start).String())
 
-	defer func() {
-		if errTx := tx.Rollback(); errTx != nil {
-			if errors.Is(errTx, sql.ErrTxDone) {
-				return
-			}
+	unlock := func() {
+		defer conn.Close()
 
-			err = fmt.Errorf("rollback: %w", errTx)
+		// When the unlock fails the connection is discarded instead, which
+		// ends the session and releases the lock with it.
+		ctx := context.WithoutCancel(ctx)
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", lockID); err != nil {
+			log.Error(err, "release migration lock")
+			conn.Raw(func(any) error { return driver.ErrBadConn })
 			return
 		}
-	}()
+		if _, err := conn.ExecContext(ctx, "RESET statement_timeout"); err != nil {
+			conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+	}
+	return conn, unlock, nil
+}
+
+// apply runs the script of m and records it in the darwin table in one
+// transaction, so a failing migration leaves no trace.
+func apply(ctx context.Context, conn *sql.Conn, m Migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	start := time.Now()
+	if _, err := tx.ExecContext(ctx, m.Script); err != nil {
+		return fmt.Errorf("apply %s: %w", strconv.FormatFloat(m.Version, 'f', -1, 64), err)
+	}
+
+	elapsed := time.Since(start)
+	if _, err := tx.ExecContext(ctx, postgres.Dialect{}.InsertSQL(),
+		m.Version, m.Description, m.Checksum, start.Unix(), float64(elapsed)); err != nil {
+		return fmt.Errorf("track %s: %w", strconv.FormatFloat(m.Version, 'f', -1, 64), err)
+	}
+
+	return tx.Commit()
+}
+
+// Status returns every migration defined in this package, in version order,
+// with its state in the database.
+func Status(ctx context.Context, db Querier) ([]Migration, error) {
+	applied, err := appliedMigrations(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	downs := downScripts()
+	parsed := darwin.ParseMigrations(migrateDoc)
+	migs := make([]Migration, 0, len(parsed))
+	for _, pm := range parsed {
+		m := Migration{
+			Version:     pm.Version,
+			Description: pm.Description,
+			Script:      pm.Script,
+			Checksum:    pm.Checksum(),
+			Down:        downs[pm.Version],
+		}
+		if rec, ok := applied[pm.Version]; ok {
+			m.Applied = true
+			m.AppliedAt = rec.AppliedAt
+			m.AppliedChecksum = rec.Checksum
+		}
+		migs = append(migs, m)
+	}
+	sort.Slice(migs, func(i, j int) bool { return migs[i].Version < migs[j].Version })
+	return migs, nil
+}
 
-	if _, err := tx.Exec(seedDoc); err != nil {
-		return fmt.Errorf("exec: %w", err)
+// Plan returns the migrations Migrate would run, in the order it would run
+// them.
+func Plan(ctx context.Context, db Querier) ([]Migration, error) {
+	migs, err := Status(ctx, db)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("commit: %w", err)
+	// Like darwin, only versions after the latest applied one are run.
+	var last float64
+	for _, m := range migs {
+		if m.Applied {
+			last = max(last, m.Version)
+		}
+	}
+
+	var pending []Migration
+	for _, m := range migs {
+		if m.Version > last {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// Verify returns ErrDrift when an applied migration was edited or removed
+// from this package since it ran.
+func Verify(ctx context.Context, db Querier) error {
+	applied, err := appliedMigrations(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	var drift ErrDrift
+	for _, pm := range darwin.ParseMigrations(migrateDoc) {
+		if rec, ok := applied[pm.Version]; ok && rec.Checksum != pm.Checksum() {
+			drift.Versions = append(drift.Versions, pm.Version)
+		}
+		delete(applied, pm.Version)
+	}
+	for v := range applied {
+		drift.Versions = append(drift.Versions, v)
 	}
 
+	if len(drift.Versions) > 0 {
+		sort.Float64s(drift.Versions)
+		return drift
+	}
 	return nil
 }
+
+// appliedMigrations returns the darwin records by version. It returns no
+// records when migrations have never run, without creating the darwin table.
+func appliedMigrations(ctx context.Context, db Querier) (map[float64]darwin.MigrationRecord, error) {
+	var exists bool
+	if err := db.QueryRowContext(ctx, "SELECT to_regclass('darwin_migrations') IS NOT NULL").Scan(&exists); err != nil {
+		return nil, fmt.Errorf("check migrations table: %w", err)
+	}
+	if !exists {
+		return map[float64]darwin.MigrationRecord{}, nil
+	}
+
+	rows, err := db.QueryContext(ctx, postgres.Dialect{}.AllSQL())
+	if err != nil {
+		return nil, fmt.Errorf("list applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := map[float64]darwin.MigrationRecord{}
+	for rows.Next() {
+		var (
+			rec           darwin.MigrationRecord
+			appliedAt     int64
+			executionTime float64
+		)
+		if err := rows.Scan(&rec.Version, &rec.Description, &rec.Checksum, &appliedAt, &executionTime); err != nil {
+			return nil, fmt.Errorf("scan applied migration: %w", err)
+		}
+		rec.Version = roundVersion(rec.Version)
+		rec.AppliedAt = time.Unix(appliedAt, 0)
+		rec.ExecutionTime = time.Duration(executionTime)
+		applied[rec.Version] = rec
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list applied migrations: %w", err)
+	}
+	return applied, nil
+}
+
+// roundVersion rounds a version read back from its REAL column to the
+// precision darwin parses versions with.
+func roundVersion(v float64) float64 {
+	r, err := strconv.ParseFloat(strconv.FormatFloat(v, 'f', 5, 64), 64)
+	if err != nil {
+		return v
+	}
+	return r
+}
+
+// ExpectedVersion returns the latest migration version defined in this
+// package, which is the schema version the binary expects.
+func ExpectedVersion() float64 {
+	var version float64
+	for _, m := range darwin.ParseMigrations(migrateDoc) {
+		version = max(version, m.Version)
+	}
+	return version
+}
+
+// AppliedVersion returns the latest migration version applied to the
+// database, or 0 when no migration has run.
+func AppliedVersion(ctx context.Context, db Querier) (float64, error) {
+	var version sql.NullFloat64
+	if err := db.QueryRowContext(ctx, "SELECT max(version) FROM darwin_migrations").Scan(&version); err != nil {
+		return 0, fmt.Errorf("list applied migrations: %w", err)
+	}
+	return roundVersion(version.Float64), nil
+}
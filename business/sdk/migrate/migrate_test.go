@@ -0,0 +1,381 @@
+package migrate_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aborilov/hippo/business/sdk/migrate"
+	"github.com/jmoiron/sqlx"
+)
+
+// record is a row of the darwin table.
+type record struct {
+	version  float64
+	checksum string
+}
+
+// database stands in for Postgres. It keeps the darwin table and records
+// every other statement run against it.
+type database struct {
+	mu      sync.Mutex
+	tracked bool
+	records []record
+	execs   []string
+}
+
+// open returns a handle on a database holding records.
+func open(t *testing.T, records ...record) (*sqlx.DB, *database) {
+	t.Helper()
+
+	d := &database{tracked: len(records) > 0, records: records}
+	db := sqlx.NewDb(sql.OpenDB(d), "pgx")
+	t.Cleanup(func() { db.Close() })
+	return db, d
+}
+
+// applied returns the records of the migrations defined in the package up to
+// version, as Migrate would have written them.
+func applied(t *testing.T, version float64) []record {
+	t.Helper()
+
+	db, _ := open(t)
+	migs, err := migrate.Status(context.Background(), db)
+	if err != nil {
+		t.Fatalf("status: %s", err)
+	}
+	var records []record
+	for _, m := range migs {
+		if m.Version <= version {
+			records = append(records, record{version: m.Version, checksum: m.Checksum})
+		}
+	}
+	return records
+}
+
+// versions returns the versions of migs.
+func versions(migs []migrate.Migration) []float64 {
+	var vs []float64
+	for _, m := range migs {
+		vs = append(vs, m.Version)
+	}
+	return vs
+}
+
+func (d *database) Connect(context.Context) (driver.Conn, error) { return conn{d}, nil }
+func (d *database) Driver() driver.Driver                        { return nil }
+
+func (d *database) versions() []float64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var vs []float64
+	for _, r := range d.records {
+		vs = append(vs, r.version)
+	}
+	slices.Sort(vs)
+	return vs
+}
+
+type conn struct{ d *database }
+
+func (c conn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c conn) Close() error                        { return nil }
+func (c conn) Begin() (driver.Tx, error)           { return c, nil }
+func (c conn) Commit() error                       { return nil }
+func (c conn) Rollback() error                     { return nil }
+
+func (c conn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+
+	switch {
+	case strings.HasPrefix(query, "CREATE TABLE IF NOT EXISTS darwin_migrations"):
+		c.d.tracked = true
+	case strings.HasPrefix(query, "INSERT INTO darwin_migrations"):
+		c.d.records = append(c.d.records, record{version: args[0].Value.(float64), checksum: args[2].Value.(string)})
+	case strings.HasPrefix(query, "DELETE FROM darwin_migrations"):
+		v := args[0].Value.(float64)
+		c.d.records = slices.DeleteFunc(c.d.records, func(r record) bool { return r.version == v })
+	default:
+		c.d.execs = append(c.d.execs, query)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c conn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+
+	switch {
+	case strings.Contains(query, "to_regclass('darwin_migrations')"):
+		return &rows{cols: []string{"exists"}, values: [][]driver.Value{{c.d.tracked}}}, nil
+	case strings.Contains(query, "darwin_migrations") && c.d.tracked:
+		r := rows{cols: []string{"version", "description", "checksum", "applied_at", "execution_time"}}
+		for _, rec := range c.d.records {
+			r.values = append(r.values, []driver.Value{rec.version, "", rec.checksum, int64(0), float64(0)})
+		}
+		return &r, nil
+	case strings.Contains(query, "darwin_migrations"):
+		return nil, errors.New(`relation "darwin_migrations" does not exist`)
+	}
+	return nil, errors.New("unexpected query: " + query)
+}
+
+type rows struct {
+	cols   []string
+	values [][]driver.Value
+}
+
+func (r *rows) Columns() []string { return r.cols }
+func (r *rows) Close() error      { return nil }
+
+func (r *rows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func TestPlan(t *testing.T) {
+	tests := []struct {
+		name    string
+		records func(t *testing.T) []record
+		applied []float64
+		pending []float64
+	}{
+		{
+			name:    "fresh database",
+			records: func(*testing.T) []record { return nil },
+			pending: []float64{1.01, 1.02, 1.03, 1.04, 1.05, 1.06, 1.07, 1.08},
+		},
+		{
+			name:    "partly applied",
+			records: func(t *testing.T) []record { return applied(t, 1.03) },
+			applied: []float64{1.01, 1.02, 1.03},
+			pending: []float64{1.04, 1.05, 1.06, 1.07, 1.08},
+		},
+		{
+			name:    "up to date",
+			records: func(t *testing.T) []record { return applied(t, 1.08) },
+			applied: []float64{1.01, 1.02, 1.03, 1.04, 1.05, 1.06, 1.07, 1.08},
+		},
+		{
+			name: "gap",
+			records: func(t *testing.T) []record {
+				return slices.DeleteFunc(applied(t, 1.04), func(r record) bool { return r.version == 1.02 })
+			},
+			applied: []float64{1.01, 1.03, 1.04},
+			pending: []float64{1.05, 1.06, 1.07, 1.08},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := open(t, tt.records(t)...)
+
+			migs, err := migrate.Status(context.Background(), db)
+			if err != nil {
+				t.Fatalf("status: %s", err)
+			}
+			var got []float64
+			for _, m := range migs {
+				if m.Applied {
+					got = append(got, m.Version)
+				}
+			}
+			if !slices.Equal(got, tt.applied) {
+				t.Errorf("got applied %v, want %v", got, tt.applied)
+			}
+
+			planned, err := migrate.Plan(context.Background(), db)
+			if err != nil {
+				t.Fatalf("plan: %s", err)
+			}
+			if got := versions(planned); !slices.Equal(got, tt.pending) {
+				t.Errorf("got pending %v, want %v", got, tt.pending)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name    string
+		records func(t *testing.T) []record
+		drift   []float64
+	}{
+		{
+			name:    "fresh database",
+			records: func(*testing.T) []record { return nil },
+		},
+		{
+			name:    "unchanged",
+			records: func(t *testing.T) []record { return applied(t, 1.08) },
+		},
+		{
+			name: "edited",
+			records: func(t *testing.T) []record {
+				records := applied(t, 1.04)
+				records[1].checksum = "0"
+				records[3].checksum = "0"
+				return records
+			},
+			drift: []float64{1.02, 1.04},
+		},
+		{
+			name: "removed",
+			records: func(t *testing.T) []record {
+				return append(applied(t, 1.02), record{version: 0.5, checksum: "0"})
+			},
+			drift: []float64{0.5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, _ := open(t, tt.records(t)...)
+
+			err := migrate.Verify(context.Background(), db)
+
+			var drift migrate.ErrDrift
+			switch {
+			case tt.drift == nil && err != nil:
+				t.Errorf("verify: %s", err)
+			case tt.drift != nil && !errors.As(err, &drift):
+				t.Errorf("got %v, want drift of %v", err, tt.drift)
+			case tt.drift != nil && !slices.Equal(drift.Versions, tt.drift):
+				t.Errorf("got drift of %v, want %v", drift.Versions, tt.drift)
+			}
+
+			migs, err := migrate.Status(context.Background(), db)
+			if err != nil {
+				t.Fatalf("status: %s", err)
+			}
+			for _, m := range migs {
+				if m.Drifted() != slices.Contains(tt.drift, m.Version) {
+					t.Errorf("%v: got drifted %t", m.Version, m.Drifted())
+				}
+			}
+		})
+	}
+}
+
+func TestRollback(t *testing.T) {
+	tests := []struct {
+		name     string
+		records  func(t *testing.T) []record
+		to       float64
+		reverted []float64
+		left     []float64
+		err      bool
+	}{
+		{
+			name:     "to a version",
+			records:  func(t *testing.T) []record { return applied(t, 1.08) },
+			to:       1.04,
+			reverted: []float64{1.08, 1.07, 1.06, 1.05},
+			left:     []float64{1.01, 1.02, 1.03, 1.04},
+		},
+		{
+			name:     "everything",
+			records:  func(t *testing.T) []record { return applied(t, 1.03) },
+			to:       0,
+			reverted: []float64{1.03, 1.02, 1.01},
+		},
+		{
+			name:    "nothing newer",
+			records: func(t *testing.T) []record { return applied(t, 1.03) },
+			to:      1.04,
+			left:    []float64{1.01, 1.02, 1.03},
+		},
+		{
+			name:    "unknown version",
+			records: func(t *testing.T) []record { return applied(t, 1.08) },
+			to:      1.045,
+			left:    []float64{1.01, 1.02, 1.03, 1.04, 1.05, 1.06, 1.07, 1.08},
+			err:     true,
+		},
+		{
+			name: "drift",
+			records: func(t *testing.T) []record {
+				records := applied(t, 1.08)
+				records[7].checksum = "0"
+				return records
+			},
+			to:   1.04,
+			left: []float64{1.01, 1.02, 1.03, 1.04, 1.05, 1.06, 1.07, 1.08},
+			err:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, d := open(t, tt.records(t)...)
+			migs, err := migrate.Status(context.Background(), db)
+			if err != nil {
+				t.Fatalf("status: %s", err)
+			}
+			downs := map[float64]string{}
+			isDown := map[string]bool{}
+			for _, m := range migs {
+				downs[m.Version] = m.Down
+				isDown[m.Down] = true
+			}
+
+			reverted, err := migrate.Rollback(context.Background(), db, tt.to)
+			if tt.err != (err != nil) {
+				t.Fatalf("got error %v, want one: %t", err, tt.err)
+			}
+			if got := versions(reverted); !slices.Equal(got, tt.reverted) {
+				t.Errorf("reverted %v, want %v", got, tt.reverted)
+			}
+			if got := d.versions(); !slices.Equal(got, tt.left) {
+				t.Errorf("left %v applied, want %v", got, tt.left)
+			}
+
+			var scripts []string
+			for _, v := range tt.reverted {
+				scripts = append(scripts, downs[v])
+			}
+			var ran []string
+			for _, q := range d.execs {
+				if isDown[q] {
+					ran = append(ran, q)
+				}
+			}
+			if !slices.Equal(ran, scripts) {
+				t.Errorf("ran down scripts %q, want %q", ran, scripts)
+			}
+		})
+	}
+}
+
+func TestMigrateOnOneConnection(t *testing.T) {
+	db, d := open(t, applied(t, 1.02)...)
+	db.SetMaxOpenConns(1)
+
+	// the state is read on the connection holding the lock, a second one
+	// would never be handed out
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := migrate.Migrate(ctx, db); err != nil {
+		t.Fatalf("migrate: %s", err)
+	}
+
+	if got, want := d.versions(), []float64{1.01, 1.02, 1.03, 1.04, 1.05, 1.06, 1.07, 1.08}; !slices.Equal(got, want) {
+		t.Errorf("got %v applied, want %v", got, want)
+	}
+	if i := slices.IndexFunc(d.execs, func(q string) bool { return strings.Contains(q, "pg_advisory_lock") }); i != 1 {
+		t.Errorf("got statements %q, want the lock taken first", d.execs)
+	}
+}
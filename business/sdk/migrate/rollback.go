@@ -0,0 +1,112 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/ardanlabs/darwin/v3"
+	"github.com/jmoiron/sqlx"
+)
+
+// rollbackDoc holds the down scripts, using the same version headers as
+// migrateDoc. A version without an entry can't be rolled back.
+//
+//go:embed sql/rollback.sql
+var rollbackDoc string
+
+// ErrIrreversible is returned when a migration that has to be rolled back
+// has no down script.
+type ErrIrreversible struct {
+	Version float64
+}
+
+func (e ErrIrreversible) Error() string {
+	return fmt.Sprintf("migration %s has no down script", strconv.FormatFloat(e.Version, 'f', -1, 64))
+}
+
+// downScripts returns the down scripts by version.
+func downScripts() map[float64]string {
+	downs := map[float64]string{}
+	for _, m := range darwin.ParseMigrations(rollbackDoc) {
+		downs[m.Version] = m.Script
+	}
+	return downs
+}
+
+// Rollback reverts every applied migration newer than version, newest first,
+// and removes them from the darwin table. It runs in a single transaction and
+// refuses to start when one of them has no down script. A version of 0 rolls
+// back all migrations. Like Migrate, it holds the migration lock while it
+// runs.
+func Rollback(ctx context.Context, db *sqlx.DB, version float64) (_ []Migration, err error) {
+	conn, unlock, err := lock(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if err := Verify(ctx, conn); err != nil {
+		return nil, err
+	}
+
+	migs, err := Status(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	if version != 0 && !slices.ContainsFunc(migs, func(m Migration) bool { return m.Version == version }) {
+		return nil, fmt.Errorf("unknown migration version %s", strconv.FormatFloat(version, 'f', -1, 64))
+	}
+
+	var revert []Migration
+	for _, m := range slices.Backward(migs) {
+		if m.Applied && m.Version > version {
+			if m.Down == "" {
+				return nil, ErrIrreversible{Version: m.Version}
+			}
+			revert = append(revert, m)
+		}
+	}
+	if len(revert) == 0 {
+		return nil, nil
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if errTx := tx.Rollback(); errTx != nil {
+			if errors.Is(errTx, sql.ErrTxDone) {
+				return
+			}
+
+			err = fmt.Errorf("rollback: %w", errTx)
+			return
+		}
+	}()
+
+	for _, m := range revert {
+		if _, err := tx.ExecContext(ctx, m.Down); err != nil {
+			return nil, fmt.Errorf("revert %s: %w", strconv.FormatFloat(m.Version, 'f', -1, 64), err)
+		}
+
+		// Versions are stored as REAL, compare them within the precision
+		// darwin parses them with.
+		const q = `DELETE FROM darwin_migrations WHERE abs(version - $1) < 0.000001`
+		if _, err := tx.ExecContext(ctx, q, m.Version); err != nil {
+			return nil, fmt.Errorf("untrack %s: %w", strconv.FormatFloat(m.Version, 'f', -1, 64), err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+
+	return revert, nil
+}
@@ -8,3 +8,83 @@ CREATE TABLE medication (
 
 	PRIMARY KEY (id)
 );
+
+-- Version: 1.02
+-- Description: Create table api_key
+CREATE TABLE api_key (
+	id           UUID,
+	name         TEXT        NOT NULL,
+	prefix       TEXT        NOT NULL,
+	hash         TEXT        NOT NULL,
+	permissions  TEXT[]      NOT NULL,
+	created_at   TIMESTAMPTZ NOT NULL,
+	expires_at   TIMESTAMPTZ NULL,
+	last_used_at TIMESTAMPTZ NULL,
+	revoked_at   TIMESTAMPTZ NULL,
+
+	PRIMARY KEY (id),
+	UNIQUE (hash)
+);
+
+-- Version: 1.03
+-- Description: Add medication external id
+ALTER TABLE medication ADD COLUMN external_id TEXT NULL;
+ALTER TABLE medication ADD CONSTRAINT medication_external_id_key UNIQUE (external_id);
+
+-- Version: 1.04
+-- Description: Add medication label details
+ALTER TABLE medication ADD COLUMN generic_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE medication ADD COLUMN route TEXT NOT NULL DEFAULT '';
+ALTER TABLE medication ADD COLUMN strength TEXT NOT NULL DEFAULT '';
+
+-- Version: 1.05
+-- Description: Create table medication_code
+CREATE TABLE medication_code (
+	medication_id UUID NOT NULL REFERENCES medication (id) ON DELETE CASCADE,
+	type          TEXT NOT NULL,
+	value         TEXT NOT NULL,
+
+	CONSTRAINT medication_code_key PRIMARY KEY (type, value)
+);
+CREATE INDEX medication_code_medication_id_idx ON medication_code (medication_id);
+
+-- Version: 1.06
+-- Description: Create tables atc and medication_atc
+CREATE TABLE atc (
+	code  TEXT     NOT NULL,
+	name  TEXT     NOT NULL,
+	level SMALLINT NOT NULL,
+
+	PRIMARY KEY (code)
+);
+CREATE INDEX atc_level_idx ON atc (level);
+CREATE TABLE medication_atc (
+	medication_id UUID NOT NULL REFERENCES medication (id) ON DELETE CASCADE,
+	atc_code      TEXT NOT NULL REFERENCES atc (code),
+
+	PRIMARY KEY (medication_id, atc_code)
+);
+CREATE INDEX medication_atc_atc_code_idx ON medication_atc (atc_code);
+
+-- Version: 1.07
+-- Description: Key the legacy seed row by external id
+UPDATE medication SET external_id = 'fixture:magic-pill'
+WHERE id = '5cf37266-3473-4006-984f-9325122678b7'
+	AND external_id IS NULL
+	AND NOT EXISTS (SELECT 1 FROM medication WHERE external_id = 'fixture:magic-pill');
+
+-- Version: 1.08
+-- Description: Create table import_job
+CREATE TABLE import_job (
+	id          UUID        NOT NULL,
+	owner       TEXT        NOT NULL,
+	status      TEXT        NOT NULL,
+	dry_run     BOOLEAN     NOT NULL,
+	started_at  TIMESTAMPTZ NOT NULL,
+	finished_at TIMESTAMPTZ NULL,
+	report      JSONB       NULL,
+	error       TEXT        NOT NULL DEFAULT '',
+
+	PRIMARY KEY (id)
+);
+CREATE INDEX import_job_started_at_idx ON import_job (started_at);
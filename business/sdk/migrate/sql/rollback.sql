@@ -0,0 +1,36 @@
+-- Version: 1.01
+-- Description: Drop table medication
+DROP TABLE medication;
+
+-- Version: 1.02
+-- Description: Drop table api_key
+DROP TABLE api_key;
+
+-- Version: 1.03
+-- Description: Drop medication external id
+ALTER TABLE medication DROP CONSTRAINT medication_external_id_key;
+ALTER TABLE medication DROP COLUMN external_id;
+
+-- Version: 1.04
+-- Description: Drop medication label details
+ALTER TABLE medication DROP COLUMN strength;
+ALTER TABLE medication DROP COLUMN route;
+ALTER TABLE medication DROP COLUMN generic_name;
+
+-- Version: 1.05
+-- Description: Drop table medication_code
+DROP TABLE medication_code;
+
+-- Version: 1.06
+-- Description: Drop tables atc and medication_atc
+DROP TABLE medication_atc;
+DROP TABLE atc;
+
+-- Version: 1.07
+-- Description: Unkey the legacy seed row
+UPDATE medication SET external_id = NULL
+WHERE id = '5cf37266-3473-4006-984f-9325122678b7' AND external_id = 'fixture:magic-pill';
+
+-- Version: 1.08
+-- Description: Drop table import_job
+DROP TABLE import_job;
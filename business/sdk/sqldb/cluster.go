@@ -0,0 +1,208 @@
+package sqldb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/aborilov/hippo/foundation/logger"
+	"github.com/jmoiron/sqlx"
+)
+
+// Cluster is a primary database with an optional set of read replicas.
+// Writes always go to the primary; reads are spread over the healthy
+// replicas and fall back to the primary when none is available.
+type Cluster struct {
+	primary  *sqlx.DB
+	replicas []*replica
+	next     atomic.Uint64
+}
+
+type replica struct {
+	name    string
+	db      *sqlx.DB
+	healthy atomic.Bool
+}
+
+// OpenCluster opens the primary described by cfg and one replica for each of
+// replicas. ReplicaConfigs derives replica configs from the primary one.
+func OpenCluster(cfg Config, replicas []Config) (*Cluster, error) {
+	primary, err := Open(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	dbs := make([]*sqlx.DB, 0, len(replicas))
+	for _, rcfg := range replicas {
+		db, err := Open(rcfg)
+		if err != nil {
+			primary.Close()
+			for _, r := range dbs {
+				r.Close()
+			}
+			return nil, fmt.Errorf("replica %s: %w", rcfg.Host, err)
+		}
+		dbs = append(dbs, db)
+	}
+
+	return NewCluster(primary, dbs...), nil
+}
+
+// ReplicaConfigs returns a replica config for each of hosts, sharing every
+// other setting of cfg, followed by one for each of dsns. A dsn is a postgres
+// URL whose parts override the matching settings of cfg, so a replica can
+// have its own credentials, database or TLS files.
+func ReplicaConfigs(cfg Config, hosts []string, dsns []string) ([]Config, error) {
+	replicas := make([]Config, 0, len(hosts)+len(dsns))
+	for _, host := range hosts {
+		rcfg := cfg
+		rcfg.Host = host
+		replicas = append(replicas, rcfg)
+	}
+	for i, dsn := range dsns {
+		rcfg, err := cfg.Override(dsn)
+		if err != nil {
+			return nil, fmt.Errorf("replica dsn %d: %w", i+1, err)
+		}
+		replicas = append(replicas, rcfg)
+	}
+	return replicas, nil
+}
+
+// NewCluster groups already opened handles. Replicas start out healthy until
+// the first failed health check.
+func NewCluster(primary *sqlx.DB, replicas ...*sqlx.DB) *Cluster {
+	c := Cluster{primary: primary}
+	for i, db := range replicas {
+		r := replica{name: fmt.Sprintf("replica-%d", i+1), db: db}
+		r.healthy.Store(true)
+		c.replicas = append(c.replicas, &r)
+	}
+	return &c
+}
+
+// Primary returns the primary handle without marking the context as having
+// written. It is meant for infrastructure such as migrations and health
+// checks.
+func (c *Cluster) Primary() *sqlx.DB {
+	return c.primary
+}
+
+// Writer returns the primary handle and pins the rest of the request to it
+// when read-your-writes is enabled for ctx.
+func (c *Cluster) Writer(ctx context.Context) *sqlx.DB {
+	if p, ok := ctx.Value(pinKey).(*pin); ok {
+		p.primary.Store(true)
+		p.wrote.Store(true)
+	}
+	return c.primary
+}
+
+// Reader returns the next healthy replica in round-robin order, or the
+// primary when ctx is pinned to it or no replica is healthy.
+func (c *Cluster) Reader(ctx context.Context) *sqlx.DB {
+	if p, ok := ctx.Value(pinKey).(*pin); ok && p.primary.Load() {
+		return c.primary
+	}
+
+	n := len(c.replicas)
+	if n == 0 {
+		return c.primary
+	}
+
+	start := c.next.Add(1)
+	for i := range n {
+		r := c.replicas[(start+uint64(i))%uint64(n)]
+		if r.healthy.Load() {
+			return r.db
+		}
+	}
+	return c.primary
+}
+
+// Monitor health checks the replicas every interval until ctx is cancelled,
+// taking failing replicas out of rotation and putting them back once they
+// answer again.
+func (c *Cluster) Monitor(ctx context.Context, interval time.Duration, timeout time.Duration) {
+	if len(c.replicas) == 0 {
+		return
+	}
+
+	log := logger.FromContext(ctx).WithName("sqldb")
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for _, r := range c.replicas {
+			pingCtx, cancel := context.WithTimeout(ctx, timeout)
+			err := ping(pingCtx, r.db)
+			cancel()
+
+			healthy := err == nil
+			if r.healthy.Swap(healthy) == healthy {
+				continue
+			}
+			if healthy {
+				log.Info("replica healthy", "pool", r.name)
+			} else {
+				log.Info("replica unhealthy", "pool", r.name, "error", err.Error())
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close closes the primary and all replicas.
+func (c *Cluster) Close() error {
+	errs := []error{c.primary.Close()}
+	for _, r := range c.replicas {
+		errs = append(errs, r.db.Close())
+	}
+	return errors.Join(errs...)
+}
+
+type ctxKey int
+
+const pinKey ctxKey = 1
+
+// pin tracks whether the reads of a context go to the primary and whether
+// it has written.
+type pin struct {
+	primary atomic.Bool
+	wrote   atomic.Bool
+}
+
+// WithReadYourWrites returns a context whose reads go to the primary once a
+// write has been made through Writer, so a request always sees its own
+// changes regardless of replication lag. Wrote tells whether it has written,
+// so the caller can keep its next requests on the primary as well.
+func WithReadYourWrites(ctx context.Context) context.Context {
+	return context.WithValue(ctx, pinKey, new(pin))
+}
+
+// Wrote reports whether a write has been made through Writer with a context
+// set up by WithReadYourWrites.
+func Wrote(ctx context.Context) bool {
+	p, ok := ctx.Value(pinKey).(*pin)
+	return ok && p.wrote.Load()
+}
+
+// WithPrimary returns a context whose reads go to the primary, for reads
+// that decide what to write next or follow a recent write. A context already
+// set up for read-your-writes is pinned in place.
+func WithPrimary(ctx context.Context) context.Context {
+	if p, ok := ctx.Value(pinKey).(*pin); ok {
+		p.primary.Store(true)
+		return ctx
+	}
+	p := new(pin)
+	p.primary.Store(true)
+	return context.WithValue(ctx, pinKey, p)
+}
@@ -0,0 +1,76 @@
+package sqldb_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aborilov/hippo/business/sdk/sqldb"
+	"github.com/jmoiron/sqlx"
+)
+
+func open(t *testing.T, host string) *sqlx.DB {
+	t.Helper()
+
+	// nothing connects: the handles are only told apart
+	db, err := sqlx.Open("pgx", "postgres://"+host+"/hippo")
+	if err != nil {
+		t.Fatalf("open %s: %s", host, err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestClusterRouting(t *testing.T) {
+	primary, replica := open(t, "primary"), open(t, "replica")
+	c := sqldb.NewCluster(primary, replica)
+
+	ctx := context.Background()
+	c.Writer(ctx)
+	if c.Reader(ctx) != replica {
+		t.Error("a write without read-your-writes pinned reads to the primary")
+	}
+
+	ctx = sqldb.WithReadYourWrites(context.Background())
+	if c.Reader(ctx) != replica || sqldb.Wrote(ctx) {
+		t.Error("a request that hasn't written reads from the primary")
+	}
+	c.Writer(ctx)
+	if c.Reader(ctx) != primary || !sqldb.Wrote(ctx) {
+		t.Error("a request that has written reads from a replica")
+	}
+
+	ctx = sqldb.WithPrimary(context.Background())
+	if c.Reader(ctx) != primary || sqldb.Wrote(ctx) {
+		t.Error("a primary read went to a replica or counted as a write")
+	}
+
+	if sqldb.NewCluster(primary).Reader(context.Background()) != primary {
+		t.Error("a cluster without replicas reads from nowhere")
+	}
+}
+
+func TestReplicaConfigs(t *testing.T) {
+	cfg := sqldb.Config{User: "hippo", Host: "primary", Name: "hippo"}
+
+	got, err := sqldb.ReplicaConfigs(cfg, []string{"replica-1", "replica-2"}, []string{"postgres://reader@replica-3/reports"})
+	if err != nil {
+		t.Fatalf("replica configs: %s", err)
+	}
+	want := []sqldb.Config{
+		{User: "hippo", Host: "replica-1", Name: "hippo"},
+		{User: "hippo", Host: "replica-2", Name: "hippo"},
+		{User: "reader", Host: "replica-3", Name: "reports"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d configs, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("replica %d: got %+v, want %+v", i+1, got[i], want[i])
+		}
+	}
+
+	if _, err := sqldb.ReplicaConfigs(cfg, nil, []string{"postgres://replica?x=1"}); err == nil {
+		t.Error("accepted a dsn with an unknown parameter")
+	}
+}
@@ -0,0 +1,63 @@
+package sqldb
+
+import (
+	"database/sql"
+
+	"github.com/aborilov/hippo/foundation/metrics"
+	"github.com/jmoiron/sqlx"
+)
+
+// StatsCollector reports the connection pool statistics of db, labelled with
+// the name of the pool.
+func StatsCollector(name string, db *sqlx.DB) metrics.Collector {
+	return metrics.CollectorFunc(func() []metrics.Family {
+		return statsFamilies(name, db.Stats())
+	})
+}
+
+// ClusterCollector reports the pool statistics of the primary and every
+// replica of c, along with whether each replica is in rotation.
+func ClusterCollector(c *Cluster) metrics.Collector {
+	return metrics.CollectorFunc(func() []metrics.Family {
+		fams := statsFamilies("primary", c.primary.Stats())
+		for _, r := range c.replicas {
+			fams = append(fams, statsFamilies(r.name, r.db.Stats())...)
+
+			var up float64
+			if r.healthy.Load() {
+				up = 1
+			}
+			fams = append(fams, metrics.Family{
+				Name:    "hippo_db_replica_up",
+				Help:    "Whether the replica passed its last health check.",
+				Type:    metrics.TypeGauge,
+				Samples: []metrics.Sample{{Labels: []metrics.Label{{Name: "pool", Value: r.name}}, Value: up}},
+			})
+		}
+		return fams
+	})
+}
+
+func statsFamilies(name string, s sql.DBStats) []metrics.Family {
+	labels := []metrics.Label{{Name: "pool", Value: name}}
+	family := func(metric string, typ string, help string, v float64) metrics.Family {
+		return metrics.Family{
+			Name:    "hippo_db_" + metric,
+			Help:    help,
+			Type:    typ,
+			Samples: []metrics.Sample{{Labels: labels, Value: v}},
+		}
+	}
+
+	return []metrics.Family{
+		family("max_open_connections", metrics.TypeGauge, "Maximum number of open connections to the database.", float64(s.MaxOpenConnections)),
+		family("open_connections", metrics.TypeGauge, "The number of established connections both in use and idle.", float64(s.OpenConnections)),
+		family("in_use_connections", metrics.TypeGauge, "The number of connections currently in use.", float64(s.InUse)),
+		family("idle_connections", metrics.TypeGauge, "The number of idle connections.", float64(s.Idle)),
+		family("wait_count_total", metrics.TypeCounter, "The total number of connections waited for.", float64(s.WaitCount)),
+		family("wait_duration_seconds_total", metrics.TypeCounter, "The total time blocked waiting for a new connection.", s.WaitDuration.Seconds()),
+		family("max_idle_closed_total", metrics.TypeCounter, "The total number of connections closed due to SetMaxIdleConns.", float64(s.MaxIdleClosed)),
+		family("max_idle_time_closed_total", metrics.TypeCounter, "The total number of connections closed due to SetConnMaxIdleTime.", float64(s.MaxIdleTimeClosed)),
+		family("max_lifetime_closed_total", metrics.TypeCounter, "The total number of connections closed due to SetConnMaxLifetime.", float64(s.MaxLifetimeClosed)),
+	}
+}
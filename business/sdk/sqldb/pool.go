@@ -0,0 +1,83 @@
+package sqldb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aborilov/hippo/foundation/metrics"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Supported values for selecting the database driver.
+const (
+	DriverSQL     = "sql"
+	DriverPGXPool = "pgxpool"
+)
+
+// OpenPool opens a native pgx connection pool based on the configuration.
+// Statements are prepared once per connection and served from its cache.
+func OpenPool(ctx context.Context, cfg Config) (*pgxpool.Pool, error) {
+	dsn, err := DSN(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	pcfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("parse pool config: %w", err)
+	}
+	pcfg.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeCacheStatement
+	if cfg.MaxOpenConns > 0 {
+		pcfg.MaxConns = int32(cfg.MaxOpenConns)
+	}
+	if cfg.MaxIdleConns > 0 {
+		pcfg.MinConns = int32(min(cfg.MaxIdleConns, int(pcfg.MaxConns)))
+	}
+
+	return pgxpool.NewWithConfig(ctx, pcfg)
+}
+
+// PoolStatusCheck is StatusCheck for a native pgx pool.
+func PoolStatusCheck(ctx context.Context, pool *pgxpool.Pool) error {
+	return statusCheck(ctx, func(ctx context.Context) error {
+		if err := pool.Ping(ctx); err != nil {
+			return err
+		}
+
+		var ok bool
+		return pool.QueryRow(ctx, "SELECT true").Scan(&ok)
+	})
+}
+
+// PoolStatsCollector reports the statistics of a native pgx pool, labelled
+// with the name of the pool.
+func PoolStatsCollector(name string, pool *pgxpool.Pool) metrics.Collector {
+	return metrics.CollectorFunc(func() []metrics.Family {
+		s := pool.Stat()
+		labels := []metrics.Label{{Name: "pool", Value: name}}
+		family := func(metric string, typ string, help string, v float64) metrics.Family {
+			return metrics.Family{
+				Name:    "hippo_db_pgxpool_" + metric,
+				Help:    help,
+				Type:    typ,
+				Samples: []metrics.Sample{{Labels: labels, Value: v}},
+			}
+		}
+
+		return []metrics.Family{
+			family("max_connections", metrics.TypeGauge, "Maximum size of the pool.", float64(s.MaxConns())),
+			family("total_connections", metrics.TypeGauge, "The number of connections currently in the pool.", float64(s.TotalConns())),
+			family("acquired_connections", metrics.TypeGauge, "The number of connections currently acquired.", float64(s.AcquiredConns())),
+			family("idle_connections", metrics.TypeGauge, "The number of idle connections.", float64(s.IdleConns())),
+			family("constructing_connections", metrics.TypeGauge, "The number of connections being established.", float64(s.ConstructingConns())),
+			family("acquire_total", metrics.TypeCounter, "The total number of successful acquires.", float64(s.AcquireCount())),
+			family("acquire_duration_seconds_total", metrics.TypeCounter, "The total time spent in successful acquires.", s.AcquireDuration().Seconds()),
+			family("empty_acquire_total", metrics.TypeCounter, "The total number of acquires that waited for a connection.", float64(s.EmptyAcquireCount())),
+			family("canceled_acquire_total", metrics.TypeCounter, "The total number of acquires cancelled by their context.", float64(s.CanceledAcquireCount())),
+			family("new_connections_total", metrics.TypeCounter, "The total number of connections opened.", float64(s.NewConnsCount())),
+			family("max_lifetime_closed_total", metrics.TypeCounter, "The total number of connections closed for exceeding their lifetime.", float64(s.MaxLifetimeDestroyCount())),
+			family("max_idle_closed_total", metrics.TypeCounter, "The total number of connections closed for being idle too long.", float64(s.MaxIdleDestroyCount())),
+		}
+	})
+}
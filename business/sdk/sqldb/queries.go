@@ -0,0 +1,193 @@
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aborilov/hippo/foundation/logger"
+	"github.com/aborilov/hippo/foundation/metrics"
+	"github.com/aborilov/hippo/foundation/requestid"
+	"github.com/doug-martin/goqu/v9"
+	"github.com/jmoiron/sqlx"
+)
+
+// Dialect is the goqu dialect of the handles returned by Queries. It renders
+// numbered placeholders so statements can run with bound arguments. It is
+// registered under its own name so the global "postgres" dialect other
+// packages may rely on stays untouched.
+const Dialect = "hippo-postgres"
+
+func init() {
+	opts := goqu.DefaultDialectOptions()
+	opts.PlaceHolderFragment = []byte("$")
+	opts.IncludePlaceholderNum = true
+	goqu.RegisterDialect(Dialect, opts)
+}
+
+// queryLogName is the name of the logger statements are reported on.
+const queryLogName = "sqldb.query"
+
+// Queries records the statements run through the handles it wraps: each one
+// is timed and counted, and statements slower than the threshold are logged
+// with their text and redacted arguments.
+type Queries struct {
+	slow       time.Duration
+	statements *metrics.CounterVec
+	duration   *metrics.HistogramVec
+	slowTotal  *metrics.CounterVec
+}
+
+// NewQueries creates the statement metrics and registers them with reg. A
+// zero slow threshold disables slow statement logging.
+func NewQueries(slow time.Duration, reg *metrics.Registry) *Queries {
+	q := Queries{
+		slow: slow,
+		statements: metrics.NewCounterVec("hippo_db_statements_total",
+			"Number of SQL statements run.", "statement", "result"),
+		duration: metrics.NewHistogramVec("hippo_db_statement_duration_seconds",
+			"Latency of SQL statements.", metrics.DefBuckets, "statement"),
+		slowTotal: metrics.NewCounterVec("hippo_db_slow_statements_total",
+			"Number of SQL statements over the slow threshold.", "statement"),
+	}
+	reg.Register(q.statements, q.duration, q.slowTotal)
+	return &q
+}
+
+// Wrap returns a handle on db recording its statements. Statements run
+// unrecorded when q is nil.
+func (q *Queries) Wrap(db *sqlx.DB) *DB {
+	return &DB{DB: db, q: q}
+}
+
+// record reports a statement that took d and affected rows, which is -1 when
+// the count isn't known.
+func (q *Queries) record(ctx context.Context, query string, args []any, start time.Time, rows int64, err error) {
+	if q == nil {
+		return
+	}
+
+	d := time.Since(start)
+	stmt := statementKind(query)
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	q.statements.Inc(stmt, result)
+	q.duration.Observe(d.Seconds(), stmt)
+
+	log := logger.FromContext(ctx).WithName(queryLogName)
+	kv := []any{"statement", stmt, "duration", d.String(), "request_id", requestid.FromContext(ctx)}
+	if rows >= 0 {
+		kv = append(kv, "rows", rows)
+	}
+
+	switch {
+	case err != nil:
+		log.V(1).Info("statement failed", append(kv, "query", query, "args", redact(args), "error", err.Error())...)
+	case q.slow > 0 && d >= q.slow:
+		q.slowTotal.Inc(stmt)
+		log.Info("slow statement", append(kv, "query", query, "args", redact(args))...)
+	default:
+		log.V(3).Info("statement", kv...)
+	}
+}
+
+// statementKind returns the lower cased leading keyword of query, which
+// keeps the metric labels bounded.
+func statementKind(query string) string {
+	kw, _, _ := strings.Cut(strings.TrimSpace(query), " ")
+	switch kw = strings.ToLower(kw); kw {
+	case "select", "insert", "update", "delete", "with", "copy":
+		return kw
+	}
+	return "other"
+}
+
+// redact replaces argument values with their types so logs never carry
+// patient or credential data.
+func redact(args []any) []string {
+	out := make([]string, len(args))
+	for i, a := range args {
+		out[i] = fmt.Sprintf("$%d=<%T>", i+1, a)
+	}
+	return out
+}
+
+// DB is a database handle that records its statements. It satisfies the
+// database interface of goqu.
+type DB struct {
+	*sqlx.DB
+	q *Queries
+}
+
+func (db *DB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	start := time.Now()
+	res, err := db.DB.ExecContext(ctx, query, args...)
+	db.q.record(ctx, query, args, start, rowsAffected(res, err), err)
+	return res, err
+}
+
+func (db *DB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := db.DB.QueryContext(ctx, query, args...)
+	db.q.record(ctx, query, args, start, -1, err)
+	return rows, err
+}
+
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	start := time.Now()
+	row := db.DB.QueryRowContext(ctx, query, args...)
+	db.q.record(ctx, query, args, start, -1, row.Err())
+	return row
+}
+
+// Tx starts a transaction whose statements are recorded like those of db.
+func (db *DB) Tx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	tx, err := db.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx, q: db.q}, nil
+}
+
+// Tx is a transaction that records its statements. It satisfies the
+// transaction interface of goqu.
+type Tx struct {
+	*sql.Tx
+	q *Queries
+}
+
+func (tx *Tx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	start := time.Now()
+	res, err := tx.Tx.ExecContext(ctx, query, args...)
+	tx.q.record(ctx, query, args, start, rowsAffected(res, err), err)
+	return res, err
+}
+
+func (tx *Tx) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := tx.Tx.QueryContext(ctx, query, args...)
+	tx.q.record(ctx, query, args, start, -1, err)
+	return rows, err
+}
+
+func (tx *Tx) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	start := time.Now()
+	row := tx.Tx.QueryRowContext(ctx, query, args...)
+	tx.q.record(ctx, query, args, start, -1, row.Err())
+	return row
+}
+
+func rowsAffected(res sql.Result, err error) int64 {
+	if err != nil {
+		return -1
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return -1
+	}
+	return n
+}
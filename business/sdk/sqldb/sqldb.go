@@ -2,12 +2,36 @@
 package sqldb
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
 	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/aborilov/hippo/foundation/logger"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/jmoiron/sqlx"
 )
 
+// Backoff bounds between StatusCheck attempts.
+const (
+	minRetryDelay = 100 * time.Millisecond
+	maxRetryDelay = 5 * time.Second
+)
+
+// Supported values of Config.SSLMode, as defined by libpq.
+const (
+	SSLModeDisable    = "disable"
+	SSLModeAllow      = "allow"
+	SSLModePrefer     = "prefer"
+	SSLModeRequire    = "require"
+	SSLModeVerifyCA   = "verify-ca"
+	SSLModeVerifyFull = "verify-full"
+)
+
 // Config is the required properties to use the database.
 type Config struct {
 	User         string
@@ -17,14 +41,60 @@ type Config struct {
 	Schema       string
 	MaxIdleConns int
 	MaxOpenConns int
-	DisableTLS   bool
+
+	// SSLMode selects how the server is authenticated. It defaults to
+	// SSLModeRequire; verify-ca and verify-full check the server
+	// certificate against SSLRootCert.
+	SSLMode     string
+	SSLRootCert string
+
+	// SSLCert and SSLKey are the client certificate and key presented to
+	// the server when it requires certificate authentication.
+	SSLCert string
+	SSLKey  string
+
+	// ConnectTimeout bounds establishing a connection and StatementTimeout
+	// bounds every statement run on it. Zero means no limit.
+	ConnectTimeout   time.Duration
+	StatementTimeout time.Duration
 }
 
 // Open knows how to open a database connection based on the configuration.
 func Open(cfg Config) (*sqlx.DB, error) {
-	sslMode := "require"
-	if cfg.DisableTLS {
-		sslMode = "disable"
+	dsn, err := DSN(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sqlx.Open("pgx", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+
+	return db, nil
+}
+
+// DSN builds the connection URL for the configuration.
+func DSN(cfg Config) (string, error) {
+	sslMode := cfg.SSLMode
+	if sslMode == "" {
+		sslMode = SSLModeRequire
+	}
+
+	switch sslMode {
+	case SSLModeDisable, SSLModeAllow, SSLModePrefer, SSLModeRequire:
+	case SSLModeVerifyCA, SSLModeVerifyFull:
+		if cfg.SSLRootCert == "" {
+			return "", fmt.Errorf("sslmode %s requires a root certificate", sslMode)
+		}
+	default:
+		return "", fmt.Errorf("unsupported sslmode %q", sslMode)
+	}
+
+	if (cfg.SSLCert == "") != (cfg.SSLKey == "") {
+		return "", errors.New("client certificate and key must be set together")
 	}
 
 	q := make(url.Values)
@@ -33,6 +103,20 @@ func Open(cfg Config) (*sqlx.DB, error) {
 	if cfg.Schema != "" {
 		q.Set("search_path", cfg.Schema)
 	}
+	if cfg.SSLRootCert != "" {
+		q.Set("sslrootcert", cfg.SSLRootCert)
+	}
+	if cfg.SSLCert != "" {
+		q.Set("sslcert", cfg.SSLCert)
+		q.Set("sslkey", cfg.SSLKey)
+	}
+	if cfg.ConnectTimeout > 0 {
+		secs := int64(math.Ceil(cfg.ConnectTimeout.Seconds()))
+		q.Set("connect_timeout", strconv.FormatInt(secs, 10))
+	}
+	if cfg.StatementTimeout > 0 {
+		q.Set("statement_timeout", strconv.FormatInt(cfg.StatementTimeout.Milliseconds(), 10))
+	}
 
 	u := url.URL{
 		Scheme:   "postgres",
@@ -41,13 +125,130 @@ func Open(cfg Config) (*sqlx.DB, error) {
 		Path:     cfg.Name,
 		RawQuery: q.Encode(),
 	}
+	return u.String(), nil
+}
 
-	db, err := sqlx.Open("pgx", u.String())
+// Override returns a copy of cfg with the settings present in the postgres
+// URL dsn replacing the matching fields. Anything dsn leaves out keeps the
+// value of cfg.
+func (cfg Config) Override(dsn string) (Config, error) {
+	u, err := url.Parse(dsn)
 	if err != nil {
-		return nil, err
+		return Config{}, errors.New("malformed dsn")
+	}
+	if u.Scheme != "postgres" && u.Scheme != "postgresql" {
+		return Config{}, fmt.Errorf("unsupported dsn scheme %q", u.Scheme)
 	}
-	db.SetMaxIdleConns(cfg.MaxIdleConns)
-	db.SetMaxOpenConns(cfg.MaxOpenConns)
 
-	return db, nil
+	if u.User != nil {
+		cfg.User = u.User.Username()
+		if pass, ok := u.User.Password(); ok {
+			cfg.Password = pass
+		}
+	}
+	if u.Host != "" {
+		cfg.Host = u.Host
+	}
+	if name := strings.TrimPrefix(u.Path, "/"); name != "" {
+		cfg.Name = name
+	}
+
+	for key, vals := range u.Query() {
+		v := vals[len(vals)-1]
+		switch key {
+		case "sslmode":
+			cfg.SSLMode = v
+		case "sslrootcert":
+			cfg.SSLRootCert = v
+		case "sslcert":
+			cfg.SSLCert = v
+		case "sslkey":
+			cfg.SSLKey = v
+		case "search_path":
+			cfg.Schema = v
+		case "connect_timeout":
+			secs, err := strconv.Atoi(v)
+			if err != nil {
+				return Config{}, fmt.Errorf("parse connect_timeout %q: %w", v, err)
+			}
+			cfg.ConnectTimeout = time.Duration(secs) * time.Second
+		case "statement_timeout":
+			ms, err := strconv.Atoi(v)
+			if err != nil {
+				return Config{}, fmt.Errorf("parse statement_timeout %q: %w", v, err)
+			}
+			cfg.StatementTimeout = time.Duration(ms) * time.Millisecond
+		default:
+			return Config{}, fmt.Errorf("unsupported dsn parameter %q", key)
+		}
+	}
+
+	return cfg, nil
+}
+
+// LegacySSLMode folds the deprecated DisableTLS setting into sslMode.
+// An empty disableTLS leaves sslMode as is. "false" asks for TLS and turns
+// the disable mode into require, while "true" only agrees with the disable
+// mode; any other combination is a conflicting configuration.
+func LegacySSLMode(sslMode string, disableTLS string) (string, error) {
+	if disableTLS == "" {
+		return sslMode, nil
+	}
+
+	disable, err := strconv.ParseBool(disableTLS)
+	if err != nil {
+		return "", fmt.Errorf("parse disable tls %q: %w", disableTLS, err)
+	}
+
+	switch {
+	case !disable && sslMode == SSLModeDisable:
+		return SSLModeRequire, nil
+	case disable && sslMode != SSLModeDisable:
+		return "", fmt.Errorf("disable tls conflicts with sslmode %s", sslMode)
+	}
+	return sslMode, nil
+}
+
+// StatusCheck returns nil if it can successfully talk to the database. It
+// retries with exponential backoff until the deadline of ctx, logging every
+// failed attempt, and returns the last error once the deadline passes.
+func StatusCheck(ctx context.Context, db *sqlx.DB) error {
+	return statusCheck(ctx, func(ctx context.Context) error {
+		return ping(ctx, db)
+	})
+}
+
+func statusCheck(ctx context.Context, ping func(context.Context) error) error {
+	log := logger.FromContext(ctx).WithName("sqldb")
+	delay := minRetryDelay
+
+	for attempt := 1; ; attempt++ {
+		err := ping(ctx)
+		if err == nil {
+			if attempt > 1 {
+				log.Info("database ready", "attempts", attempt)
+			}
+			return nil
+		}
+
+		log.Info("database not ready", "attempt", attempt, "retry_in", delay.String(), "error", err.Error())
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("database not ready after %d attempts: %w", attempt, err)
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxRetryDelay)
+	}
+}
+
+// ping makes a round trip to the database, which PingContext alone doesn't
+// guarantee for pooled connections.
+func ping(ctx context.Context, db *sqlx.DB) error {
+	if err := db.PingContext(ctx); err != nil {
+		return err
+	}
+
+	var ok bool
+	return db.QueryRowContext(ctx, "SELECT true").Scan(&ok)
 }
@@ -0,0 +1,300 @@
+package gs1
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// GS is the ASCII group separator scanners send for FNC1, which ends the
+// value of a variable length element when another element follows.
+const GS = '\x1d'
+
+// Application identifiers of the elements found on drug packages.
+const (
+	AISSCC   = "00"
+	AIGTIN   = "01"
+	AILot    = "10"
+	AIExpiry = "17"
+	AISerial = "21"
+)
+
+// Element is an application identifier and its value.
+type Element struct {
+	AI    string
+	Value string
+}
+
+// Elements are the elements of an element string, in the order they are
+// encoded.
+type Elements []Element
+
+// Get returns the value of the element with the application identifier ai.
+func (es Elements) Get(ai string) (string, bool) {
+	for _, e := range es {
+		if e.AI == ai {
+			return e.Value, true
+		}
+	}
+	return "", false
+}
+
+type kind uint8
+
+const (
+	alphanumeric kind = iota
+	numeric
+	checked // numeric, ending with a check digit
+	date    // YYMMDD
+)
+
+type spec struct {
+	length int
+	fixed  bool
+	kind   kind
+}
+
+// specs lists the application identifiers the parser knows. The length of
+// the others can't be told, so element strings holding them are rejected.
+var specs = map[string]spec{
+	"00":  {18, true, checked},       // SSCC
+	"01":  {14, true, checked},       // GTIN
+	"02":  {14, true, checked},       // GTIN of contained trade items
+	"10":  {20, false, alphanumeric}, // batch or lot
+	"11":  {6, true, date},           // production date
+	"12":  {6, true, date},           // due date
+	"13":  {6, true, date},           // packaging date
+	"15":  {6, true, date},           // best before
+	"16":  {6, true, date},           // sell by
+	"17":  {6, true, date},           // expiration date
+	"20":  {2, true, numeric},        // internal product variant
+	"21":  {20, false, alphanumeric}, // serial number
+	"22":  {20, false, alphanumeric}, // consumer product variant
+	"30":  {8, false, numeric},       // variable count
+	"37":  {8, false, numeric},       // count of contained trade items
+	"240": {30, false, alphanumeric}, // additional product identification
+	"241": {30, false, alphanumeric}, // customer part number
+	"250": {30, false, alphanumeric}, // secondary serial number
+	"710": {20, false, alphanumeric}, // national healthcare reimbursement number, Germany
+	"711": {20, false, alphanumeric}, // France
+	"712": {20, false, alphanumeric}, // Spain
+	"713": {20, false, alphanumeric}, // Brazil
+	"714": {20, false, alphanumeric}, // Portugal
+	"715": {20, false, alphanumeric}, // United States
+	"716": {20, false, alphanumeric}, // Italy
+}
+
+// ParseElementString parses a GS1 element string as sent by a scanner, such
+// as a DataMatrix or GS1-128 barcode, and validates its elements. The string
+// may start with a symbology identifier like "]d2" and separates elements
+// with GS. The human readable form, with application identifiers in
+// parentheses, is accepted as well.
+//
+// Dates are read with the century that puts them closest to now, as GS1
+// specifies.
+func ParseElementString(s string, now time.Time) (Elements, error) {
+	if strings.HasPrefix(s, "(") {
+		return parseHumanReadable(s, now)
+	}
+
+	if len(s) >= 3 && s[0] == ']' {
+		s = s[3:]
+	}
+	s = strings.TrimLeft(s, string(GS))
+
+	var es Elements
+	for s != "" {
+		ai, sp, ok := lookupAI(s)
+		if !ok {
+			return nil, fmt.Errorf("unknown application identifier at %q", s)
+		}
+		s = s[len(ai):]
+
+		var value string
+		if sp.fixed {
+			if len(s) < sp.length {
+				return nil, fmt.Errorf("(%s) %q is shorter than %d characters", ai, s, sp.length)
+			}
+			value, s = s[:sp.length], s[sp.length:]
+		} else {
+			end := strings.IndexByte(s, GS)
+			if end < 0 {
+				end = len(s)
+			}
+			value, s = s[:end], s[end:]
+		}
+		// a separator may follow fixed length elements too
+		s = strings.TrimPrefix(s, string(GS))
+
+		if err := add(&es, ai, sp, value, now); err != nil {
+			return nil, err
+		}
+	}
+	if len(es) == 0 {
+		return nil, fmt.Errorf("element string is empty")
+	}
+	return es, nil
+}
+
+// parseHumanReadable parses an element string written as "(01)...(17)...".
+// Parentheses may appear in values too, so a variable length value ends only
+// where a known application identifier in parentheses follows. A value
+// holding one, like "(10)", can't be told apart in this form.
+func parseHumanReadable(s string, now time.Time) (Elements, error) {
+	var es Elements
+	for s != "" {
+		ai, rest, ok := cutAI(s)
+		if !ok {
+			return nil, fmt.Errorf("expected an application identifier in parentheses at %q", s)
+		}
+		sp, ok := specs[ai]
+		if !ok {
+			return nil, fmt.Errorf("unknown application identifier (%s)", ai)
+		}
+
+		var value string
+		if sp.fixed {
+			if len(rest) < sp.length {
+				return nil, fmt.Errorf("(%s) %q is shorter than %d characters", ai, rest, sp.length)
+			}
+			value, s = rest[:sp.length], rest[sp.length:]
+			if s != "" && s[0] != '(' {
+				return nil, fmt.Errorf("(%s) %q is longer than %d characters", ai, rest, sp.length)
+			}
+		} else {
+			end := len(rest)
+			for i := range len(rest) {
+				if next, _, ok := cutAI(rest[i:]); ok && isKnown(next) {
+					end = i
+					break
+				}
+			}
+			value, s = rest[:end], rest[end:]
+		}
+
+		if err := add(&es, ai, sp, value, now); err != nil {
+			return nil, err
+		}
+	}
+	if len(es) == 0 {
+		return nil, fmt.Errorf("element string is empty")
+	}
+	return es, nil
+}
+
+// cutAI cuts the application identifier in parentheses, 2 to 4 digits, s
+// starts with and returns it and the rest of s.
+func cutAI(s string) (string, string, bool) {
+	if s == "" || s[0] != '(' {
+		return "", "", false
+	}
+	ai, rest, ok := strings.Cut(s[1:], ")")
+	if !ok || len(ai) < 2 || len(ai) > 4 || !isDigits(ai) {
+		return "", "", false
+	}
+	return ai, rest, true
+}
+
+func isKnown(ai string) bool {
+	_, ok := specs[ai]
+	return ok
+}
+
+// lookupAI returns the application identifier s starts with. Identifiers
+// are prefix free, so at most one of them matches.
+func lookupAI(s string) (string, spec, bool) {
+	for n := 2; n <= 4 && n <= len(s); n++ {
+		if sp, ok := specs[s[:n]]; ok {
+			return s[:n], sp, true
+		}
+	}
+	return "", spec{}, false
+}
+
+// add validates an element and appends it to es. An identifier may repeat
+// only with the same value.
+func add(es *Elements, ai string, sp spec, value string, now time.Time) error {
+	if value == "" {
+		return fmt.Errorf("(%s) is empty", ai)
+	}
+	if len(value) > sp.length {
+		return fmt.Errorf("(%s) %q is longer than %d characters", ai, value, sp.length)
+	}
+
+	switch sp.kind {
+	case alphanumeric:
+		for i := range len(value) {
+			if !isCSet82(value[i]) {
+				return fmt.Errorf("(%s) %q holds a character outside GS1 character set 82", ai, value)
+			}
+		}
+	case numeric:
+		if !isDigits(value) {
+			return fmt.Errorf("(%s) %q is not a string of digits", ai, value)
+		}
+	case checked:
+		want, err := CheckDigit(value[:len(value)-1])
+		if err != nil {
+			return fmt.Errorf("(%s) %w", ai, err)
+		}
+		if value[len(value)-1] != want {
+			return fmt.Errorf("(%s) %q has check digit %c, want %c", ai, value, value[len(value)-1], want)
+		}
+	case date:
+		if _, err := ParseDate(value, now); err != nil {
+			return fmt.Errorf("(%s) %w", ai, err)
+		}
+	}
+
+	if prev, ok := es.Get(ai); ok {
+		if prev != value {
+			return fmt.Errorf("(%s) is encoded twice with different values", ai)
+		}
+		return nil
+	}
+	*es = append(*es, Element{AI: ai, Value: value})
+	return nil
+}
+
+// isCSet82 tells whether c belongs to GS1 character set 82, the characters
+// alphanumeric elements may hold: the printable ASCII characters other than
+// space and #$@[\]^`{|}~.
+func isCSet82(c byte) bool {
+	switch {
+	case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+		return true
+	}
+	return strings.IndexByte(`!"%&'()*+,-./:;<=>?_`, c) >= 0
+}
+
+// ParseDate parses a YYMMDD date. A day of 00 stands for the last day of
+// the month. The century is the one that puts the date within 49 years
+// before or 50 years after now.
+func ParseDate(v string, now time.Time) (time.Time, error) {
+	if len(v) != 6 || !isDigits(v) {
+		return time.Time{}, fmt.Errorf("date %q is not YYMMDD", v)
+	}
+	yy := int(v[0]-'0')*10 + int(v[1]-'0')
+	month := time.Month(int(v[2]-'0')*10 + int(v[3]-'0'))
+	day := int(v[4]-'0')*10 + int(v[5]-'0')
+
+	year := now.Year() - now.Year()%100 + yy
+	switch diff := yy - now.Year()%100; {
+	case diff >= 51:
+		year -= 100
+	case diff <= -50:
+		year += 100
+	}
+
+	if month < time.January || month > time.December {
+		return time.Time{}, fmt.Errorf("date %q has no month %d", v, month)
+	}
+	last := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	if day == 0 {
+		day = last
+	}
+	if day > last {
+		return time.Time{}, fmt.Errorf("date %q has no day %d", v, day)
+	}
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC), nil
+}
@@ -0,0 +1,141 @@
+package gs1_test
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aborilov/hippo/foundation/gs1"
+)
+
+func TestParseElementString(t *testing.T) {
+	now := time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+	gtin := gs1.Element{AI: gs1.AIGTIN, Value: "00300710155237"}
+	expiry := gs1.Element{AI: gs1.AIExpiry, Value: "270331"}
+
+	tests := []struct {
+		name string
+		in   string
+		want gs1.Elements
+		err  bool
+	}{
+		{
+			name: "plain",
+			in:   "010030071015523717270331" + "10LOT-1\x1d21SN123",
+			want: gs1.Elements{gtin, expiry, {AI: gs1.AILot, Value: "LOT-1"}, {AI: gs1.AISerial, Value: "SN123"}},
+		},
+		{
+			name: "symbology identifier",
+			in:   "]d2010030071015523710LOT-1",
+			want: gs1.Elements{gtin, {AI: gs1.AILot, Value: "LOT-1"}},
+		},
+		{
+			name: "separator after a fixed length element",
+			in:   "0100300710155237\x1d17270331\x1d10LOT-1",
+			want: gs1.Elements{gtin, expiry, {AI: gs1.AILot, Value: "LOT-1"}},
+		},
+		{
+			name: "repeated identifier",
+			in:   "010030071015523710LOT-1\x1d0100300710155237",
+			want: gs1.Elements{gtin, {AI: gs1.AILot, Value: "LOT-1"}},
+		},
+		{
+			name: "repeated identifier with another value",
+			in:   "010030071015523710LOT-1\x1d10LOT-2",
+			err:  true,
+		},
+		{
+			name: "last day of the month",
+			in:   "010030071015523717270200",
+			want: gs1.Elements{gtin, {AI: gs1.AIExpiry, Value: "270200"}},
+		},
+		{
+			name: "human readable",
+			in:   "(01)00300710155237(17)270331(10)LOT-1",
+			want: gs1.Elements{gtin, expiry, {AI: gs1.AILot, Value: "LOT-1"}},
+		},
+		{
+			name: "human readable lot with parentheses",
+			in:   "(01)00300710155237(10)A(1)B(2)(17)270331",
+			want: gs1.Elements{gtin, {AI: gs1.AILot, Value: "A(1)B(2)"}, expiry},
+		},
+		{
+			name: "human readable lot ending with a parenthesis",
+			in:   "(01)00300710155237(10)LOT(",
+			want: gs1.Elements{gtin, {AI: gs1.AILot, Value: "LOT("}},
+		},
+		{
+			name: "human readable fixed length element too long",
+			in:   "(01)003007101552370(10)LOT-1",
+			err:  true,
+		},
+		{name: "check digit", in: "0100300710155238", err: true},
+		{name: "short fixed length element", in: "01003007101552", err: true},
+		{name: "invalid date", in: "010030071015523717271301", err: true},
+		{name: "character outside set 82", in: "10LOT#1", err: true},
+		{name: "space", in: "10LOT 1", err: true},
+		{name: "lot too long", in: "10" + "LOT-123456789012345678", err: true},
+		{name: "unknown identifier", in: "9912345", err: true},
+		{name: "empty", in: "]d2", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := gs1.ParseElementString(tt.in, now)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("got %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse: %s", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		in   string
+		now  int
+		want string
+		err  bool
+	}{
+		{in: "270331", now: 2026, want: "2027-03-31"},
+		{in: "270400", now: 2026, want: "2027-04-30"},
+		{in: "240200", now: 2026, want: "2024-02-29"},
+		{in: "250200", now: 2026, want: "2025-02-28"},
+		{in: "761231", now: 2026, want: "2076-12-31"},
+		{in: "770101", now: 2026, want: "1977-01-01"},
+		{in: "310101", now: 2080, want: "2031-01-01"},
+		{in: "300101", now: 2080, want: "2130-01-01"},
+		{in: "990101", now: 2001, want: "1999-01-01"},
+		{in: "270230", now: 2026, err: true},
+		{in: "271301", now: 2026, err: true},
+		{in: "270001", now: 2026, err: true},
+		{in: "2703", now: 2026, err: true},
+		{in: "27033A", now: 2026, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := gs1.ParseDate(tt.in, time.Date(tt.now, time.June, 1, 0, 0, 0, 0, time.UTC))
+			if tt.err {
+				if err == nil {
+					t.Fatalf("got %s, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse: %s", err)
+			}
+			if got.Format(time.DateOnly) != tt.want {
+				t.Errorf("got %s, want %s", got.Format(time.DateOnly), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+// Package gs1 validates and parses the GS1 identifiers printed on product
+// barcodes.
+package gs1
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GTINLength is the length of a GTIN in its 14 digit form.
+const GTINLength = 14
+
+// CheckDigit returns the GS1 check digit of digits, the identifier without
+// its check digit.
+func CheckDigit(digits string) (byte, error) {
+	if !isDigits(digits) {
+		return 0, fmt.Errorf("%q is not a string of digits", digits)
+	}
+
+	// weights alternate 3 and 1 starting from the rightmost digit
+	sum := 0
+	for i := range len(digits) {
+		d := int(digits[len(digits)-1-i] - '0')
+		if i%2 == 0 {
+			d *= 3
+		}
+		sum += d
+	}
+	return byte('0' + (10-sum%10)%10), nil
+}
+
+// NormalizeGTIN validates a GTIN-8, GTIN-12 (UPC-A), GTIN-13 (EAN-13) or
+// GTIN-14 and returns it padded with zeros to 14 digits.
+func NormalizeGTIN(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case !isDigits(s):
+		return "", fmt.Errorf("gtin %q is not a string of digits", s)
+	case len(s) != 8 && len(s) != 12 && len(s) != 13 && len(s) != 14:
+		return "", fmt.Errorf("gtin %q has %d digits, want 8, 12, 13 or 14", s, len(s))
+	}
+
+	want, err := CheckDigit(s[:len(s)-1])
+	if err != nil {
+		return "", err
+	}
+	if s[len(s)-1] != want {
+		return "", fmt.Errorf("gtin %q has check digit %c, want %c", s, s[len(s)-1], want)
+	}
+	return strings.Repeat("0", GTINLength-len(s)) + s, nil
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := range len(s) {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,46 @@
+package gs1_test
+
+import (
+	"testing"
+
+	"github.com/aborilov/hippo/foundation/gs1"
+)
+
+func TestNormalizeGTIN(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+		err  bool
+	}{
+		{name: "gtin-8", in: "96385074", want: "00000096385074"},
+		{name: "gtin-12", in: "036000291452", want: "00036000291452"},
+		{name: "gtin-13", in: "4006381333931", want: "04006381333931"},
+		{name: "gtin-14", in: "10300930123457", want: "10300930123457"},
+		{name: "surrounding space", in: " 96385074\n", want: "00000096385074"},
+		{name: "gtin-8 check digit", in: "96385075", err: true},
+		{name: "gtin-12 check digit", in: "036000291453", err: true},
+		{name: "gtin-13 check digit", in: "4006381333932", err: true},
+		{name: "gtin-14 check digit", in: "10300930123458", err: true},
+		{name: "length", in: "0360002914", err: true},
+		{name: "not digits", in: "03600029145A", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := gs1.NormalizeGTIN(tt.in)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("got %s, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("normalize: %s", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
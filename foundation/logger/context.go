@@ -0,0 +1,45 @@
+package logger
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/go-logr/logr"
+)
+
+var defaultLogger atomic.Pointer[logr.Logger]
+
+// SetDefault sets the logger returned by FromContext when the context
+// carries none.
+func SetDefault(log logr.Logger) {
+	defaultLogger.Store(&log)
+}
+
+// Default returns the process wide logger, which discards everything until
+// SetDefault is called.
+func Default() logr.Logger {
+	if l := defaultLogger.Load(); l != nil {
+		return *l
+	}
+	return logr.Discard()
+}
+
+// NewContext returns a copy of ctx carrying the logger.
+func NewContext(ctx context.Context, log logr.Logger) context.Context {
+	return logr.NewContext(ctx, log)
+}
+
+// FromContext returns the request scoped logger stored in ctx, falling back
+// to the default logger.
+func FromContext(ctx context.Context) logr.Logger {
+	if log, err := logr.FromContext(ctx); err == nil {
+		return log
+	}
+	return Default()
+}
+
+// With returns a copy of ctx whose logger carries the additional key/value
+// pairs.
+func With(ctx context.Context, keysAndValues ...any) context.Context {
+	return NewContext(ctx, FromContext(ctx).WithValues(keysAndValues...))
+}
@@ -0,0 +1,207 @@
+package logger
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Levels holds the default log level and per logger name overrides. It can be
+// changed while the process is running and every logger built with it picks
+// up the change immediately.
+type Levels struct {
+	mu    sync.RWMutex
+	def   zapcore.Level
+	named map[string]zapcore.Level
+	min   zapcore.Level
+}
+
+// NewLevels returns Levels logging at level by default.
+func NewLevels(level zapcore.Level) *Levels {
+	l := Levels{}
+	l.Set(level, nil)
+	return &l
+}
+
+// Set replaces the default level and the named overrides. A name applies to
+// the logger of that name and to all loggers nested below it.
+func (l *Levels) Set(level zapcore.Level, named map[string]zapcore.Level) {
+	cp := make(map[string]zapcore.Level, len(named))
+	min := level
+	for name, lvl := range named {
+		cp[name] = lvl
+		if lvl < min {
+			min = lvl
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.def = level
+	l.named = cp
+	l.min = min
+}
+
+// Get returns the default level and a copy of the named overrides.
+func (l *Levels) Get() (zapcore.Level, map[string]zapcore.Level) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	cp := make(map[string]zapcore.Level, len(l.named))
+	for name, lvl := range l.named {
+		cp[name] = lvl
+	}
+	return l.def, cp
+}
+
+// Enabled reports whether the logger with the given name logs at lvl. The
+// longest matching name override wins over the default level.
+func (l *Levels) Enabled(name string, lvl zapcore.Level) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	level := l.def
+	match := -1
+	for n, nl := range l.named {
+		if len(n) > match && (name == n || strings.HasPrefix(name, n+".")) {
+			level = nl
+			match = len(n)
+		}
+	}
+	return lvl >= level
+}
+
+func (l *Levels) anyEnabled(lvl zapcore.Level) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return lvl >= l.min
+}
+
+// ParseLevel parses a zap level name such as "debug" or "info", or a logr
+// verbosity such as "2" which enables V(2) and below.
+func ParseLevel(s string) (zapcore.Level, error) {
+	if v, err := strconv.Atoi(s); err == nil {
+		if v < 0 || v > 127 {
+			return 0, fmt.Errorf("verbosity %d out of range", v)
+		}
+		return zapcore.Level(-v), nil
+	}
+	return zapcore.ParseLevel(s)
+}
+
+// FormatLevel is the inverse of ParseLevel.
+func FormatLevel(lvl zapcore.Level) string {
+	if lvl < zapcore.DebugLevel {
+		return strconv.Itoa(-int(lvl))
+	}
+	return lvl.String()
+}
+
+// ParseNamedLevels parses overrides in the form "name:level;name:level".
+func ParseNamedLevels(s string) (map[string]zapcore.Level, error) {
+	named := map[string]zapcore.Level{}
+	for _, pair := range strings.Split(s, ";") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, level, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid named level %q", pair)
+		}
+		lvl, err := ParseLevel(strings.TrimSpace(level))
+		if err != nil {
+			return nil, fmt.Errorf("named level %q: %w", pair, err)
+		}
+		named[strings.TrimSpace(name)] = lvl
+	}
+	return named, nil
+}
+
+// FormatNamedLevels is the inverse of ParseNamedLevels.
+func FormatNamedLevels(named map[string]zapcore.Level) string {
+	names := make([]string, 0, len(named))
+	for name := range named {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + ":" + FormatLevel(named[name])
+	}
+	return strings.Join(pairs, ";")
+}
+
+// levelCore filters entries by the level configured for their logger name.
+type levelCore struct {
+	zapcore.Core
+	levels *Levels
+}
+
+func (c *levelCore) Enabled(lvl zapcore.Level) bool {
+	return c.levels.anyEnabled(lvl)
+}
+
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelCore{Core: c.Core.With(fields), levels: c.levels}
+}
+
+func (c *levelCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.levels.Enabled(ent.LoggerName, ent.Level) {
+		return ce
+	}
+	return c.Core.Check(ent, ce)
+}
+
+// Settings is the serialisable form of Levels, used by the log level
+// endpoint and settings files.
+type Settings struct {
+	Level  string            `json:"level"`
+	Levels map[string]string `json:"levels"`
+}
+
+// Settings returns the current levels.
+func (l *Levels) Settings() Settings {
+	def, named := l.Get()
+	s := Settings{
+		Level:  FormatLevel(def),
+		Levels: make(map[string]string, len(named)),
+	}
+	for name, lvl := range named {
+		s.Levels[name] = FormatLevel(lvl)
+	}
+	return s
+}
+
+// Apply replaces the levels with s. An empty Level keeps the current default
+// level and nil Levels keep the current overrides.
+func (l *Levels) Apply(s Settings) error {
+	def, named := l.Get()
+
+	if s.Level != "" {
+		lvl, err := ParseLevel(s.Level)
+		if err != nil {
+			return fmt.Errorf("level: %w", err)
+		}
+		def = lvl
+	}
+
+	if s.Levels != nil {
+		named = make(map[string]zapcore.Level, len(s.Levels))
+		for name, level := range s.Levels {
+			lvl, err := ParseLevel(level)
+			if err != nil {
+				return fmt.Errorf("level of %q: %w", name, err)
+			}
+			named[name] = lvl
+		}
+	}
+
+	l.Set(def, named)
+	return nil
+}
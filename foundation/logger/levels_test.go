@@ -0,0 +1,133 @@
+package logger_test
+
+import (
+	"testing"
+
+	"github.com/aborilov/hippo/foundation/logger"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		in   string
+		want zapcore.Level
+		err  bool
+	}{
+		{in: "info", want: zapcore.InfoLevel},
+		{in: "debug", want: zapcore.DebugLevel},
+		{in: "warn", want: zapcore.WarnLevel},
+		{in: "0", want: zapcore.InfoLevel},
+		{in: "1", want: zapcore.DebugLevel},
+		{in: "2", want: zapcore.Level(-2)},
+		{in: "-1", err: true},
+		{in: "128", err: true},
+		{in: "loud", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := logger.ParseLevel(tt.in)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("got %s, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse: %s", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNamedLevels(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		err  bool
+	}{
+		{in: "medication.repo:2;http:warn", want: "http:warn;medication.repo:2"},
+		{in: " http : debug ;; ", want: "http:debug"},
+		{in: "", want: ""},
+		{in: "http", err: true},
+		{in: "http:loud", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			named, err := logger.ParseNamedLevels(tt.in)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("got %v, want an error", named)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse: %s", err)
+			}
+			if got := logger.FormatNamedLevels(named); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLevelsEnabled(t *testing.T) {
+	levels := logger.NewLevels(zapcore.InfoLevel)
+	levels.Set(zapcore.InfoLevel, map[string]zapcore.Level{
+		"medication":      zapcore.WarnLevel,
+		"medication.repo": zapcore.Level(-2),
+	})
+
+	tests := []struct {
+		name string
+		lvl  zapcore.Level
+		want bool
+	}{
+		{name: "http", lvl: zapcore.InfoLevel, want: true},
+		{name: "http", lvl: zapcore.DebugLevel, want: false},
+		{name: "medication", lvl: zapcore.InfoLevel, want: false},
+		{name: "medication.service", lvl: zapcore.WarnLevel, want: true},
+		{name: "medication.repo", lvl: zapcore.Level(-2), want: true},
+		{name: "medication.repo.pool", lvl: zapcore.DebugLevel, want: true},
+		{name: "medicationx", lvl: zapcore.InfoLevel, want: true},
+	}
+
+	for _, tt := range tests {
+		if got := levels.Enabled(tt.name, tt.lvl); got != tt.want {
+			t.Errorf("%s at %s: got %t, want %t", tt.name, tt.lvl, got, tt.want)
+		}
+	}
+}
+
+func TestLevelsApply(t *testing.T) {
+	levels := logger.NewLevels(zapcore.InfoLevel)
+
+	if err := levels.Apply(logger.Settings{Level: "warn", Levels: map[string]string{"http": "1"}}); err != nil {
+		t.Fatalf("apply: %s", err)
+	}
+	if err := levels.Apply(logger.Settings{Level: "debug"}); err != nil {
+		t.Fatalf("apply level only: %s", err)
+	}
+	s := levels.Settings()
+	if s.Level != "debug" || s.Levels["http"] != "debug" || len(s.Levels) != 1 {
+		t.Errorf("got %+v, want debug with http kept", s)
+	}
+
+	if err := levels.Apply(logger.Settings{Level: "error", Levels: map[string]string{"http": "loud"}}); err == nil {
+		t.Fatal("applied an invalid level")
+	}
+	if got := levels.Settings(); got.Level != "debug" {
+		t.Errorf("got level %s after a failed apply, want debug", got.Level)
+	}
+
+	if err := levels.Apply(logger.Settings{Levels: map[string]string{}}); err != nil {
+		t.Fatalf("apply: %s", err)
+	}
+	if got := levels.Settings(); len(got.Levels) != 0 {
+		t.Errorf("got overrides %v, want none", got.Levels)
+	}
+}
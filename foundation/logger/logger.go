@@ -1,6 +1,9 @@
 package logger
 
 import (
+	stdlog "log"
+	"math"
+	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -9,22 +12,65 @@ import (
 	"go.uber.org/zap/zapcore"
 )
 
-type Option func(*zap.Config)
+// Supported output formats.
+const (
+	FormatConsole = "console"
+	FormatJSON    = "json"
+)
+
+type options struct {
+	zap    zap.Config
+	levels *Levels
+}
+
+type Option func(*options)
+
+// WithFormat selects the JSON production encoder for FormatJSON and the
+// console development encoder otherwise.
+func WithFormat(format string) Option {
+	return func(o *options) {
+		if format != FormatJSON {
+			return
+		}
+		prod := zap.NewProductionConfig()
+		o.zap.Development = false
+		o.zap.Encoding = prod.Encoding
+		o.zap.Sampling = prod.Sampling
+		o.zap.EncoderConfig = prod.EncoderConfig
+		o.zap.EncoderConfig.EncodeTime = utcTimeEncoder
+	}
+}
+
+// WithLevels makes the logger filter entries with levels, which can be
+// changed at runtime.
+func WithLevels(levels *Levels) Option {
+	return func(o *options) {
+		o.levels = levels
+	}
+}
 
 // NewLogger creates a new logr.Logger with the provided options.
 func NewLogger(opts ...Option) (logr.Logger, error) {
-	cfg := zap.NewDevelopmentConfig()
-	cfg.EncoderConfig.EncodeTime = func(time time.Time, encoder zapcore.PrimitiveArrayEncoder) {
-		zapcore.RFC3339TimeEncoder(time.UTC(), encoder)
-	}
-	cfg.EncoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
-	cfg.DisableStacktrace = false
+	o := options{zap: zap.NewDevelopmentConfig()}
+	o.zap.EncoderConfig.EncodeTime = utcTimeEncoder
+	o.zap.EncoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
+	o.zap.DisableStacktrace = false
 
 	for _, opt := range opts {
-		opt(&cfg)
+		opt(&o)
 	}
 
-	zl, err := cfg.Build()
+	var zopts []zap.Option
+	if o.levels != nil {
+		// Let every entry through to the wrapping core, which applies
+		// the runtime levels.
+		o.zap.Level = zap.NewAtomicLevelAt(zapcore.Level(math.MinInt8))
+		zopts = append(zopts, zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+			return &levelCore{Core: c, levels: o.levels}
+		}))
+	}
+
+	zl, err := o.zap.Build(zopts...)
 	if err != nil {
 		return logr.Discard(), err
 	}
@@ -32,3 +78,22 @@ func NewLogger(opts ...Option) (logr.Logger, error) {
 	logger := zapr.NewLoggerWithOptions(zl)
 	return logger, nil
 }
+
+// NewStdLogger adapts log for APIs that require a standard library logger,
+// such as http.Server.ErrorLog. Every line is written at error level.
+func NewStdLogger(log logr.Logger) *stdlog.Logger {
+	return stdlog.New(stdWriter{log: log}, "", 0)
+}
+
+type stdWriter struct {
+	log logr.Logger
+}
+
+func (w stdWriter) Write(p []byte) (int, error) {
+	w.log.Error(nil, strings.TrimSpace(string(p)))
+	return len(p), nil
+}
+
+func utcTimeEncoder(t time.Time, encoder zapcore.PrimitiveArrayEncoder) {
+	zapcore.RFC3339TimeEncoder(t.UTC(), encoder)
+}
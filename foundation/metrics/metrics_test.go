@@ -0,0 +1,74 @@
+package metrics_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aborilov/hippo/foundation/metrics"
+)
+
+func render(t *testing.T, cs ...metrics.Collector) string {
+	t.Helper()
+
+	r := metrics.NewRegistry()
+	r.Register(cs...)
+
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatalf("write text: %s", err)
+	}
+	return b.String()
+}
+
+func TestLabelEscaping(t *testing.T) {
+	c := metrics.NewCounterVec("requests_total", "Requests with \\ and\nnewline.", "path")
+	c.Inc("a\"b\\c\nd")
+
+	got := render(t, c)
+	want := "# HELP requests_total Requests with \\\\ and\\nnewline.\n" +
+		"# TYPE requests_total counter\n" +
+		"requests_total{path=\"a\\\"b\\\\c\\nd\"} 1\n"
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	h := metrics.NewHistogramVec("latency_seconds", "Latency.", []float64{1, 0.5}, "op")
+	h.Observe(0.2, "get")
+	h.Observe(0.7, "get")
+	h.Observe(3, "get")
+
+	got := render(t, h)
+	want := "# HELP latency_seconds Latency.\n" +
+		"# TYPE latency_seconds histogram\n" +
+		"latency_seconds_bucket{op=\"get\",le=\"0.5\"} 1\n" +
+		"latency_seconds_bucket{op=\"get\",le=\"1\"} 2\n" +
+		"latency_seconds_bucket{op=\"get\",le=\"+Inf\"} 3\n" +
+		"latency_seconds_sum{op=\"get\"} 3.9\n" +
+		"latency_seconds_count{op=\"get\"} 3\n"
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestFamilyOrdering(t *testing.T) {
+	b := metrics.NewCounterVec("b_total", "B.", "k")
+	b.Inc("y")
+	b.Inc("x")
+	a := metrics.GaugeFunc("a_value", "A.", func() float64 { return 2 })
+	dup := metrics.GaugeFunc("a_value", "A again.", func() float64 { return 3 }, metrics.Label{Name: "k", Value: "z"})
+
+	got := render(t, b, a, dup)
+	want := "# HELP a_value A.\n" +
+		"# TYPE a_value gauge\n" +
+		"a_value 2\n" +
+		"a_value{k=\"z\"} 3\n" +
+		"# HELP b_total B.\n" +
+		"# TYPE b_total counter\n" +
+		"b_total{k=\"x\"} 1\n" +
+		"b_total{k=\"y\"} 1\n"
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
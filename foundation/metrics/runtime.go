@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"runtime"
+	"time"
+)
+
+// NewRuntimeCollector reports Go runtime and process statistics.
+func NewRuntimeCollector() Collector {
+	start := float64(time.Now().Unix())
+
+	return CollectorFunc(func() []Family {
+		var ms runtime.MemStats
+		runtime.ReadMemStats(&ms)
+
+		gauge := func(name string, help string, v float64) Family {
+			return Family{Name: name, Help: help, Type: TypeGauge, Samples: []Sample{{Value: v}}}
+		}
+		counter := func(name string, help string, v float64) Family {
+			return Family{Name: name, Help: help, Type: TypeCounter, Samples: []Sample{{Value: v}}}
+		}
+
+		return []Family{
+			gauge("go_goroutines", "Number of goroutines that currently exist.", float64(runtime.NumGoroutine())),
+			gauge("go_sched_gomaxprocs_threads", "The current runtime.GOMAXPROCS setting.", float64(runtime.GOMAXPROCS(0))),
+			gauge("go_memstats_alloc_bytes", "Number of bytes allocated and still in use.", float64(ms.Alloc)),
+			counter("go_memstats_alloc_bytes_total", "Total number of bytes allocated, even if freed.", float64(ms.TotalAlloc)),
+			gauge("go_memstats_sys_bytes", "Number of bytes obtained from system.", float64(ms.Sys)),
+			gauge("go_memstats_heap_inuse_bytes", "Number of heap bytes that are in use.", float64(ms.HeapInuse)),
+			gauge("go_memstats_heap_objects", "Number of allocated objects.", float64(ms.HeapObjects)),
+			counter("go_memstats_mallocs_total", "Total number of mallocs.", float64(ms.Mallocs)),
+			counter("go_gc_cycles_total", "Number of completed GC cycles.", float64(ms.NumGC)),
+			counter("go_gc_pause_seconds_total", "Total GC stop-the-world pause time.", float64(ms.PauseTotalNs)/1e9),
+			gauge("process_start_time_seconds", "Start time of the process since unix epoch in seconds.", start),
+		}
+	})
+}
+
+// NewBuildInfo reports a constant 1 labelled with the build version and the
+// Go version the binary was built with.
+func NewBuildInfo(namespace string, version string) Collector {
+	return GaugeFunc(namespace+"_build_info", "Build information of the running binary.",
+		func() float64 { return 1 },
+		Label{Name: "version", Value: version},
+		Label{Name: "goversion", Value: runtime.Version()},
+	)
+}
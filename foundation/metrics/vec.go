@@ -0,0 +1,183 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefBuckets are latency buckets in seconds suited to request handling.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// labelSet keeps the values of one series of a vector.
+type labelSet struct {
+	key    string
+	values []string
+}
+
+func newLabelSet(names []string, values []string) labelSet {
+	if len(values) != len(names) {
+		panic(fmt.Sprintf("metrics: got %d label values for %d labels", len(values), len(names)))
+	}
+	return labelSet{key: strings.Join(values, "\xff"), values: append([]string(nil), values...)}
+}
+
+func (ls labelSet) labels(names []string, extra ...Label) []Label {
+	labels := make([]Label, 0, len(names)+len(extra))
+	for i, n := range names {
+		labels = append(labels, Label{Name: n, Value: ls.values[i]})
+	}
+	return append(labels, extra...)
+}
+
+// =============================================================================
+
+// CounterVec is a set of monotonically increasing values partitioned by
+// labels.
+type CounterVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*counterSeries
+}
+
+type counterSeries struct {
+	ls    labelSet
+	value float64
+}
+
+// NewCounterVec returns a counter vector with the given label names.
+func NewCounterVec(name string, help string, labels ...string) *CounterVec {
+	return &CounterVec{name: name, help: help, labels: labels, series: map[string]*counterSeries{}}
+}
+
+// Add increases the counter of the series identified by values by v.
+func (c *CounterVec) Add(v float64, values ...string) {
+	ls := newLabelSet(c.labels, values)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.series[ls.key]
+	if !ok {
+		s = &counterSeries{ls: ls}
+		c.series[ls.key] = s
+	}
+	s.value += v
+}
+
+// Inc increases the counter of the series identified by values by one.
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Collect implements Collector.
+func (c *CounterVec) Collect() []Family {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f := Family{Name: c.name, Help: c.help, Type: TypeCounter}
+	for _, key := range sortedKeys(c.series) {
+		s := c.series[key]
+		f.Samples = append(f.Samples, Sample{Labels: s.ls.labels(c.labels), Value: s.value})
+	}
+	return []Family{f}
+}
+
+// =============================================================================
+
+// HistogramVec is a set of value distributions partitioned by labels.
+type HistogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	ls     labelSet
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewHistogramVec returns a histogram vector with the given upper bucket
+// bounds and label names.
+func NewHistogramVec(name string, help string, buckets []float64, labels ...string) *HistogramVec {
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	return &HistogramVec{name: name, help: help, labels: labels, buckets: b, series: map[string]*histogramSeries{}}
+}
+
+// Observe records v in the series identified by values.
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	ls := newLabelSet(h.labels, values)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[ls.key]
+	if !ok {
+		s = &histogramSeries{ls: ls, counts: make([]uint64, len(h.buckets))}
+		h.series[ls.key] = s
+	}
+	for i, ub := range h.buckets {
+		if v <= ub {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += v
+}
+
+// Collect implements Collector.
+func (h *HistogramVec) Collect() []Family {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	f := Family{Name: h.name, Help: h.help, Type: TypeHistogram}
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		for i, ub := range h.buckets {
+			f.Samples = append(f.Samples, Sample{
+				Suffix: "_bucket",
+				Labels: s.ls.labels(h.labels, Label{Name: "le", Value: formatFloat(ub)}),
+				Value:  float64(s.counts[i]),
+			})
+		}
+		f.Samples = append(f.Samples,
+			Sample{Suffix: "_bucket", Labels: s.ls.labels(h.labels, Label{Name: "le", Value: formatFloat(math.Inf(1))}), Value: float64(s.count)},
+			Sample{Suffix: "_sum", Labels: s.ls.labels(h.labels), Value: s.sum},
+			Sample{Suffix: "_count", Labels: s.ls.labels(h.labels), Value: float64(s.count)},
+		)
+	}
+	return []Family{f}
+}
+
+// =============================================================================
+
+// GaugeFunc reports the value returned by fn at scrape time.
+func GaugeFunc(name string, help string, fn func() float64, labels ...Label) Collector {
+	return CollectorFunc(func() []Family {
+		return []Family{{
+			Name:    name,
+			Help:    help,
+			Type:    TypeGauge,
+			Samples: []Sample{{Labels: labels, Value: fn()}},
+		}}
+	})
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
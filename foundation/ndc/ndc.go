@@ -0,0 +1,102 @@
+// Package ndc parses National Drug Codes, the identifiers of drug packages
+// in the United States.
+//
+// An NDC has a labeler, a product and a package segment. It is printed with
+// 10 digits in one of the 4-4-2, 5-3-2 or 5-4-1 configurations, while
+// billing systems use the 11 digit 5-4-2 form, padding the short segment
+// with a leading zero.
+package ndc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NDC is a National Drug Code.
+type NDC struct {
+	Labeler string
+	Product string
+	Package string
+}
+
+// The 10 digit configurations, as the lengths of the three segments.
+var configurations = [][3]int{{4, 4, 2}, {5, 3, 2}, {5, 4, 1}}
+
+// Parse parses a hyphenated NDC in any configuration, including 5-4-2, or
+// the 11 digits of the 5-4-2 form. Ten digits without hyphens are
+// ambiguous and rejected; Candidates lists what they may stand for.
+func Parse(s string) (NDC, error) {
+	s = strings.TrimSpace(s)
+	parts := strings.Split(s, "-")
+	switch {
+	case len(parts) == 1 && len(s) == 11 && isDigits(s):
+		return NDC{Labeler: s[:5], Product: s[5:9], Package: s[9:]}, nil
+	case len(parts) == 1 && len(s) == 10 && isDigits(s):
+		return NDC{}, fmt.Errorf("ndc %q is ambiguous without hyphens, write it as 4-4-2, 5-3-2 or 5-4-1", s)
+	case len(parts) != 3:
+		return NDC{}, fmt.Errorf("ndc %q is not labeler-product-package", s)
+	}
+
+	lens := [3]int{len(parts[0]), len(parts[1]), len(parts[2])}
+	for _, p := range parts {
+		if !isDigits(p) {
+			return NDC{}, fmt.Errorf("ndc %q holds a segment that is not digits", s)
+		}
+	}
+	if lens != [3]int{5, 4, 2} && !isConfiguration(lens) {
+		return NDC{}, fmt.Errorf("ndc %q is %d-%d-%d, want 4-4-2, 5-3-2, 5-4-1 or 5-4-2", s, lens[0], lens[1], lens[2])
+	}
+	return NDC{Labeler: parts[0], Product: parts[1], Package: parts[2]}, nil
+}
+
+// Candidates returns the NDCs that ten digits printed without hyphens, such
+// as those encoded in a package barcode, may stand for, one per
+// configuration.
+func Candidates(digits string) ([]NDC, error) {
+	if len(digits) != 10 || !isDigits(digits) {
+		return nil, fmt.Errorf("%q is not a 10 digit ndc", digits)
+	}
+	out := make([]NDC, 0, len(configurations))
+	for _, c := range configurations {
+		out = append(out, NDC{
+			Labeler: digits[:c[0]],
+			Product: digits[c[0] : c[0]+c[1]],
+			Package: digits[c[0]+c[1]:],
+		})
+	}
+	return out, nil
+}
+
+// String returns the NDC in the 11 digit, hyphenated 5-4-2 form, which is
+// the same for every configuration.
+func (n NDC) String() string {
+	return pad(n.Labeler, 5) + "-" + pad(n.Product, 4) + "-" + pad(n.Package, 2)
+}
+
+func isConfiguration(lens [3]int) bool {
+	for _, c := range configurations {
+		if c == lens {
+			return true
+		}
+	}
+	return false
+}
+
+func pad(s string, n int) string {
+	if len(s) >= n {
+		return s
+	}
+	return strings.Repeat("0", n-len(s)) + s
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := range len(s) {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
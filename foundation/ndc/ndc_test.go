@@ -0,0 +1,67 @@
+package ndc_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/aborilov/hippo/foundation/ndc"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		err  bool
+	}{
+		{in: "0777-3105-02", want: "00777-3105-02"},
+		{in: "50580-506-01", want: "50580-0506-01"},
+		{in: "00093-0058-1", want: "00093-0058-01"},
+		{in: "00093-0058-01", want: "00093-0058-01"},
+		{in: "00093005801", want: "00093-0058-01"},
+		{in: " 50580-506-01 ", want: "50580-0506-01"},
+		{in: "0093005801", err: true},
+		{in: "0093-58-01", err: true},
+		{in: "0093-0058", err: true},
+		{in: "0093-0O58-01", err: true},
+		{in: "000093-0058-01", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			n, err := ndc.Parse(tt.in)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("got %s, want an error", n)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse: %s", err)
+			}
+			if n.String() != tt.want {
+				t.Errorf("got %s, want %s", n, tt.want)
+			}
+		})
+	}
+}
+
+func TestCandidates(t *testing.T) {
+	got, err := ndc.Candidates("0093005801")
+	if err != nil {
+		t.Fatalf("candidates: %s", err)
+	}
+	var forms []string
+	for _, n := range got {
+		forms = append(forms, n.String())
+	}
+	want := []string{"00093-0058-01", "00930-0058-01", "00930-0580-01"}
+	if !slices.Equal(forms, want) {
+		t.Errorf("got %v, want %v", forms, want)
+	}
+
+	for _, in := range []string{"009300580", "00930058011", "00930O5801"} {
+		if _, err := ndc.Candidates(in); err == nil {
+			t.Errorf("candidates of %q: got no error", in)
+		}
+	}
+}
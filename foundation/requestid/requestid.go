@@ -0,0 +1,30 @@
+// Package requestid carries the identifier of the request being served
+// through a context.
+package requestid
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+type ctxKey int
+
+const key ctxKey = 1
+
+// New returns a fresh request identifier.
+func New() string {
+	return uuid.NewString()
+}
+
+// NewContext returns a copy of ctx carrying the request identifier.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, key, id)
+}
+
+// FromContext returns the request identifier stored in ctx, or an empty
+// string when there is none.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(key).(string)
+	return id
+}